@@ -0,0 +1,250 @@
+package zecutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// MaxBlockSize is MAX_BLOCK_SIZE, the largest serialized block size.
+	MaxBlockSize = 2000000
+
+	// maxSolutionSize is the size of the largest Equihash solution, that of
+	// the (200, 9) parameters used on mainnet and testnet.
+	maxSolutionSize = 1344
+)
+
+// authDataPersonalization is the BLAKE2b personalization of the inner nodes of
+// the ZIP-244 authorizing data tree of a block.
+const authDataPersonalization = "ZcashAuthDatHash"
+
+// BlockHeader is a Zcash block header. It differs from the Bitcoin header by
+// its block commitments field, its 32-byte nonce and its Equihash solution.
+type BlockHeader struct {
+	Version    int32
+	PrevBlock  chainhash.Hash
+	MerkleRoot chainhash.Hash
+
+	// BlockCommitments is hashReserved before Sapling, hashFinalSaplingRoot
+	// from Sapling, hashLightClientRoot from Heartwood and
+	// hashBlockCommitments from NU5.
+	BlockCommitments chainhash.Hash
+
+	Timestamp time.Time
+	Bits      uint32
+	Nonce     [32]byte
+	Solution  []byte
+}
+
+// MsgBlock is a Zcash block.
+type MsgBlock struct {
+	Header       BlockHeader
+	Transactions []*MsgTx
+}
+
+// BlockHash returns the double SHA-256 of the serialized header, solution
+// included.
+func (h *BlockHeader) BlockHash() chainhash.Hash {
+	var buf bytes.Buffer
+	_ = h.Serialize(&buf)
+	return chainhash.DoubleHashH(buf.Bytes())
+}
+
+// Serialize writes the header to w.
+func (h *BlockHeader) Serialize(w io.Writer) error {
+	if err := h.writePowInput(w); err != nil {
+		return err
+	}
+	return WriteVarBytes(w, 0, h.Solution)
+}
+
+// writePowInput writes the header fields preceding the solution, which are
+// the input of the Equihash proof of work.
+func (h *BlockHeader) writePowInput(w io.Writer) error {
+	if err := binarySerializer.PutUint32(w, littleEndian, uint32(h.Version)); err != nil {
+		return err
+	}
+	if err := writeBytes(w, h.PrevBlock[:], h.MerkleRoot[:], h.BlockCommitments[:]); err != nil {
+		return err
+	}
+	if err := binarySerializer.PutUint32(w, littleEndian, uint32(h.Timestamp.Unix())); err != nil {
+		return err
+	}
+	if err := binarySerializer.PutUint32(w, littleEndian, h.Bits); err != nil {
+		return err
+	}
+	_, err := w.Write(h.Nonce[:])
+	return err
+}
+
+// Deserialize reads a header from r.
+func (h *BlockHeader) Deserialize(r io.Reader) error {
+	if err := binary.Read(r, binary.LittleEndian, &h.Version); err != nil {
+		return err
+	}
+	if err := readBytes(r, h.PrevBlock[:], h.MerkleRoot[:], h.BlockCommitments[:]); err != nil {
+		return err
+	}
+
+	var timestamp uint32
+	if err := binary.Read(r, binary.LittleEndian, &timestamp); err != nil {
+		return err
+	}
+	h.Timestamp = time.Unix(int64(timestamp), 0)
+
+	if err := binary.Read(r, binary.LittleEndian, &h.Bits); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r, h.Nonce[:]); err != nil {
+		return err
+	}
+
+	solution, err := ReadVarBytes(r, 0, maxSolutionSize)
+	if err != nil {
+		return err
+	}
+	h.Solution = solution
+	return nil
+}
+
+// BlockHash returns the hash of the block header.
+func (b *MsgBlock) BlockHash() chainhash.Hash {
+	return b.Header.BlockHash()
+}
+
+// TxHashes returns the txids of the transactions of the block.
+func (b *MsgBlock) TxHashes() []chainhash.Hash {
+	hashes := make([]chainhash.Hash, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		hashes[i] = tx.TxHash()
+	}
+	return hashes
+}
+
+// CalcMerkleRoot returns the merkle root of the txids of the block, to be
+// compared with the one of its header.
+func (b *MsgBlock) CalcMerkleRoot() chainhash.Hash {
+	return CalcMerkleRoot(b.TxHashes())
+}
+
+// AuthDataRoot returns hashAuthDataRoot, the root of the ZIP-244 tree of the
+// authorizing data commitments of the transactions of the block, padded with
+// zero leaves to a power of two.
+func (b *MsgBlock) AuthDataRoot() chainhash.Hash {
+	width := 1
+	for width < len(b.Transactions) {
+		width *= 2
+	}
+	level := make([]chainhash.Hash, width)
+	for i, tx := range b.Transactions {
+		level[i] = tx.AuthDigest()
+	}
+
+	for len(level) > 1 {
+		next := level[:len(level)/2]
+		for i := range next {
+			var buf [chainhash.HashSize * 2]byte
+			copy(buf[:], level[2*i][:])
+			copy(buf[chainhash.HashSize:], level[2*i+1][:])
+			next[i], _ = blake2bHash(buf[:], []byte(authDataPersonalization))
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// Serialize writes the block to w.
+func (b *MsgBlock) Serialize(w io.Writer) error {
+	if err := b.Header.Serialize(w); err != nil {
+		return err
+	}
+	if err := WriteVarInt(w, 0, uint64(len(b.Transactions))); err != nil {
+		return err
+	}
+	for _, tx := range b.Transactions {
+		if err := tx.ZecSerialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deserialize reads a block from r, decoding its transactions with
+// MsgTx.ZecDeserialize.
+func (b *MsgBlock) Deserialize(r io.Reader) error {
+	if err := b.Header.Deserialize(r); err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	if count > MaxBlockSize {
+		return fmt.Errorf("too many transactions in block: %d", count)
+	}
+
+	b.Transactions = b.Transactions[:0]
+	for i := uint64(0); i < count; i++ {
+		tx := &MsgTx{MsgTx: wire.NewMsgTx(versionOverwinter)}
+		if err = tx.ZecDeserialize(r); err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+		b.Transactions = append(b.Transactions, tx)
+	}
+	return nil
+}
+
+// ZecBlockFromHex decodes a block as returned by zcashd getblock with
+// verbosity 0.
+func ZecBlockFromHex(raw string) (*MsgBlock, error) {
+	b, err := hex.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > MaxBlockSize {
+		return nil, errors.New("block is larger than the maximum block size")
+	}
+
+	r := bytes.NewReader(b)
+	block := &MsgBlock{}
+	if err = block.Deserialize(r); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("trailing bytes after block")
+	}
+	return block, nil
+}
+
+// CalcMerkleRoot computes the Bitcoin style merkle root of the given hashes,
+// duplicating the last hash of levels with an odd number of them.
+func CalcMerkleRoot(hashes []chainhash.Hash) chainhash.Hash {
+	if len(hashes) == 0 {
+		return chainhash.Hash{}
+	}
+
+	level := append([]chainhash.Hash(nil), hashes...)
+	for len(level) > 1 {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		next := level[:0]
+		for i := 0; i < len(level); i += 2 {
+			var buf [chainhash.HashSize * 2]byte
+			copy(buf[:], level[i][:])
+			copy(buf[chainhash.HashSize:], level[i+1][:])
+			next = append(next, chainhash.DoubleHashH(buf[:]))
+		}
+		level = next
+	}
+	return level[0]
+}
@@ -0,0 +1,204 @@
+package zecutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// txExpiryHeightThreshold is TX_EXPIRY_HEIGHT_THRESHOLD, expiry heights
+// must be strictly below it.
+const txExpiryHeightThreshold = 500000000
+
+// maxFeeIterations bounds the number of times Build re-signs the transaction
+// while the conventional fee settles.
+const maxFeeIterations = 4
+
+var (
+	// ErrInsufficientFunds is returned by TxBuilder.Build when the inputs do
+	// not cover the outputs and the conventional fee.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+
+	// ErrNoChangeAddress is returned by TxBuilder.Build when the inputs
+	// exceed the outputs and the fee by more than dust but no change
+	// address was set.
+	ErrNoChangeAddress = errors.New("change address required")
+)
+
+// UTXO is a transparent output to be spent by a TxBuilder.
+type UTXO struct {
+	OutPoint wire.OutPoint
+	PkScript []byte
+	Amount   int64
+}
+
+// TxBuilder assembles transparent transactions that pay the ZIP-317
+// conventional fee and signs them.
+type TxBuilder struct {
+	params     *Params
+	utxos      []*UTXO
+	outputs    []*wire.TxOut
+	changeAddr btcutil.Address
+
+	// paysTex is set once an output pays a TEX address.
+	paysTex bool
+}
+
+// NewTxBuilder returns a TxBuilder for the given network.
+func NewTxBuilder(params *Params) *TxBuilder {
+	return &TxBuilder{params: params}
+}
+
+// AddInput adds a UTXO to be spent by the transaction.
+func (b *TxBuilder) AddInput(utxo *UTXO) {
+	b.utxos = append(b.utxos, utxo)
+}
+
+// AddOutput adds a recipient of the transaction. Dust amounts are rejected
+// since zcashd would not relay the transaction. Once a TEX address is paid
+// the transaction may only spend P2PKH outputs.
+func (b *TxBuilder) AddOutput(addr btcutil.Address, amount int64) error {
+	pkScript, err := PayToAddrScript(addr)
+	if err != nil {
+		return err
+	}
+
+	out := wire.NewTxOut(amount, pkScript)
+	if IsDust(out) {
+		return fmt.Errorf("output of %d zatoshi to %s is dust", amount, addr)
+	}
+
+	if _, ok := addr.(*ZecAddressTex); ok {
+		b.paysTex = true
+	}
+
+	b.outputs = append(b.outputs, out)
+	return nil
+}
+
+// SetChangeAddress sets the address receiving the inputs left over after
+// paying the outputs and the fee.
+func (b *TxBuilder) SetChangeAddress(addr btcutil.Address) {
+	b.changeAddr = addr
+}
+
+// Build assembles and signs a transaction to be mined at targetHeight. The
+// transaction version and consensus branch ID are those of the network
+// upgrade active at that height, and it expires DefaultExpiryDelta blocks
+// later. The conventional fee is computed on the signed transaction, change
+// is added when it is above dust and dropped into the fee otherwise.
+func (b *TxBuilder) Build(targetHeight uint32, kdb txscript.KeyDB, sdb txscript.ScriptDB) (*MsgTx, error) {
+	if len(b.utxos) == 0 {
+		return nil, errors.New("no inputs to spend")
+	}
+
+	version, err := txVersionAt(b.params, targetHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	expiryHeight := targetHeight + b.params.DefaultExpiryDelta
+	if expiryHeight >= txExpiryHeightThreshold {
+		return nil, fmt.Errorf("expiry height %d is above the threshold", expiryHeight)
+	}
+
+	if b.paysTex {
+		if err = checkTexInputs(b.utxos); err != nil {
+			return nil, err
+		}
+	}
+
+	var inAmount, outAmount int64
+	for _, utxo := range b.utxos {
+		inAmount += utxo.Amount
+	}
+	for _, out := range b.outputs {
+		outAmount += out.Value
+	}
+
+	var changeScript []byte
+	if b.changeAddr != nil {
+		if changeScript, err = PayToAddrScript(b.changeAddr); err != nil {
+			return nil, err
+		}
+	}
+
+	// Without a change address, leftovers are measured against a P2PKH
+	// output to decide whether they can be dropped into the fee.
+	dustScript := changeScript
+	if dustScript == nil {
+		dustScript = make([]byte, 25)
+	}
+
+	fee := int64(MarginalFee * GraceActions)
+	for i := 0; i < maxFeeIterations; i++ {
+		tx := &MsgTx{
+			MsgTx:             wire.NewMsgTx(version),
+			ExpiryHeight:      expiryHeight,
+			ConsensusBranchID: b.params.ConsensusBranchID(targetHeight),
+		}
+		for _, utxo := range b.utxos {
+			tx.AddTxIn(wire.NewTxIn(&utxo.OutPoint, nil, nil))
+		}
+		for _, out := range b.outputs {
+			tx.AddTxOut(wire.NewTxOut(out.Value, out.PkScript))
+		}
+
+		change := inAmount - outAmount - fee
+		if change < 0 {
+			return nil, ErrInsufficientFunds
+		}
+
+		var hasChange bool
+		if change > 0 && !IsDust(wire.NewTxOut(change, dustScript)) {
+			if changeScript == nil {
+				return nil, ErrNoChangeAddress
+			}
+			tx.AddTxOut(wire.NewTxOut(change, changeScript))
+			hasChange = true
+		}
+		if len(tx.TxOut) == 0 {
+			return nil, errors.New("no outputs to pay")
+		}
+
+		if err = b.sign(tx, kdb, sdb); err != nil {
+			return nil, err
+		}
+
+		required := ConventionalFee(tx)
+		if required == fee || (!hasChange && required <= fee) {
+			return tx, nil
+		}
+		fee = required
+	}
+
+	return nil, errors.New("conventional fee did not settle")
+}
+
+// sign signs every input of the transaction with SigHashAll.
+func (b *TxBuilder) sign(tx *MsgTx, kdb txscript.KeyDB, sdb txscript.ScriptDB) error {
+	prevOuts := make([]*wire.TxOut, len(b.utxos))
+	for i, utxo := range b.utxos {
+		prevOuts[i] = wire.NewTxOut(utxo.Amount, utxo.PkScript)
+	}
+
+	return SignAllInputs(b.params, tx, prevOuts, kdb, sdb, tx.ConsensusBranchID)
+}
+
+// txVersionAt returns the transaction version to use on the network at the
+// given height.
+func txVersionAt(params *Params, height uint32) (int32, error) {
+	switch {
+	case params.UpgradeActive(NU5BranchID, height):
+		return versionNU5, nil
+	case params.UpgradeActive(SaplingBranchID, height):
+		return versionSapling, nil
+	case params.UpgradeActive(OverwinterBranchID, height):
+		return versionOverwinter, nil
+	}
+
+	return 0, fmt.Errorf("overwinter is not active at height %d", height)
+}
@@ -0,0 +1,154 @@
+package zecutil
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestTxBuilder(t *testing.T) {
+	wif, err := btcutil.DecodeWIF(testWif)
+	if err != nil {
+		t.Fatal("can't parse wif")
+	}
+	kdb := txscript.KeyClosure(func(a btcutil.Address) (*btcec.PrivateKey, bool, error) {
+		return wif.PrivKey, wif.CompressPubKey, nil
+	})
+
+	pkScript, err := hex.DecodeString("76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := DecodeAddress(senderAddr, netParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := DecodeAddress("tmF834qorixnCV18bVrkM8WN1Xasy5eXcZV", netParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utxos := func(amounts ...int64) []*UTXO {
+		res := make([]*UTXO, len(amounts))
+		for i, amt := range amounts {
+			res[i] = &UTXO{
+				OutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(i + 1)}, Index: uint32(i)},
+				PkScript: pkScript,
+				Amount:   amt,
+			}
+		}
+		return res
+	}
+
+	tests := []struct {
+		name    string
+		height  uint32
+		inputs  []*UTXO
+		amount  int64
+		change  bool
+		version int32
+		fee     int64
+		outputs int
+		err     error
+	}{
+		{"nu6 with change", 3000000, utxos(100000000), 200000, true, versionNU5, 10000, 2, nil},
+		{"sapling with change", 300000, utxos(100000000), 200000, true, versionSapling, 10000, 2, nil},
+		{"overwinter with change", 250000, utxos(100000000), 200000, true, versionOverwinter, 10000, 2, nil},
+		{"one action per input", 3000000, utxos(100000, 100000, 100000, 100000, 100000), 400000, true, versionNU5, 25000, 2, nil},
+		{"dust change dropped", 3000000, utxos(210050), 200000, true, versionNU5, 10050, 1, nil},
+		{"exact amount without change", 3000000, utxos(210000), 200000, false, versionNU5, 10000, 1, nil},
+		{"missing change address", 3000000, utxos(100000000), 200000, false, 0, 0, 0, ErrNoChangeAddress},
+		{"insufficient funds", 3000000, utxos(205000), 200000, true, 0, 0, 0, ErrInsufficientFunds},
+	}
+
+	for _, test := range tests {
+		b := NewTxBuilder(netParams)
+		for _, utxo := range test.inputs {
+			b.AddInput(utxo)
+		}
+		if err = b.AddOutput(recipient, test.amount); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if test.change {
+			b.SetChangeAddress(sender)
+		}
+
+		tx, err := b.Build(test.height, kdb, nil)
+		if err != test.err {
+			t.Fatalf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if tx.Version != test.version {
+			t.Fatalf("%s: got version %d, want %d", test.name, tx.Version, test.version)
+		}
+		if tx.ExpiryHeight != test.height+netParams.DefaultExpiryDelta {
+			t.Fatalf("%s: got expiry height %d", test.name, tx.ExpiryHeight)
+		}
+		if tx.ConsensusBranchID != netParams.ConsensusBranchID(test.height) {
+			t.Fatalf("%s: got branch id %x", test.name, tx.ConsensusBranchID)
+		}
+		if len(tx.TxOut) != test.outputs {
+			t.Fatalf("%s: got %d outputs, want %d", test.name, len(tx.TxOut), test.outputs)
+		}
+
+		var in, out int64
+		for _, utxo := range test.inputs {
+			in += utxo.Amount
+		}
+		for _, txOut := range tx.TxOut {
+			out += txOut.Value
+		}
+		if in-out != test.fee {
+			t.Fatalf("%s: got fee %d, want %d", test.name, in-out, test.fee)
+		}
+		if ConventionalFee(tx) > test.fee {
+			t.Fatalf("%s: fee %d below conventional fee %d", test.name, test.fee, ConventionalFee(tx))
+		}
+		for i := range tx.TxIn {
+			if len(tx.TxIn[i].SignatureScript) == 0 {
+				t.Fatalf("%s: input %d not signed", test.name, i)
+			}
+		}
+	}
+
+	b := NewTxBuilder(netParams)
+	b.AddInput(utxos(100000)[0])
+	if err = b.AddOutput(recipient, 53); err == nil {
+		t.Fatal("expected dust output to be rejected")
+	}
+	if err = b.AddOutput(recipient, 50000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Build(100000, kdb, nil); err == nil {
+		t.Fatal("expected error before overwinter activation")
+	}
+}
+
+func TestConventionalFee(t *testing.T) {
+	tx := newTestTx(t, 5, 3, 1, 4)
+	// One transparent action for the small input and output, three sapling
+	// and four orchard actions.
+	if got := LogicalActions(tx); got != 8 {
+		t.Fatalf("got %d logical actions, want 8", got)
+	}
+	if got, want := ConventionalFee(tx), int64(MarginalFee*8); got != want {
+		t.Fatalf("got fee %d, want %d", got, want)
+	}
+
+	empty := &MsgTx{MsgTx: wire.NewMsgTx(5)}
+	if got := ConventionalFee(empty); got != MarginalFee*GraceActions {
+		t.Fatalf("got fee %d for empty tx", got)
+	}
+
+	if got := DustThreshold(wire.NewTxOut(0, make([]byte, 25))); got != 54 {
+		t.Fatalf("got p2pkh dust threshold %d, want 54", got)
+	}
+}
@@ -140,3 +140,23 @@ func WriteVarBytes(w io.Writer, pver uint32, bytes []byte) error {
 	_, err = w.Write(bytes)
 	return err
 }
+
+// writeBytes writes each of the passed fixed-size fields to w in order.
+func writeBytes(w io.Writer, fields ...[]byte) error {
+	for _, f := range fields {
+		if _, err := w.Write(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBytes fills each of the passed fixed-size fields from r in order.
+func readBytes(r io.Reader, fields ...[]byte) error {
+	for _, f := range fields {
+		if _, err := io.ReadFull(r, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
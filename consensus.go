@@ -0,0 +1,246 @@
+package zecutil
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// maxTxSizeBeforeSapling is MAX_TX_SIZE_BEFORE_SAPLING.
+	maxTxSizeBeforeSapling = 100000
+
+	// Bounds of the size of the signature script of coinbase transactions.
+	minCoinbaseScriptSize = 2
+	maxCoinbaseScriptSize = 100
+)
+
+// ConsensusError is a consensus rule broken by a transaction.
+type ConsensusError struct {
+	// Reason is the reject reason of zcashd, such as
+	// bad-txns-inputs-duplicate.
+	Reason string
+	Detail string
+}
+
+func (e *ConsensusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Detail)
+}
+
+func consensusError(reason string, format string, a ...interface{}) error {
+	return &ConsensusError{Reason: reason, Detail: fmt.Sprintf(format, a...)}
+}
+
+// CheckTransaction checks tx against the consensus rules of zcashd that do
+// not depend on the chain state, for inclusion in a block of the network
+// upgrade with the given branch ID. The first broken rule is returned as a
+// *ConsensusError.
+//
+// Proofs and signatures are not verified, VerifyTx checks transparent input
+// scripts.
+func CheckTransaction(tx *MsgTx, branchID uint32) error {
+	if err := checkTxVersion(tx, branchID); err != nil {
+		return err
+	}
+
+	spendsOrchard := tx.hasOrchard() && tx.Orchard.SpendsEnabled()
+	if len(tx.TxIn) == 0 && len(tx.JoinSplits) == 0 && len(tx.ShieldedSpends) == 0 && !spendsOrchard {
+		return consensusError("bad-txns-vin-empty", "no transparent inputs, JoinSplits or shielded spends")
+	}
+	outputsOrchard := tx.hasOrchard() && tx.Orchard.OutputsEnabled()
+	if len(tx.TxOut) == 0 && len(tx.JoinSplits) == 0 && len(tx.ShieldedOutputs) == 0 && !outputsOrchard {
+		return consensusError("bad-txns-vout-empty", "no transparent outputs, JoinSplits or shielded outputs")
+	}
+
+	var buf bytes.Buffer
+	if err := tx.ZecSerialize(&buf); err != nil {
+		return err
+	}
+	maxSize := maxTxSize
+	if upgradeIndex(branchID) < upgradeIndex(SaplingBranchID) {
+		maxSize = maxTxSizeBeforeSapling
+	}
+	if buf.Len() > maxSize {
+		return consensusError("bad-txns-oversize", "%d bytes is above %d", buf.Len(), maxSize)
+	}
+
+	if err := checkTxValues(tx); err != nil {
+		return err
+	}
+
+	outPoints := make(map[wire.OutPoint]struct{}, len(tx.TxIn))
+	for _, in := range tx.TxIn {
+		if _, ok := outPoints[in.PreviousOutPoint]; ok {
+			return consensusError("bad-txns-inputs-duplicate", "%v is spent twice", in.PreviousOutPoint)
+		}
+		outPoints[in.PreviousOutPoint] = struct{}{}
+	}
+
+	var joinSplitNullifiers, saplingNullifiers [][32]byte
+	for _, js := range tx.JoinSplits {
+		joinSplitNullifiers = append(joinSplitNullifiers, js.Nullifiers[:]...)
+	}
+	for _, sd := range tx.ShieldedSpends {
+		saplingNullifiers = append(saplingNullifiers, sd.Nullifier)
+	}
+	if nf, ok := duplicateNullifier(joinSplitNullifiers); ok {
+		return consensusError("bad-joinsplits-nullifiers-duplicate", "nullifier %x is revealed twice", nf)
+	}
+	if nf, ok := duplicateNullifier(saplingNullifiers); ok {
+		return consensusError("bad-spend-description-nullifiers-duplicate", "nullifier %x is revealed twice", nf)
+	}
+	if tx.hasOrchard() {
+		if nf, ok := duplicateNullifier(tx.Orchard.Nullifiers()); ok {
+			return consensusError("bad-orchard-nullifiers-duplicate", "nullifier %x is revealed twice", nf)
+		}
+	}
+
+	if isCoinBase(tx) {
+		switch size := len(tx.TxIn[0].SignatureScript); {
+		case size < minCoinbaseScriptSize || size > maxCoinbaseScriptSize:
+			return consensusError("bad-cb-length", "coinbase script of %d bytes", size)
+		case len(tx.JoinSplits) > 0:
+			return consensusError("bad-cb-has-joinsplits", "coinbase with JoinSplits")
+		case len(tx.ShieldedSpends) > 0:
+			return consensusError("bad-cb-has-spend-description", "coinbase with Sapling spends")
+		case spendsOrchard:
+			return consensusError("bad-cb-has-orchard-spend", "coinbase with Orchard spends enabled")
+		}
+	} else {
+		for i, in := range tx.TxIn {
+			if in.PreviousOutPoint.Index == wire.MaxPrevOutIndex && in.PreviousOutPoint.Hash == (chainhash.Hash{}) {
+				return consensusError("bad-txns-prevout-null", "input %d spends the null outpoint", i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkTxVersion checks that the version of tx, which implies its version
+// group ID, is allowed in the network upgrade with the given branch ID, and
+// that its fields can be encoded in that version.
+func checkTxVersion(tx *MsgTx, branchID uint32) error {
+	upgrade := upgradeIndex(branchID)
+	if upgrade < 0 {
+		return fmt.Errorf("unknown branch ID %08x", branchID)
+	}
+
+	switch {
+	case tx.Version < 1:
+		return consensusError("bad-txns-version-too-low", "version %d", tx.Version)
+	case upgrade < upgradeIndex(OverwinterBranchID):
+		if tx.Version >= versionOverwinter {
+			return consensusError("tx-overwinter-not-active", "version %d before Overwinter", tx.Version)
+		}
+	case tx.Version < versionOverwinter:
+		return consensusError("tx-overwinter-active", "version %d after Overwinter", tx.Version)
+	case upgrade < upgradeIndex(SaplingBranchID):
+		if tx.Version != versionOverwinter {
+			return consensusError("bad-tx-version-group-id", "version %d under Overwinter", tx.Version)
+		}
+	case upgrade < upgradeIndex(NU5BranchID):
+		if tx.Version != versionSapling {
+			return consensusError("bad-tx-version-group-id", "version %d under %08x", tx.Version, branchID)
+		}
+	case tx.Version != versionSapling && tx.Version != versionNU5:
+		return consensusError("bad-tx-version-group-id", "version %d under %08x", tx.Version, branchID)
+	case tx.Version == versionNU5 && tx.ConsensusBranchID != branchID:
+		return consensusError("bad-tx-consensus-branch-id-mismatch", "transaction branch ID %08x under %08x",
+			tx.ConsensusBranchID, branchID)
+	}
+
+	switch {
+	case tx.Version >= versionOverwinter && tx.ExpiryHeight >= txExpiryHeightThreshold:
+		return consensusError("bad-tx-expiry-height-too-high", "expiry height %d is not below %d",
+			tx.ExpiryHeight, txExpiryHeightThreshold)
+	case len(tx.JoinSplits) > 0 && (tx.Version < 2 || tx.Version == versionNU5):
+		return consensusError("bad-tx-has-joinsplits", "version %d has no JoinSplits", tx.Version)
+	case tx.hasSapling() && tx.Version < versionSapling:
+		return consensusError("bad-tx-has-sapling", "version %d has no Sapling bundle", tx.Version)
+	case tx.hasOrchard() && tx.Version != versionNU5:
+		return consensusError("bad-tx-has-orchard", "version %d has no Orchard bundle", tx.Version)
+	}
+	return nil
+}
+
+// checkTxValues checks that every value of tx and the totals flowing in and
+// out of the transparent pool are within the MAX_MONEY range.
+func checkTxValues(tx *MsgTx) error {
+	var valueOut int64
+	for i, out := range tx.TxOut {
+		switch {
+		case out.Value < 0:
+			return consensusError("bad-txns-vout-negative", "output %d value %d", i, out.Value)
+		case out.Value > MaxMoney:
+			return consensusError("bad-txns-vout-toolarge", "output %d value %d", i, out.Value)
+		}
+		if valueOut += out.Value; valueOut > MaxMoney {
+			return consensusError("bad-txns-txouttotal-toolarge", "outputs total %d", valueOut)
+		}
+	}
+
+	if !tx.hasSapling() && tx.ValueBalance != 0 {
+		return consensusError("bad-txns-valuebalance-nonzero", "value balance %d without Sapling spends or outputs",
+			tx.ValueBalance)
+	}
+
+	var valueIn int64
+	for _, balance := range []int64{tx.ValueBalance, tx.ValueBalanceOrchard()} {
+		if balance < -MaxMoney || balance > MaxMoney {
+			return consensusError("bad-txns-valuebalance-toolarge", "value balance %d", balance)
+		}
+		if balance < 0 {
+			valueOut -= balance
+		} else {
+			valueIn += balance
+		}
+	}
+	if valueOut > MaxMoney {
+		return consensusError("bad-txns-txouttotal-toolarge", "outputs total %d", valueOut)
+	}
+
+	for i, js := range tx.JoinSplits {
+		switch {
+		case js.VPubOld > MaxMoney:
+			return consensusError("bad-txns-vpub_old-toolarge", "JoinSplit %d vpub_old %d", i, js.VPubOld)
+		case js.VPubNew > MaxMoney:
+			return consensusError("bad-txns-vpub_new-toolarge", "JoinSplit %d vpub_new %d", i, js.VPubNew)
+		case js.VPubOld != 0 && js.VPubNew != 0:
+			return consensusError("bad-txns-vpubs-both-nonzero", "JoinSplit %d", i)
+		}
+		valueOut += int64(js.VPubOld)
+		valueIn += int64(js.VPubNew)
+		if valueOut > MaxMoney {
+			return consensusError("bad-txns-txouttotal-toolarge", "outputs total %d", valueOut)
+		}
+		if valueIn > MaxMoney {
+			return consensusError("bad-txns-txintotal-toolarge", "inputs total %d", valueIn)
+		}
+	}
+	if valueIn > MaxMoney {
+		return consensusError("bad-txns-txintotal-toolarge", "inputs total %d", valueIn)
+	}
+	return nil
+}
+
+// duplicateNullifier returns a nullifier appearing twice in nfs.
+func duplicateNullifier(nfs [][32]byte) ([32]byte, bool) {
+	seen := make(map[[32]byte]struct{}, len(nfs))
+	for _, nf := range nfs {
+		if _, ok := seen[nf]; ok {
+			return nf, true
+		}
+		seen[nf] = struct{}{}
+	}
+	return [32]byte{}, false
+}
+
+// isCoinBase reports whether tx is a coinbase transaction, spending only the
+// null outpoint.
+func isCoinBase(tx *MsgTx) bool {
+	return len(tx.TxIn) == 1 && tx.TxIn[0].PreviousOutPoint.Index == wire.MaxPrevOutIndex &&
+		tx.TxIn[0].PreviousOutPoint.Hash == (chainhash.Hash{})
+}
@@ -0,0 +1,167 @@
+package zecutil
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestCheckTransaction(t *testing.T) {
+	coinbase, err := ZecTxFromHex(genesisCoinbase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckTransaction(coinbase, SproutBranchID); err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckTransaction(newTestTxV5(t, 1, 2, 2), NU6BranchID); err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckTransaction(newTestTx(t, versionSapling, 2, 1, 0), CanopyBranchID); err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckTransaction(newTestTx(t, versionSapling, 0, 1, 0), NU6BranchID); err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckTransaction(newTestTxV5(t, 1, 2, 2), 0x12345678); err == nil || errors.As(err, new(*ConsensusError)) {
+		t.Fatalf("got %v, want an unknown branch ID error", err)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name     string
+		version  int32
+		branchID uint32
+		modify   func(tx *MsgTx)
+		reason   string
+	}{
+		{"v5 before NU5", versionNU5, CanopyBranchID, nil, "bad-tx-version-group-id"},
+		{"v3 after Sapling", versionOverwinter, NU6BranchID, nil, "bad-tx-version-group-id"},
+		{"v4 under Overwinter", versionSapling, OverwinterBranchID, nil, "bad-tx-version-group-id"},
+		{"v2 after Overwinter", 2, SaplingBranchID, nil, "tx-overwinter-active"},
+		{"v4 before Overwinter", versionSapling, SproutBranchID, nil, "tx-overwinter-not-active"},
+		{"v0", 0, SproutBranchID, nil, "bad-txns-version-too-low"},
+		{"branch ID mismatch", versionNU5, NU5BranchID, nil, "bad-tx-consensus-branch-id-mismatch"},
+		{"expiry height", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.ExpiryHeight = txExpiryHeightThreshold
+		}, "bad-tx-expiry-height-too-high"},
+		{"v5 JoinSplits", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.JoinSplits = []*JoinSplitDescription{newTestJoinSplit(rnd, 192)}
+		}, "bad-tx-has-joinsplits"},
+		{"v3 Sapling spends", versionOverwinter, OverwinterBranchID, func(tx *MsgTx) {
+			tx.ShieldedSpends = []*SpendDescription{{}}
+		}, "bad-tx-has-sapling"},
+		{"v4 Orchard actions", versionSapling, NU6BranchID, func(tx *MsgTx) {
+			tx.Orchard = newTestTxV5(t, 0, 0, 1).Orchard
+		}, "bad-tx-has-orchard"},
+		{"no inputs", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.TxIn, tx.ShieldedSpends = nil, nil
+			tx.Orchard.Flags = OrchardFlagOutputsEnabled
+		}, "bad-txns-vin-empty"},
+		{"no outputs", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.TxOut, tx.ShieldedOutputs = nil, nil
+			tx.Orchard = nil
+		}, "bad-txns-vout-empty"},
+		{"no outputs with Orchard spends", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.TxOut, tx.ShieldedOutputs = nil, nil
+			tx.Orchard.Flags = OrchardFlagSpendsEnabled
+		}, "bad-txns-vout-empty"},
+		{"oversize", 2, SproutBranchID, func(tx *MsgTx) {
+			tx.ExpiryHeight = 0
+			tx.TxOut[0].PkScript = make([]byte, maxTxSizeBeforeSapling)
+		}, "bad-txns-oversize"},
+		{"negative output", versionNU5, NU6BranchID, func(tx *MsgTx) { tx.TxOut[0].Value = -1 }, "bad-txns-vout-negative"},
+		{"large output", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.TxOut[0].Value = MaxMoney + 1
+		}, "bad-txns-vout-toolarge"},
+		{"large outputs total", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.TxOut[0].Value = MaxMoney
+			tx.AddTxOut(wire.NewTxOut(1, nil))
+		}, "bad-txns-txouttotal-toolarge"},
+		{"value balance without Sapling", versionSapling, NU6BranchID, func(tx *MsgTx) {
+			tx.ShieldedSpends, tx.ShieldedOutputs = nil, nil
+		}, "bad-txns-valuebalance-nonzero"},
+		{"large value balance", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.ValueBalance = -MaxMoney - 1
+		}, "bad-txns-valuebalance-toolarge"},
+		{"large Orchard value balance", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.Orchard.ValueBalance = MaxMoney + 1
+		}, "bad-txns-valuebalance-toolarge"},
+		{"large shielded outputs total", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.ValueBalance = -MaxMoney
+		}, "bad-txns-txouttotal-toolarge"},
+		{"large inputs total", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.ValueBalance, tx.Orchard.ValueBalance = MaxMoney, 1
+		}, "bad-txns-txintotal-toolarge"},
+		{"large vpub_old", versionSapling, NU6BranchID, func(tx *MsgTx) {
+			tx.JoinSplits = []*JoinSplitDescription{newTestJoinSplit(rnd, 192)}
+			tx.JoinSplits[0].VPubOld = MaxMoney + 1
+		}, "bad-txns-vpub_old-toolarge"},
+		{"both vpubs", versionSapling, NU6BranchID, func(tx *MsgTx) {
+			tx.JoinSplits = []*JoinSplitDescription{newTestJoinSplit(rnd, 192)}
+			tx.JoinSplits[0].VPubNew = 1
+		}, "bad-txns-vpubs-both-nonzero"},
+		{"duplicate inputs", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.AddTxIn(wire.NewTxIn(&tx.TxIn[0].PreviousOutPoint, nil, nil))
+		}, "bad-txns-inputs-duplicate"},
+		{"duplicate JoinSplit nullifiers", versionSapling, NU6BranchID, func(tx *MsgTx) {
+			tx.JoinSplits = []*JoinSplitDescription{newTestJoinSplit(rnd, 192), newTestJoinSplit(rnd, 192)}
+			tx.JoinSplits[1].Nullifiers[1] = tx.JoinSplits[0].Nullifiers[0]
+		}, "bad-joinsplits-nullifiers-duplicate"},
+		{"duplicate Sapling nullifiers", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.ShieldedSpends[1].Nullifier = tx.ShieldedSpends[0].Nullifier
+		}, "bad-spend-description-nullifiers-duplicate"},
+		{"duplicate Orchard nullifiers", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.Orchard.Actions[1].Nullifier = tx.Orchard.Actions[0].Nullifier
+		}, "bad-orchard-nullifiers-duplicate"},
+		{"short coinbase script", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.TxIn[0] = wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), []byte{0x51}, nil)
+			tx.ShieldedSpends = nil
+		}, "bad-cb-length"},
+		{"long coinbase script", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.TxIn[0] = wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), make([]byte, 101), nil)
+			tx.ShieldedSpends = nil
+		}, "bad-cb-length"},
+		{"coinbase Sapling spends", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.TxIn[0] = wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), make([]byte, 2), nil)
+		}, "bad-cb-has-spend-description"},
+		{"coinbase Orchard spends", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.TxIn[0] = wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), make([]byte, 2), nil)
+			tx.ShieldedSpends = nil
+		}, "bad-cb-has-orchard-spend"},
+		{"null prevout", versionNU5, NU6BranchID, func(tx *MsgTx) {
+			tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), nil, nil))
+		}, "bad-txns-prevout-null"},
+	}
+	for _, test := range tests {
+		var tx *MsgTx
+		switch test.version {
+		case versionNU5:
+			tx = newTestTxV5(t, 2, 1, 2)
+		case versionSapling:
+			tx = newTestTx(t, versionSapling, 2, 1, 0)
+		default:
+			tx = newTestTx(t, test.version, 0, 0, 0)
+		}
+		if test.modify != nil {
+			test.modify(tx)
+		}
+
+		err := CheckTransaction(tx, test.branchID)
+		var consensusErr *ConsensusError
+		if !errors.As(err, &consensusErr) || consensusErr.Reason != test.reason {
+			t.Fatalf("%s: got %v, want %s", test.name, err, test.reason)
+		}
+	}
+
+	// A coinbase may create Orchard notes.
+	tx := newTestTxV5(t, 0, 1, 1)
+	tx.TxIn[0] = wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), make([]byte, 2), nil)
+	tx.Orchard.Flags = OrchardFlagOutputsEnabled
+	if err = CheckTransaction(tx, NU6BranchID); err != nil {
+		t.Fatal(err)
+	}
+}
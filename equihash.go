@@ -0,0 +1,223 @@
+package zecutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/dchest/blake2b"
+)
+
+// equihashPersonalization prefixes the BLAKE2b personalization of the
+// Equihash hash function, followed by n and k.
+const equihashPersonalization = "ZcashPoW"
+
+var (
+	// ErrInvalidSolution is returned for headers whose Equihash solution is
+	// not valid.
+	ErrInvalidSolution = errors.New("invalid equihash solution")
+
+	// ErrHighHash is returned for headers whose hash is above the target of
+	// their nBits.
+	ErrHighHash = errors.New("block hash is above the target")
+)
+
+// CheckBlockHeader checks the proof of work of a header offline: its
+// Equihash solution for the parameters of the network and its hash against
+// the target encoded by its nBits.
+func CheckBlockHeader(h *BlockHeader, params *Params) error {
+	if err := CheckEquihashSolution(h, params.EquihashN, params.EquihashK); err != nil {
+		return err
+	}
+	return CheckProofOfWork(h, params.PowLimit)
+}
+
+// CheckEquihashSolution checks that the solution of the header is a valid
+// Equihash solution with parameters n and k, such as (200, 9) on mainnet and
+// testnet or (144, 5), for the header fields preceding it.
+// https://zips.z.cash/protocol/protocol.pdf#equihash
+func CheckEquihashSolution(h *BlockHeader, n, k uint32) error {
+	if n%8 != 0 || n > 512 || k < 1 || k >= 32 || n%(k+1) != 0 || n/(k+1)+1 > 32 {
+		return fmt.Errorf("unsupported equihash parameters (%d, %d)", n, k)
+	}
+	collisionBits := n / (k + 1)
+
+	indices, err := unpackSolution(h.Solution, n, k)
+	if err != nil {
+		return err
+	}
+
+	// Distinct indices.
+	sorted := append([]uint32(nil), indices...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			return fmt.Errorf("%w: duplicate index %d", ErrInvalidSolution, sorted[i])
+		}
+	}
+
+	var input bytes.Buffer
+	if err = h.writePowInput(&input); err != nil {
+		return err
+	}
+	gen := newEquihashGenerator(input.Bytes(), n, k)
+
+	// rows[i] is the xor of the hashes of the subtree starting at
+	// indices[i*width], width doubling at each level.
+	rows := make([][]byte, len(indices))
+	for i, idx := range indices {
+		if rows[i], err = gen.hash(idx); err != nil {
+			return err
+		}
+	}
+
+	for level, width := uint32(1), 1; level <= k; level, width = level+1, width*2 {
+		next := make([][]byte, len(rows)/2)
+		for i := range next {
+			left, right := rows[2*i], rows[2*i+1]
+			if indices[2*i*width] >= indices[(2*i+1)*width] {
+				return fmt.Errorf("%w: indices out of order at level %d", ErrInvalidSolution, level)
+			}
+
+			next[i] = append([]byte(nil), left...)
+			xorBytes(next[i], right)
+
+			bits := level * collisionBits
+			if level == k {
+				bits = n
+			}
+			if !hasZeroPrefix(next[i], bits) {
+				return fmt.Errorf("%w: no collision at level %d", ErrInvalidSolution, level)
+			}
+		}
+		rows = next
+	}
+
+	return nil
+}
+
+// CheckProofOfWork checks that the hash of the header is at most the target
+// encoded by its nBits, which must not exceed powLimit.
+func CheckProofOfWork(h *BlockHeader, powLimit *big.Int) error {
+	target, err := compactToTarget(h.Bits)
+	if err != nil {
+		return err
+	}
+	if target.Cmp(powLimit) > 0 {
+		return fmt.Errorf("target %064x is above the proof of work limit", target)
+	}
+
+	hash := h.BlockHash()
+	if hashToBig(&hash).Cmp(target) > 0 {
+		return fmt.Errorf("%w: %s > %064x", ErrHighHash, hash, target)
+	}
+	return nil
+}
+
+// equihashGenerator computes the n-bit hashes X_i of an Equihash instance.
+type equihashGenerator struct {
+	input          []byte
+	n              uint32
+	person         []byte
+	indicesPerHash uint32
+}
+
+// newEquihashGenerator returns the generator of the hashes of the given
+// header input.
+func newEquihashGenerator(input []byte, n, k uint32) *equihashGenerator {
+	person := make([]byte, 0, 16)
+	person = append(person, equihashPersonalization...)
+	person = binary.LittleEndian.AppendUint32(person, n)
+	person = binary.LittleEndian.AppendUint32(person, k)
+
+	return &equihashGenerator{input: input, n: n, person: person, indicesPerHash: 512 / n}
+}
+
+// hash returns X_idx, the n/8 bytes at position idx mod 512/n of the BLAKE2b
+// hash of the input and the little endian idx / (512/n).
+func (g *equihashGenerator) hash(idx uint32) ([]byte, error) {
+	size := g.indicesPerHash * g.n / 8
+	h, err := blake2b.New(&blake2b.Config{Size: uint8(size), Person: g.person})
+	if err != nil {
+		return nil, err
+	}
+	h.Write(g.input)
+	h.Write(binary.LittleEndian.AppendUint32(nil, idx/g.indicesPerHash))
+
+	start := (idx % g.indicesPerHash) * g.n / 8
+	return h.Sum(nil)[start : start+g.n/8], nil
+}
+
+// unpackSolution returns the 2^k indices of a solution, packed as big endian
+// integers of n/(k+1)+1 bits.
+func unpackSolution(solution []byte, n, k uint32) ([]uint32, error) {
+	indexBits := n/(k+1) + 1
+	count := uint32(1) << k
+	if uint32(len(solution))*8 != count*indexBits {
+		return nil, fmt.Errorf("%w: got %d bytes, want %d", ErrInvalidSolution, len(solution), count*indexBits/8)
+	}
+
+	indices := make([]uint32, count)
+	var acc uint64
+	var accBits uint32
+	i := 0
+	for _, b := range solution {
+		acc = acc<<8 | uint64(b)
+		accBits += 8
+		if accBits >= indexBits {
+			accBits -= indexBits
+			indices[i] = uint32(acc >> accBits)
+			acc &= 1<<accBits - 1
+			i++
+		}
+	}
+	return indices, nil
+}
+
+// hasZeroPrefix reports whether the first bits bits of b are zero.
+func hasZeroPrefix(b []byte, bits uint32) bool {
+	for i := uint32(0); i < bits/8; i++ {
+		if b[i] != 0 {
+			return false
+		}
+	}
+	if rem := bits % 8; rem != 0 {
+		return b[bits/8]>>(8-rem) == 0
+	}
+	return true
+}
+
+// compactToTarget decodes the target of nBits, rejecting negative, zero and
+// overflowing targets as zcashd does.
+func compactToTarget(bits uint32) (*big.Int, error) {
+	mantissa := bits & 0x007fffff
+	exponent := bits >> 24
+
+	var target *big.Int
+	if exponent <= 3 {
+		target = big.NewInt(int64(mantissa >> (8 * (3 - exponent))))
+	} else {
+		target = new(big.Int).Lsh(big.NewInt(int64(mantissa)), uint(8*(exponent-3)))
+	}
+
+	switch {
+	case mantissa != 0 && bits&0x00800000 != 0:
+		return nil, fmt.Errorf("negative target in nBits %08x", bits)
+	case mantissa != 0 && (exponent > 34 || (mantissa > 0xff && exponent > 33) || (mantissa > 0xffff && exponent > 32)):
+		return nil, fmt.Errorf("overflowing target in nBits %08x", bits)
+	case target.Sign() == 0:
+		return nil, fmt.Errorf("zero target in nBits %08x", bits)
+	}
+	return target, nil
+}
+
+// hashToBig interprets a hash, stored little endian, as a number.
+func hashToBig(hash *chainhash.Hash) *big.Int {
+	b := append([]byte(nil), hash[:]...)
+	reverseBytes(b)
+	return new(big.Int).SetBytes(b)
+}
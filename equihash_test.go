@@ -0,0 +1,281 @@
+package zecutil
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// equihashRow is a partial solution of solveEquihash: the xor of the hashes
+// of its indices.
+type equihashRow struct {
+	hash    []byte
+	indices []uint32
+}
+
+// solveEquihash returns the solutions of the header with Wagner's algorithm.
+// It is only practical for the small parameters of regtest.
+func solveEquihash(t *testing.T, h *BlockHeader, n, k uint32) [][]byte {
+	var input bytes.Buffer
+	if err := h.writePowInput(&input); err != nil {
+		t.Fatal(err)
+	}
+	gen := newEquihashGenerator(input.Bytes(), n, k)
+	collisionBits := n / (k + 1)
+
+	rows := make([]equihashRow, 1<<(collisionBits+1))
+	for i := range rows {
+		hash, err := gen.hash(uint32(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows[i] = equihashRow{hash: hash, indices: []uint32{uint32(i)}}
+	}
+
+	for level := uint32(1); level <= k; level++ {
+		bits := level * collisionBits
+		if level == k {
+			bits = n
+		}
+		buckets := make(map[string][]equihashRow)
+		for _, row := range rows {
+			key := prefixBits(row.hash, bits)
+			buckets[key] = append(buckets[key], row)
+		}
+
+		var next []equihashRow
+		for _, bucket := range buckets {
+			for i := range bucket {
+				for j := i + 1; j < len(bucket); j++ {
+					left, right := bucket[i], bucket[j]
+					if !disjoint(left.indices, right.indices) {
+						continue
+					}
+					if left.indices[0] > right.indices[0] {
+						left, right = right, left
+					}
+					hash := append([]byte(nil), left.hash...)
+					xorBytes(hash, right.hash)
+					indices := append(append([]uint32(nil), left.indices...), right.indices...)
+					next = append(next, equihashRow{hash: hash, indices: indices})
+				}
+			}
+		}
+		rows = next
+	}
+
+	solutions := make([][]byte, len(rows))
+	for i, row := range rows {
+		solutions[i] = packSolution(row.indices, collisionBits+1)
+	}
+	return solutions
+}
+
+// prefixBits returns the first bits bits of b as a map key.
+func prefixBits(b []byte, bits uint32) string {
+	key := append([]byte(nil), b[:(bits+7)/8]...)
+	if rem := bits % 8; rem != 0 {
+		key[len(key)-1] >>= 8 - rem
+	}
+	return string(key)
+}
+
+func disjoint(a, b []uint32) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// packSolution packs indices as big endian integers of indexBits bits.
+func packSolution(indices []uint32, indexBits uint32) []byte {
+	var solution []byte
+	var acc uint64
+	var accBits uint32
+	for _, idx := range indices {
+		acc = acc<<indexBits | uint64(idx)
+		accBits += indexBits
+		for accBits >= 8 {
+			accBits -= 8
+			solution = append(solution, byte(acc>>accBits))
+		}
+	}
+	return solution
+}
+
+func TestCheckBlockHeader(t *testing.T) {
+	params := &RegTestParams
+	h := &BlockHeader{
+		Version:   4,
+		Timestamp: time.Unix(1700000000, 0),
+		Bits:      params.PowLimitBits,
+	}
+
+	// Mine a header satisfying both the Equihash solution and the target.
+	var solutions [][]byte
+	found := false
+	for nonce := 0; nonce < 1000 && !found; nonce++ {
+		h.Nonce[0], h.Nonce[1] = byte(nonce), byte(nonce>>8)
+		solutions = solveEquihash(t, h, params.EquihashN, params.EquihashK)
+		for _, solution := range solutions {
+			h.Solution = solution
+			if CheckProofOfWork(h, params.PowLimit) == nil {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		t.Fatal("no block found")
+	}
+	if len(h.Solution) != 36 {
+		t.Fatalf("solution size = %d, want 36", len(h.Solution))
+	}
+	if err := CheckBlockHeader(h, params); err != nil {
+		t.Fatal(err)
+	}
+	for _, solution := range solutions {
+		if err := CheckEquihashSolution(&BlockHeader{
+			Version: h.Version, Timestamp: h.Timestamp, Bits: h.Bits, Nonce: h.Nonce, Solution: solution,
+		}, params.EquihashN, params.EquihashK); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	indices, err := unpackSolution(h.Solution, params.EquihashN, params.EquihashK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packSolution(indices, 9), h.Solution) {
+		t.Fatal("solution does not round-trip")
+	}
+	tamper := func(f func([]uint32)) []byte {
+		tampered := append([]uint32(nil), indices...)
+		f(tampered)
+		return packSolution(tampered, 9)
+	}
+
+	tests := []struct {
+		name     string
+		solution []byte
+	}{
+		{"swapped leaves", tamper(func(s []uint32) { s[0], s[1] = s[1], s[0] })},
+		{"swapped subtrees", tamper(func(s []uint32) {
+			copy(s, append(append([]uint32(nil), s[16:]...), s[:16]...))
+		})},
+		{"duplicate index", tamper(func(s []uint32) { s[1] = s[0] })},
+		{"other index", tamper(func(s []uint32) { s[31] ^= 1 })},
+		{"short", h.Solution[:35]},
+		{"long", append(append([]byte(nil), h.Solution...), 0)},
+		{"empty", nil},
+	}
+	for _, test := range tests {
+		tampered := *h
+		tampered.Solution = test.solution
+		if err = CheckBlockHeader(&tampered, params); !errors.Is(err, ErrInvalidSolution) {
+			t.Fatalf("%s: got %v, want ErrInvalidSolution", test.name, err)
+		}
+	}
+
+	tampered := *h
+	tampered.Nonce[31] ^= 1
+	if err = CheckEquihashSolution(&tampered, params.EquihashN, params.EquihashK); !errors.Is(err, ErrInvalidSolution) {
+		t.Fatalf("changed nonce: got %v, want ErrInvalidSolution", err)
+	}
+	if err = CheckEquihashSolution(h, 200, 9); !errors.Is(err, ErrInvalidSolution) {
+		t.Fatalf("other parameters: got %v, want ErrInvalidSolution", err)
+	}
+	if err = CheckEquihashSolution(h, 50, 5); err == nil {
+		t.Fatal("expected error for unsupported parameters")
+	}
+	// 2^k indices don't fit in 32 bits.
+	tampered = *h
+	tampered.Solution = nil
+	if err = CheckEquihashSolution(&tampered, 264, 32); err == nil || errors.Is(err, ErrInvalidSolution) {
+		t.Fatalf("k = 32: got %v, want unsupported parameters", err)
+	}
+
+	// A target below the hash, and one above the limit.
+	tampered = *h
+	tampered.Bits = 0x03000001
+	if err = CheckProofOfWork(&tampered, params.PowLimit); !errors.Is(err, ErrHighHash) {
+		t.Fatalf("got %v, want ErrHighHash", err)
+	}
+	if err = CheckProofOfWork(h, MainNetParams.PowLimit); err == nil || errors.Is(err, ErrHighHash) {
+		t.Fatalf("got %v, want a target above the limit", err)
+	}
+}
+
+// testnetGenesisSolution is the Equihash solution of the testnet genesis
+// block.
+const testnetGenesisSolution = "00a6a51259c3f6732481e2d035197218b7a69504461d04335503cd69759b2d02bd2b53a9653f42cb33c608511c953673fa9da76170958115fe92157ad3bb5720d927f18e09459bf5c6072973e143e20f9bdf0584058c96b7c2234c7565f100d5eea083ba5d3dbaff9f0681799a113e7beff4a611d2b49590563109962baa149b628aae869af791f2f70bb041bd7ebfa658570917f6654a142b05e7ec0289a4f46470be7be5f693b90173eaaa6e84907170f32602204f1f4e1c04b1830116ffd0c54f0b1caa9a5698357bd8aa1f5ac8fc93b405265d824ba0e49f69dab5446653927298e6b7bdc61ee86ff31c07bde86331b4e500d42e4e50417e285502684b7966184505b885b42819a88469d1e9cf55072d7f3510f85580db689302eab377e4e11b14a91fdd0df7627efc048934f0aff8e7eb77eb17b3a95de13678004f2512293891d8baf8dde0ef69be520a58bbd6038ce899c9594cf3e30b8c3d9c7ecc832d4c19a6212747b50724e6f70f6451f78fd27b58ce43ca33b1641304a916186cfbe7dbca224f55d08530ba851e4df22baf7ab7078e9cbea46c0798b35a750f54103b0cdd08c81a6505c4932f6bfbd492a9fced31d54e98b6370d4c96600552fcf5b37780ed18c8787d03200963600db297a8f05dfa551321d17b9917edadcda51e274830749d133ad226f8bb6b94f13b4f77e67b35b71f52112ce9ba5da706ad9573584a2570a4ff25d29ab9761a06bdcf2c33638bf9baf2054825037881c14adf3816ba0cbd0fca689aad3ce16f2fe362c98f48134a9221765d939f0b49677d1c2447e56b46859f1810e2cf23e82a53e0d44f34dae932581b3b7f49eaec59af872cf9de757a964f7b33d143a36c270189508fcafe19398e4d2966948164d40556b05b7ff532f66f5d1edc41334ef742f78221dfe0c7ae2275bb3f24c89ae35f00afeea4e6ed187b866b209dc6e83b660593fce7c40e143beb07ac86c56f39e895385924667efe3a3f031938753c7764a2dbeb0a643fd359c46e614873fd0424e435fa7fac083b9a41a9d6bf7e284eee537ea7c50dd239f359941a43dc982745184bf3ee31a8dc850316aa9c6b66d6985acee814373be3458550659e1a06287c3b3b76a185c5cb93e38c1eebcf34ff072894b6430aed8d34122dafd925c46a515cca79b0269c92b301890ca6b0dc8b679cdac0f23318c105de73d7a46d16d2dad988d49c22e9963c117960bdc70ef0db6b091cf09445a516176b7f6d58ec29539166cc8a38bbff387acefffab2ea5faad0e8bb70625716ef0edf61940733c25993ea3de9f0be23d36e7cb8da10505f9dc426cd0e6e5b173ab4fff8c37e1f1fb56d1ea372013d075e0934c6919393cfc21395eea20718fad03542a4162a9ded66c814ad8320b2d7c2da3ecaf206da34c502db2096d1c46699a91dd1c432f019ad434e2c1ce507f91104f66f491fed37b225b8e0b2888c37276cfa0468fc13b8d593fd9a2675f0f5b20b8a15f8fa7558176a530d6865738ddb25d3426dab905221681cf9da0e0200eea5b2eba3ad3a5237d2a391f9074bf1779a2005cee43eec2b058511532635e0fea61664f531ac2b356f40db5c5d275a4cf5c82d468976455af4e3362cc8f71aa95e71d394aff3ead6f7101279f95bcd8a0fedce1d21cb3c9f6dd3b182fce0db5d6712981b651f29178a24119968b14783cafa713bc5f2a65205a42e4ce9dc7ba462bdb1f3e4553afc15f5f39998fdb53e7e231e3e520a46943734a007c2daa1eda9f495791657eefcac5c32833936e568d06187857ed04d7b97167ae207c5c5ae54e528c36016a984235e9c5b2f0718d7b3aa93c7822ccc772580b6599671b3c02ece8a21399abd33cfd3028790133167d0a97e7de53dc8ff"
+
+func TestCheckGenesisHeaders(t *testing.T) {
+	mainnet, err := ZecBlockFromHex(genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The genesis blocks of every network share their coinbase.
+	header := func(timestamp int64, bits uint32, nonce byte, solution string) *BlockHeader {
+		h := mainnet.Header
+		h.Timestamp, h.Bits, h.Nonce = time.Unix(timestamp, 0), bits, [32]byte{nonce}
+		h.Solution = mustDecodeHex(t, solution)
+		return &h
+	}
+
+	tests := []struct {
+		params *Params
+		header *BlockHeader
+	}{
+		{&MainNetParams, &mainnet.Header},
+		{&TestNet3Params, header(1477648033, 0x2007ffff, 6, testnetGenesisSolution)},
+		{&RegTestParams, header(1296688602, 0x200f0f0f, 9, "01936b7db1eb4ac39f151b8704642d0a8bda13ec547d54cd5e43ba142fc6d8877cab07b3")},
+	}
+	for _, test := range tests {
+		h := test.header
+		if h.BlockHash() != *test.params.GenesisHash {
+			t.Fatalf("%s: block hash = %s, want %s", test.params.Name, h.BlockHash(), test.params.GenesisHash)
+		}
+		if err = CheckBlockHeader(h, test.params); err != nil {
+			t.Fatalf("%s: %v", test.params.Name, err)
+		}
+
+		tampered := *h
+		tampered.Solution = append([]byte(nil), h.Solution...)
+		tampered.Solution[len(tampered.Solution)/2] ^= 1
+		if err = CheckBlockHeader(&tampered, test.params); !errors.Is(err, ErrInvalidSolution) {
+			t.Fatalf("%s: got %v, want ErrInvalidSolution", test.params.Name, err)
+		}
+	}
+}
+
+func TestCompactToTarget(t *testing.T) {
+	// The compact form of the limits keeps their three leading bytes.
+	for _, params := range []*Params{&MainNetParams, &TestNet3Params, &RegTestParams} {
+		target, err := compactToTarget(params.PowLimitBits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shift := uint(8 * (params.PowLimitBits>>24 - 3))
+		if want := new(big.Int).Lsh(new(big.Int).Rsh(params.PowLimit, shift), shift); target.Cmp(want) != 0 {
+			t.Fatalf("%s: target %x, want %x", params.Name, target, want)
+		}
+	}
+
+	target, err := compactToTarget(0x01123456)
+	if err != nil || target.Cmp(big.NewInt(0x12)) != 0 {
+		t.Fatalf("got %v, %v, want 0x12", target, err)
+	}
+	for _, bits := range []uint32{0, 0x01003456, 0x04923456, 0x23000001, 0x22000100, 0x21010000} {
+		if _, err = compactToTarget(bits); err == nil {
+			t.Fatalf("%08x: expected error", bits)
+		}
+	}
+}
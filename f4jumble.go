@@ -0,0 +1,118 @@
+package zecutil
+
+import (
+	"fmt"
+
+	"github.com/dchest/blake2b"
+)
+
+// F4Jumble parameters of ZIP-316.
+// https://zips.z.cash/zip-0316#jumbling
+const (
+	f4HashLen = blake2b.Size
+
+	// f4MinLen and f4MaxLen bound the length of a message F4Jumble is
+	// defined for.
+	f4MinLen = 48
+	f4MaxLen = f4HashLen * (1<<16 + 1)
+)
+
+// f4Jumble applies the F4Jumble unkeyed permutation to msg, making every bit
+// of the result depend on every bit of the input.
+func f4Jumble(msg []byte) ([]byte, error) {
+	a, b, err := f4Split(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	x := append([]byte(nil), b...)
+	if err = f4G(0, a, x); err != nil {
+		return nil, err
+	}
+	y := append([]byte(nil), a...)
+	if err = f4H(0, x, y); err != nil {
+		return nil, err
+	}
+	if err = f4G(1, y, x); err != nil {
+		return nil, err
+	}
+	if err = f4H(1, x, y); err != nil {
+		return nil, err
+	}
+
+	return append(y, x...), nil
+}
+
+// f4JumbleInv is the inverse of f4Jumble.
+func f4JumbleInv(msg []byte) ([]byte, error) {
+	c, d, err := f4Split(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	y := append([]byte(nil), c...)
+	if err = f4H(1, d, y); err != nil {
+		return nil, err
+	}
+	x := append([]byte(nil), d...)
+	if err = f4G(1, y, x); err != nil {
+		return nil, err
+	}
+	if err = f4H(0, x, y); err != nil {
+		return nil, err
+	}
+	if err = f4G(0, y, x); err != nil {
+		return nil, err
+	}
+
+	return append(y, x...), nil
+}
+
+// f4Split splits msg into its left part of at most 64 bytes and its right
+// part.
+func f4Split(msg []byte) ([]byte, []byte, error) {
+	if len(msg) < f4MinLen || len(msg) > f4MaxLen {
+		return nil, nil, fmt.Errorf("f4jumble: invalid message length %d", len(msg))
+	}
+
+	l := len(msg) / 2
+	if l > f4HashLen {
+		l = f4HashLen
+	}
+	return msg[:l], msg[l:], nil
+}
+
+// f4H xors dst with the round i output of the H function over u. dst is the
+// left part of the message, so the output is never longer than one hash.
+func f4H(i byte, u, dst []byte) error {
+	person := append([]byte("UA_F4Jumble_H"), i, 0, 0)
+	h, err := blake2b.New(&blake2b.Config{Size: uint8(len(dst)), Person: person})
+	if err != nil {
+		return err
+	}
+	h.Write(u)
+	xorBytes(dst, h.Sum(nil))
+	return nil
+}
+
+// f4G xors dst with the round i output of the G function over u, made of as
+// many 64-byte hashes as needed to cover the right part of the message.
+func f4G(i byte, u, dst []byte) error {
+	for j := 0; j*f4HashLen < len(dst); j++ {
+		person := append([]byte("UA_F4Jumble_G"), i, byte(j), byte(j>>8))
+		h, err := blake2b.New(&blake2b.Config{Size: f4HashLen, Person: person})
+		if err != nil {
+			return err
+		}
+		h.Write(u)
+		xorBytes(dst[j*f4HashLen:], h.Sum(nil))
+	}
+	return nil
+}
+
+// xorBytes xors dst with src over the length of the shorter of the two.
+func xorBytes(dst, src []byte) {
+	for i := 0; i < len(dst) && i < len(src); i++ {
+		dst[i] ^= src[i]
+	}
+}
@@ -0,0 +1,98 @@
+package zecutil
+
+import (
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ZIP-317 conventional fee parameters.
+// https://zips.z.cash/zip-0317
+const (
+	// MarginalFee is the fee charged per logical action, in zatoshi.
+	MarginalFee = 5000
+
+	// GraceActions is the number of logical actions every transaction is
+	// charged for at least.
+	GraceActions = 2
+
+	// P2PKHStandardInputSize is the transparent input size counted as a
+	// single logical action.
+	P2PKHStandardInputSize = 150
+
+	// P2PKHStandardOutputSize is the transparent output size counted as a
+	// single logical action.
+	P2PKHStandardOutputSize = 34
+)
+
+// oneThirdDustThresholdRate is ONE_THIRD_DUST_THRESHOLD_RATE of zcashd, in
+// zatoshi per 1000 bytes.
+const oneThirdDustThresholdRate = 100
+
+// LogicalActions returns the number of ZIP-317 logical actions of the
+// transaction. Transparent inputs are measured as serialized, so the count is
+// only final once the inputs are signed.
+func LogicalActions(tx *MsgTx) int {
+	var inSize, outSize int
+	for _, in := range tx.TxIn {
+		inSize += txInSerializeSize(in)
+	}
+	for _, out := range tx.TxOut {
+		outSize += out.SerializeSize()
+	}
+
+	transparent := ceilDiv(inSize, P2PKHStandardInputSize)
+	if o := ceilDiv(outSize, P2PKHStandardOutputSize); o > transparent {
+		transparent = o
+	}
+
+	sapling := len(tx.ShieldedSpends)
+	if len(tx.ShieldedOutputs) > sapling {
+		sapling = len(tx.ShieldedOutputs)
+	}
+
+	var orchard int
+	if tx.hasOrchard() {
+		orchard = len(tx.Orchard.Actions)
+	}
+
+	return transparent + 2*len(tx.JoinSplits) + sapling + orchard
+}
+
+// ConventionalFee returns the ZIP-317 conventional fee of the transaction in
+// zatoshi.
+func ConventionalFee(tx *MsgTx) int64 {
+	actions := LogicalActions(tx)
+	if actions < GraceActions {
+		actions = GraceActions
+	}
+	return int64(MarginalFee * actions)
+}
+
+// DustThreshold returns the smallest value of the output that zcashd does not
+// consider dust, that is three times the fee at the dust relay rate of the
+// output and of the input that would later spend it.
+func DustThreshold(out *wire.TxOut) int64 {
+	// A P2PKH input spending the output is assumed to be 148 bytes.
+	size := int64(out.SerializeSize() + 148)
+	fee := oneThirdDustThresholdRate * size / 1000
+	if fee == 0 {
+		fee = 1
+	}
+	return 3 * fee
+}
+
+// IsDust reports whether the value of the output is below its dust
+// threshold.
+func IsDust(out *wire.TxOut) bool {
+	return out.Value < DustThreshold(out)
+}
+
+// txInSerializeSize returns the serialized size of a transparent input.
+func txInSerializeSize(in *wire.TxIn) int {
+	// Outpoint hash and index, the script length, the script and the
+	// sequence number.
+	return 32 + 4 + wire.VarIntSerializeSize(uint64(len(in.SignatureScript))) + len(in.SignatureScript) + 4
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
@@ -3,34 +3,87 @@ package zecutil
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
+
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 )
 
 const (
-	prevoutsHashPersonalization = "ZcashPrevoutHash"
-	sequenceHashPersonalization = "ZcashSequencHash"
-	outputsHashPersonalization  = "ZcashOutputsHash"
+	prevoutsHashPersonalization        = "ZcashPrevoutHash"
+	sequenceHashPersonalization        = "ZcashSequencHash"
+	outputsHashPersonalization         = "ZcashOutputsHash"
+	joinSplitsHashPersonalization      = "ZcashJSplitsHash"
+	shieldedSpendsHashPersonalization  = "ZcashSSpendsHash"
+	shieldedOutputsHashPersonalization = "ZcashSOutputHash"
 )
 
 // TxSigHashes houses the partial set of sighashes introduced within BIP0143.
 // This partial set of sighashes may be re-used within each input across a
 // transaction when validating all inputs. As a result, validation complexity
 // for SigHashAll can be reduced by a polynomial factor.
+//
+// For v5 transactions the fields hold the ZIP-244 digests instead, which
+// additionally commit to the header, the shielded bundles and the amounts
+// and scripts of every spent output.
 type TxSigHashes struct {
 	HashPrevOuts chainhash.Hash
 	HashSequence chainhash.Hash
 	HashOutputs  chainhash.Hash
+
+	// ZIP-143/243 digest of the Sprout JoinSplits, zero when there are none.
+	HashJoinSplits chainhash.Hash
+
+	// ZIP-243 digests of the Sapling descriptions, zero when there are none.
+	HashShieldedSpends  chainhash.Hash
+	HashShieldedOutputs chainhash.Hash
+
+	// BranchID is the consensus branch ID the signature digest commits to.
+	BranchID uint32
+
+	HashHeader        chainhash.Hash
+	HashAmounts       chainhash.Hash
+	HashScriptPubKeys chainhash.Hash
+	HashSapling       chainhash.Hash
+	HashOrchard       chainhash.Hash
+
+	hasPrevOuts bool
 }
 
 // NewTxSigHashes computes, and returns the cached sighashes of the given
-// transaction.
+// transaction. v5 transactions commit to all spent outputs and must use
+// NewTxSigHashesV5 instead.
+//
+// As in earlier releases, transactions expiring before height 207500 or
+// without an expiry height commit to the zero branch ID, which zcashd never
+// accepts.
+//
+// Deprecated: the consensus branch ID is guessed from tx.ExpiryHeight. Use
+// NewTxSigHashesWithBranchID.
 func NewTxSigHashes(tx *MsgTx) (h *TxSigHashes, err error) {
-	h = &TxSigHashes{}
+	return newTxSigHashes(tx, BranchIDForHeight(legacyUpgrades, tx.ExpiryHeight))
+}
 
-	if h.HashPrevOuts, err = calcHashPrevOuts(tx); err != nil {
-		return
+// NewTxSigHashesWithBranchID computes the ZIP-143/243 sighash midstate of a
+// v3 or v4 transaction that commits to the given consensus branch ID.
+func NewTxSigHashesWithBranchID(tx *MsgTx, branchID uint32) (h *TxSigHashes, err error) {
+	if branchID == SproutBranchID {
+		return nil, errors.New("transparent signature digests are undefined before Overwinter")
 	}
+	return newTxSigHashes(tx, branchID)
+}
+
+// newTxSigHashes is NewTxSigHashesWithBranchID accepting any branch ID.
+func newTxSigHashes(tx *MsgTx, branchID uint32) (h *TxSigHashes, err error) {
+	if tx.Version >= versionNU5 {
+		return nil, errors.New("v5 transactions require previous outputs, use NewTxSigHashesV5")
+	}
+	if tx.Version < versionOverwinter {
+		return nil, fmt.Errorf("signing v%d transactions is not supported", tx.Version)
+	}
+
+	h = &TxSigHashes{BranchID: branchID}
 
 	if h.HashPrevOuts, err = calcHashPrevOuts(tx); err != nil {
 		return
@@ -44,9 +97,77 @@ func NewTxSigHashes(tx *MsgTx) (h *TxSigHashes, err error) {
 		return
 	}
 
+	if len(tx.JoinSplits) > 0 {
+		if h.HashJoinSplits, err = calcHashJoinSplits(tx); err != nil {
+			return
+		}
+	}
+
+	if len(tx.ShieldedSpends) > 0 {
+		if h.HashShieldedSpends, err = calcHashShieldedSpends(tx); err != nil {
+			return
+		}
+	}
+
+	if len(tx.ShieldedOutputs) > 0 {
+		if h.HashShieldedOutputs, err = calcHashShieldedOutputs(tx); err != nil {
+			return
+		}
+	}
+
 	return
 }
 
+// NewTxSigHashesV5 computes the ZIP-244 sighash midstate of a v5
+// transaction. prevOuts holds the output spent by each input, in input order.
+func NewTxSigHashesV5(tx *MsgTx, prevOuts []*wire.TxOut) (h *TxSigHashes, err error) {
+	if tx.Version != versionNU5 {
+		return nil, fmt.Errorf("NewTxSigHashesV5: unexpected tx version %d", tx.Version)
+	}
+	if len(prevOuts) != len(tx.TxIn) {
+		return nil, fmt.Errorf("NewTxSigHashesV5: %d previous outputs for %d inputs", len(prevOuts), len(tx.TxIn))
+	}
+
+	if h, err = v5TxDigests(tx); err != nil {
+		return nil, err
+	}
+	h.BranchID = tx.ConsensusBranchID
+
+	var amounts, scripts bytes.Buffer
+	for _, out := range prevOuts {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(out.Value))
+		amounts.Write(buf[:])
+		if err = WriteVarBytes(&scripts, 0, out.PkScript); err != nil {
+			return nil, err
+		}
+	}
+
+	if h.HashAmounts, err = blake2bHash(amounts.Bytes(), []byte(amountsHashPersonalization)); err != nil {
+		return nil, err
+	}
+	if h.HashScriptPubKeys, err = blake2bHash(scripts.Bytes(), []byte(scriptsHashPersonalization)); err != nil {
+		return nil, err
+	}
+	h.hasPrevOuts = true
+
+	return h, nil
+}
+
+// newTxSigHashesForBranch computes the sighash midstate of a transaction of
+// any signable version for the given consensus branch ID. prevOuts holds the
+// output spent by each input and is only committed to by v5 transactions,
+// whose header must carry branchID.
+func newTxSigHashesForBranch(tx *MsgTx, prevOuts []*wire.TxOut, branchID uint32) (*TxSigHashes, error) {
+	if tx.Version != versionNU5 {
+		return NewTxSigHashesWithBranchID(tx, branchID)
+	}
+	if tx.ConsensusBranchID != branchID {
+		return nil, fmt.Errorf("transaction branch id %x does not match %x", tx.ConsensusBranchID, branchID)
+	}
+	return NewTxSigHashesV5(tx, prevOuts)
+}
+
 // calcHashPrevOuts calculates a single hash of all the previous outputs
 // (txid:index) referenced within the passed transaction. This calculated hash
 // can be re-used when validating all inputs spending segwit outputs, with a
@@ -103,3 +224,41 @@ func calcHashOutputs(tx *MsgTx) (_ chainhash.Hash, err error) {
 
 	return blake2bHash(b.Bytes(), []byte(outputsHashPersonalization))
 }
+
+// calcHashJoinSplits computes the ZIP-143/243 hash of the JoinSplits of the
+// transaction and its joinSplitPubKey.
+func calcHashJoinSplits(tx *MsgTx) (chainhash.Hash, error) {
+	var b bytes.Buffer
+	for _, js := range tx.JoinSplits {
+		if err := writeJoinSplit(&b, js); err != nil {
+			return chainhash.Hash{}, err
+		}
+	}
+	b.Write(tx.JoinSplitPubKey[:])
+
+	return blake2bHash(b.Bytes(), []byte(joinSplitsHashPersonalization))
+}
+
+// calcHashShieldedSpends computes the ZIP-243 hash of the Sapling spend
+// descriptions of the transaction, excluding their spend authorization
+// signatures.
+func calcHashShieldedSpends(tx *MsgTx) (chainhash.Hash, error) {
+	var b bytes.Buffer
+	for _, sd := range tx.ShieldedSpends {
+		_ = writeBytes(&b, sd.Cv[:], sd.Anchor[:], sd.Nullifier[:], sd.Rk[:], sd.ZkProof[:])
+	}
+
+	return blake2bHash(b.Bytes(), []byte(shieldedSpendsHashPersonalization))
+}
+
+// calcHashShieldedOutputs computes the ZIP-243 hash of the Sapling output
+// descriptions of the transaction.
+func calcHashShieldedOutputs(tx *MsgTx) (chainhash.Hash, error) {
+	var b bytes.Buffer
+	for _, od := range tx.ShieldedOutputs {
+		_ = writeBytes(&b, od.Cv[:], od.Cmu[:], od.EphemeralKey[:], od.EncCiphertext[:], od.OutCiphertext[:],
+			od.ZkProof[:])
+	}
+
+	return blake2bHash(b.Bytes(), []byte(shieldedOutputsHashPersonalization))
+}
@@ -0,0 +1,200 @@
+package zecutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// HardenedKeyStart is the index of the first hardened child key.
+const HardenedKeyStart = hdkeychain.HardenedKeyStart
+
+// bip44Purpose is the BIP44 purpose level of derivation paths.
+const bip44Purpose = 44
+
+// ExtendedKey is a BIP32 extended key bound to a Zcash network. It serializes
+// with the extended key version bytes of the network and derives transparent
+// Zcash addresses.
+type ExtendedKey struct {
+	key *hdkeychain.ExtendedKey
+	net *Params
+}
+
+// NewMasterKey returns the master extended private key generated from seed.
+func NewMasterKey(seed []byte, net *Params) (*ExtendedKey, error) {
+	key, err := hdkeychain.NewMaster(seed, &net.Params)
+	if err != nil {
+		return nil, err
+	}
+	return &ExtendedKey{key: key, net: net}, nil
+}
+
+// ParseExtendedKey decodes a serialized xprv or xpub, rejecting keys with the
+// version bytes of another network.
+func ParseExtendedKey(key string, net *Params) (*ExtendedKey, error) {
+	k, err := hdkeychain.NewKeyFromString(key)
+	if err != nil {
+		return nil, err
+	}
+
+	version := net.HDPublicKeyID[:]
+	if k.IsPrivate() {
+		version = net.HDPrivateKeyID[:]
+	}
+	if !bytes.Equal(k.Version(), version) {
+		return nil, fmt.Errorf("extended key is not for %s", net.Name)
+	}
+
+	return &ExtendedKey{key: k, net: net}, nil
+}
+
+// String returns the Base58Check serialization of the key.
+func (k *ExtendedKey) String() string {
+	return k.key.String()
+}
+
+// IsPrivate reports whether the key is an extended private key.
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.key.IsPrivate()
+}
+
+// Depth returns the number of derivations from the master key.
+func (k *ExtendedKey) Depth() uint8 {
+	return k.key.Depth()
+}
+
+// Derive returns the child key at index i. Indices from HardenedKeyStart
+// derive hardened children, which requires a private key.
+func (k *ExtendedKey) Derive(i uint32) (*ExtendedKey, error) {
+	child, err := k.key.Derive(i)
+	if err != nil {
+		return nil, err
+	}
+	return &ExtendedKey{key: child, net: k.net}, nil
+}
+
+// DerivePath derives the key at the given path relative to k.
+func (k *ExtendedKey) DerivePath(path []uint32) (*ExtendedKey, error) {
+	key := k
+	for _, i := range path {
+		var err error
+		if key, err = key.Derive(i); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// DeriveAccount derives the BIP44 account key m/44'/coin_type'/account' from
+// the master key, coin_type being 133 on mainnet and 1 on the test networks.
+func (k *ExtendedKey) DeriveAccount(account uint32) (*ExtendedKey, error) {
+	if k.key.Depth() != 0 {
+		return nil, errors.New("account keys derive from the master key")
+	}
+	path, err := BIP44Path(k.net, account, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return k.DerivePath(path[:3])
+}
+
+// DeriveAddress derives the P2PKH address at change/index from a BIP44
+// account key. It works on the neutered account key, so addresses can be
+// generated from a watch-only xpub.
+func (k *ExtendedKey) DeriveAddress(change, index uint32) (*ZecAddressPubKeyHash, error) {
+	key, err := k.DerivePath([]uint32{change, index})
+	if err != nil {
+		return nil, err
+	}
+	return key.Address()
+}
+
+// Neuter returns the extended public key of k.
+func (k *ExtendedKey) Neuter() (*ExtendedKey, error) {
+	if !k.key.IsPrivate() {
+		return k, nil
+	}
+
+	pubKey, err := k.key.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var parentFP [4]byte
+	binary.BigEndian.PutUint32(parentFP[:], k.key.ParentFingerprint())
+	pub := hdkeychain.NewExtendedKey(k.net.HDPublicKeyID[:], pubKey.SerializeCompressed(), k.key.ChainCode(),
+		parentFP[:], k.key.Depth(), k.key.ChildIndex(), false)
+
+	return &ExtendedKey{key: pub, net: k.net}, nil
+}
+
+// ECPubKey returns the public key of k.
+func (k *ExtendedKey) ECPubKey() (*btcec.PublicKey, error) {
+	return k.key.ECPubKey()
+}
+
+// ECPrivKey returns the private key of k, an error is returned for extended
+// public keys.
+func (k *ExtendedKey) ECPrivKey() (*btcec.PrivateKey, error) {
+	return k.key.ECPrivKey()
+}
+
+// Address returns the P2PKH address of the compressed public key of k.
+func (k *ExtendedKey) Address() (*ZecAddressPubKeyHash, error) {
+	pubKey, err := k.key.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var hash [ripemd160.Size]byte
+	copy(hash[:], btcutil.Hash160(pubKey.SerializeCompressed()))
+	return NewAddressPubKeyHash(hash, k.net), nil
+}
+
+// BIP44Path returns the derivation path m/44'/coin_type'/account'/change/index
+// of the network. Every level must be below HardenedKeyStart.
+func BIP44Path(net *Params, account, change, index uint32) ([]uint32, error) {
+	if account >= HardenedKeyStart || change >= HardenedKeyStart || index >= HardenedKeyStart {
+		return nil, fmt.Errorf("invalid BIP44 path %d/%d/%d", account, change, index)
+	}
+	return []uint32{
+		bip44Purpose + HardenedKeyStart,
+		net.HDCoinType + HardenedKeyStart,
+		account + HardenedKeyStart,
+		change,
+		index,
+	}, nil
+}
+
+// ParseDerivationPath parses a path such as m/44'/133'/0'/0/5. Hardened
+// levels are marked with ' or h.
+func ParseDerivationPath(path string) ([]uint32, error) {
+	levels := strings.Split(path, "/")
+	if levels[0] != "m" {
+		return nil, fmt.Errorf("derivation path %q does not start with m", path)
+	}
+
+	res := make([]uint32, 0, len(levels)-1)
+	for _, level := range levels[1:] {
+		var offset uint32
+		if trimmed := strings.TrimRight(level, "'h"); len(level)-len(trimmed) == 1 {
+			level, offset = trimmed, HardenedKeyStart
+		}
+
+		i, err := strconv.ParseUint(level, 10, 32)
+		if err != nil || uint32(i) >= HardenedKeyStart {
+			return nil, fmt.Errorf("invalid derivation path level %q", level)
+		}
+		res = append(res, uint32(i)+offset)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,131 @@
+package zecutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtendedKey(t *testing.T) {
+	// BIP32 test vector 1, Zcash mainnet shares the Bitcoin version bytes.
+	const (
+		masterPriv = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+		masterPub  = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+		childPub   = "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"
+	)
+
+	master, err := NewMasterKey(mustDecodeHex(t, "000102030405060708090a0b0c0d0e0f"), &MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if master.String() != masterPriv {
+		t.Fatalf("got %s", master)
+	}
+	pub, err := master.Neuter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub.String() != masterPub || pub.IsPrivate() {
+		t.Fatalf("got %s", pub)
+	}
+	child, err := master.Derive(HardenedKeyStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if child, err = child.Neuter(); err != nil || child.String() != childPub {
+		t.Fatalf("got %s, %v", child, err)
+	}
+
+	parsed, err := ParseExtendedKey(masterPriv, &MainNetParams)
+	if err != nil || !parsed.IsPrivate() {
+		t.Fatalf("got %v, %v", parsed, err)
+	}
+	if _, err = ParseExtendedKey(masterPriv, &TestNet3Params); err == nil {
+		t.Fatal("expected error for mainnet key on testnet")
+	}
+	if _, err = pub.Derive(HardenedKeyStart); err == nil {
+		t.Fatal("expected error deriving hardened child of public key")
+	}
+}
+
+func TestDeriveAddress(t *testing.T) {
+	seed := mustDecodeHex(t, "000102030405060708090a0b0c0d0e0f")
+
+	for _, net := range []*Params{&MainNetParams, &TestNet3Params} {
+		master, err := NewMasterKey(seed, net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		account, err := master.DeriveAccount(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if account.Depth() != 3 {
+			t.Fatalf("got depth %d", account.Depth())
+		}
+
+		// Addresses derived from the watch-only xpub match the private path.
+		xpub, err := account.Neuter()
+		if err != nil {
+			t.Fatal(err)
+		}
+		watchOnly, err := ParseExtendedKey(xpub.String(), net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := watchOnly.DeriveAddress(0, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path, err := BIP44Path(net, 2, 0, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := master.DerivePath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKey, err := key.ECPubKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := Encode(pubKey.SerializeCompressed(), net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr.EncodeAddress() != want {
+			t.Fatalf("got %s, want %s", addr, want)
+		}
+		if _, err = DecodeAddress(addr.EncodeAddress(), net); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = account.DeriveAccount(0); err == nil {
+			t.Fatal("expected error deriving account from non-master key")
+		}
+		if _, err = master.DeriveAccount(HardenedKeyStart); err == nil {
+			t.Fatal("expected error deriving hardened account index")
+		}
+	}
+}
+
+func TestParseDerivationPath(t *testing.T) {
+	path, err := ParseDerivationPath("m/44'/133h/0'/1/5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := BIP44Path(&MainNetParams, 0, 1, 5); !reflect.DeepEqual(path, want) {
+		t.Fatalf("got %v, want %v", path, want)
+	}
+	if _, err = BIP44Path(&MainNetParams, 1<<31, 0, 0); err == nil {
+		t.Fatal("expected error for hardened account index")
+	}
+	if path, err = ParseDerivationPath("m"); err != nil || len(path) != 0 {
+		t.Fatalf("got %v, %v", path, err)
+	}
+
+	for _, invalid := range []string{"", "44'/0", "m/", "m/x", "m/1''", "m/2147483648"} {
+		if _, err = ParseDerivationPath(invalid); err == nil {
+			t.Fatalf("%q: expected error", invalid)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package zecutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ZIP-221 and ZIP-244 personalization strings.
+// https://zips.z.cash/zip-0221
+const (
+	historyPersonalization          = "ZcashHistory"
+	blockCommitmentsPersonalization = "ZcashBlockCommit"
+)
+
+// HistoryNode is a node of the ZIP-221 chain history tree. Leaves describe a
+// single block and are built with NewHistoryLeaf, inner nodes the blocks of
+// their subtree.
+type HistoryNode struct {
+	// SubtreeCommitment is the block hash of a leaf and the hash of the
+	// children of an inner node.
+	SubtreeCommitment chainhash.Hash
+
+	EarliestTimestamp  uint32
+	LatestTimestamp    uint32
+	EarliestTargetBits uint32
+	LatestTargetBits   uint32
+
+	// Sapling note commitment tree roots after the earliest and latest
+	// blocks.
+	EarliestSaplingRoot chainhash.Hash
+	LatestSaplingRoot   chainhash.Hash
+
+	// SubtreeTotalWork is the sum of the work of the blocks.
+	SubtreeTotalWork *big.Int
+
+	EarliestHeight uint64
+	LatestHeight   uint64
+
+	// SaplingTxCount is the number of transactions with Sapling spends or
+	// outputs.
+	SaplingTxCount uint64
+
+	// Orchard note commitment tree roots and number of transactions with
+	// Orchard actions, committed to from NU5 on only.
+	EarliestOrchardRoot chainhash.Hash
+	LatestOrchardRoot   chainhash.Hash
+	OrchardTxCount      uint64
+}
+
+// NewHistoryLeaf returns the history tree leaf of a block mined at the given
+// height. saplingRoot and orchardRoot are the roots of the note commitment
+// trees after the block, orchardRoot is ignored before NU5.
+func NewHistoryLeaf(block *MsgBlock, height uint32, saplingRoot, orchardRoot chainhash.Hash) (*HistoryNode, error) {
+	work, err := blockWork(block.Header.Bits)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf := &HistoryNode{
+		SubtreeCommitment:   block.BlockHash(),
+		EarliestTimestamp:   uint32(block.Header.Timestamp.Unix()),
+		LatestTimestamp:     uint32(block.Header.Timestamp.Unix()),
+		EarliestTargetBits:  block.Header.Bits,
+		LatestTargetBits:    block.Header.Bits,
+		EarliestSaplingRoot: saplingRoot,
+		LatestSaplingRoot:   saplingRoot,
+		SubtreeTotalWork:    work,
+		EarliestHeight:      uint64(height),
+		LatestHeight:        uint64(height),
+		EarliestOrchardRoot: orchardRoot,
+		LatestOrchardRoot:   orchardRoot,
+	}
+	for _, tx := range block.Transactions {
+		if tx.hasSapling() {
+			leaf.SaplingTxCount++
+		}
+		if tx.hasOrchard() {
+			leaf.OrchardTxCount++
+		}
+	}
+	return leaf, nil
+}
+
+// Serialize writes the node to w in the encoding of the given branch ID,
+// without the Orchard fields before NU5.
+func (n *HistoryNode) Serialize(w io.Writer, branchID uint32) error {
+	orchard, err := historyHasOrchard(branchID)
+	if err != nil {
+		return err
+	}
+	if n.SubtreeTotalWork == nil || n.SubtreeTotalWork.Sign() < 0 || n.SubtreeTotalWork.BitLen() > 256 {
+		return errors.New("subtree total work is not a 256-bit number")
+	}
+
+	if err = writeBytes(w, n.SubtreeCommitment[:]); err != nil {
+		return err
+	}
+	for _, v := range []uint32{n.EarliestTimestamp, n.LatestTimestamp, n.EarliestTargetBits, n.LatestTargetBits} {
+		if err = binarySerializer.PutUint32(w, littleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	work := n.SubtreeTotalWork.FillBytes(make([]byte, 32))
+	reverseBytes(work)
+	if err = writeBytes(w, n.EarliestSaplingRoot[:], n.LatestSaplingRoot[:], work); err != nil {
+		return err
+	}
+	for _, v := range []uint64{n.EarliestHeight, n.LatestHeight, n.SaplingTxCount} {
+		if err = WriteVarInt(w, 0, v); err != nil {
+			return err
+		}
+	}
+
+	if !orchard {
+		return nil
+	}
+	if err = writeBytes(w, n.EarliestOrchardRoot[:], n.LatestOrchardRoot[:]); err != nil {
+		return err
+	}
+	return WriteVarInt(w, 0, n.OrchardTxCount)
+}
+
+// Hash returns the BLAKE2b hash of the node personalized with the branch ID.
+func (n *HistoryNode) Hash(branchID uint32) (chainhash.Hash, error) {
+	var buf bytes.Buffer
+	if err := n.Serialize(&buf, branchID); err != nil {
+		return chainhash.Hash{}, err
+	}
+	return blake2bHash(buf.Bytes(), branchPersonalization(historyPersonalization, branchID))
+}
+
+// combineHistoryNodes returns the parent of two adjacent subtrees, left
+// covering the earlier blocks.
+func combineHistoryNodes(left, right *HistoryNode, branchID uint32) (*HistoryNode, error) {
+	var buf bytes.Buffer
+	if err := left.Serialize(&buf, branchID); err != nil {
+		return nil, err
+	}
+	if err := right.Serialize(&buf, branchID); err != nil {
+		return nil, err
+	}
+	commitment, err := blake2bHash(buf.Bytes(), branchPersonalization(historyPersonalization, branchID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &HistoryNode{
+		SubtreeCommitment:   commitment,
+		EarliestTimestamp:   left.EarliestTimestamp,
+		LatestTimestamp:     right.LatestTimestamp,
+		EarliestTargetBits:  left.EarliestTargetBits,
+		LatestTargetBits:    right.LatestTargetBits,
+		EarliestSaplingRoot: left.EarliestSaplingRoot,
+		LatestSaplingRoot:   right.LatestSaplingRoot,
+		SubtreeTotalWork:    new(big.Int).Add(left.SubtreeTotalWork, right.SubtreeTotalWork),
+		EarliestHeight:      left.EarliestHeight,
+		LatestHeight:        right.LatestHeight,
+		SaplingTxCount:      left.SaplingTxCount + right.SaplingTxCount,
+		EarliestOrchardRoot: left.EarliestOrchardRoot,
+		LatestOrchardRoot:   right.LatestOrchardRoot,
+		OrchardTxCount:      left.OrchardTxCount + right.OrchardTxCount,
+	}, nil
+}
+
+// HistoryTree is the ZIP-221 Merkle Mountain Range of the blocks of a network
+// upgrade. A new tree starts at each upgrade from Heartwood on: the history
+// root committed to by a block covers the blocks of its upgrade preceding it,
+// and is zero in the activation block.
+type HistoryTree struct {
+	branchID uint32
+	leaves   uint64
+
+	// peaks are the roots of the perfect subtrees of the range, from the
+	// tallest to the smallest, and heights their heights.
+	peaks   []*HistoryNode
+	heights []int
+}
+
+// NewHistoryTree returns an empty history tree for the network upgrade with
+// the given branch ID.
+func NewHistoryTree(branchID uint32) (*HistoryTree, error) {
+	if _, err := historyHasOrchard(branchID); err != nil {
+		return nil, err
+	}
+	return &HistoryTree{branchID: branchID}, nil
+}
+
+// Len returns the number of leaves of the tree.
+func (t *HistoryTree) Len() uint64 {
+	return t.leaves
+}
+
+// Append adds the leaf of the next block to the tree. It returns the nodes
+// added to the range: the leaf, followed by the parents of the subtrees it
+// completes.
+func (t *HistoryTree) Append(leaf *HistoryNode) ([]*HistoryNode, error) {
+	if t.leaves > 0 && leaf.EarliestHeight != t.peaks[len(t.peaks)-1].LatestHeight+1 {
+		return nil, fmt.Errorf("leaf at height %d does not follow height %d",
+			leaf.EarliestHeight, t.peaks[len(t.peaks)-1].LatestHeight)
+	}
+
+	added := []*HistoryNode{leaf}
+	node, height := leaf, 0
+	for len(t.peaks) > 0 && t.heights[len(t.heights)-1] == height {
+		left := t.peaks[len(t.peaks)-1]
+		parent, err := combineHistoryNodes(left, node, t.branchID)
+		if err != nil {
+			return nil, err
+		}
+		t.peaks, t.heights = t.peaks[:len(t.peaks)-1], t.heights[:len(t.heights)-1]
+		node, height = parent, height+1
+		added = append(added, parent)
+	}
+	t.peaks, t.heights = append(t.peaks, node), append(t.heights, height)
+	t.leaves++
+	return added, nil
+}
+
+// Root returns hashChainHistoryRoot, the hash of the root of the tree
+// obtained by bagging its peaks from right to left, or zero for an empty
+// tree.
+func (t *HistoryTree) Root() (chainhash.Hash, error) {
+	if len(t.peaks) == 0 {
+		return chainhash.Hash{}, nil
+	}
+
+	root := t.peaks[len(t.peaks)-1]
+	for i := len(t.peaks) - 2; i >= 0; i-- {
+		var err error
+		if root, err = combineHistoryNodes(t.peaks[i], root, t.branchID); err != nil {
+			return chainhash.Hash{}, err
+		}
+	}
+	return root.Hash(t.branchID)
+}
+
+// BlockCommitmentsHash returns the hashBlockCommitments header field of NU5
+// blocks committing to the given chain history and authorizing data roots.
+// Heartwood and Canopy blocks commit to the chain history root directly.
+func BlockCommitmentsHash(historyRoot, authDataRoot chainhash.Hash) chainhash.Hash {
+	var buf [chainhash.HashSize * 3]byte
+	copy(buf[:], historyRoot[:])
+	copy(buf[chainhash.HashSize:], authDataRoot[:])
+	h, _ := blake2bHash(buf[:], []byte(blockCommitmentsPersonalization))
+	return h
+}
+
+// historyHasOrchard reports whether the history tree nodes of the upgrade
+// with the given branch ID commit to Orchard data. Upgrades before Heartwood
+// have no history tree.
+func historyHasOrchard(branchID uint32) (bool, error) {
+	upgrade := upgradeIndex(branchID)
+	if upgrade < upgradeIndex(HeartwoodBranchID) {
+		return false, fmt.Errorf("no chain history tree for branch ID %08x", branchID)
+	}
+	return upgrade >= upgradeIndex(NU5BranchID), nil
+}
+
+// blockWork returns the expected number of hashes to find a block with the
+// given nBits, 2^256 / (target+1).
+func blockWork(bits uint32) (*big.Int, error) {
+	target, err := compactToTarget(bits)
+	if err != nil {
+		return nil, err
+	}
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, target.Add(target, big.NewInt(1))), nil
+}
@@ -0,0 +1,215 @@
+package zecutil
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// newTestHistoryLeaf returns the leaf of a block at the given height with a
+// coinbase and a Sapling transaction.
+func newTestHistoryLeaf(t *testing.T, height uint32) *HistoryNode {
+	t.Helper()
+
+	block := &MsgBlock{
+		Header: BlockHeader{
+			Version:   4,
+			Timestamp: time.Unix(1700000000+int64(height)*75, 0),
+			Bits:      0x1f07ffff,
+			Nonce:     [32]byte{byte(height), byte(height >> 8)},
+		},
+		Transactions: []*MsgTx{newTestTx(t, versionSapling, 1, 2, 0)},
+	}
+	leaf, err := NewHistoryLeaf(block, height, chainhash.Hash{byte(height)}, chainhash.Hash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+func TestNewHistoryLeaf(t *testing.T) {
+	coinbase, err := ZecTxFromHex(genesisCoinbase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &MsgBlock{
+		Header: BlockHeader{Version: 4, Timestamp: time.Unix(1700000000, 0), Bits: 0x1f07ffff},
+		Transactions: []*MsgTx{
+			coinbase,
+			newTestTx(t, versionSapling, 1, 2, 0),
+			newTestTxV5(t, 1, 1, 2),
+			newTestTxV5(t, 0, 0, 1),
+		},
+	}
+	leaf, err := NewHistoryLeaf(block, 1687104, chainhash.Hash{1}, chainhash.Hash{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if leaf.SubtreeCommitment != block.BlockHash() || leaf.EarliestTimestamp != 1700000000 ||
+		leaf.LatestTargetBits != 0x1f07ffff || leaf.EarliestHeight != 1687104 || leaf.LatestHeight != 1687104 ||
+		leaf.LatestSaplingRoot != (chainhash.Hash{1}) || leaf.EarliestOrchardRoot != (chainhash.Hash{2}) {
+
+		t.Fatalf("unexpected leaf %+v", leaf)
+	}
+	if leaf.SaplingTxCount != 2 || leaf.OrchardTxCount != 2 {
+		t.Fatalf("tx counts = %d, %d, want 2, 2", leaf.SaplingTxCount, leaf.OrchardTxCount)
+	}
+	// The mainnet proof of work limit is 2^243 - 1.
+	if leaf.SubtreeTotalWork.Cmp(big.NewInt(8192)) != 0 {
+		t.Fatalf("work = %s, want 8192", leaf.SubtreeTotalWork)
+	}
+
+	var v1, v2 bytes.Buffer
+	if err = leaf.Serialize(&v1, CanopyBranchID); err != nil {
+		t.Fatal(err)
+	}
+	if err = leaf.Serialize(&v2, NU5BranchID); err != nil {
+		t.Fatal(err)
+	}
+	// Heights take 5 bytes, the Orchard fields 65.
+	if v1.Len() != 144+5+5+1 || v2.Len() != v1.Len()+65 || !bytes.Equal(v2.Bytes()[:v1.Len()], v1.Bytes()) {
+		t.Fatalf("unexpected encodings %x and %x", v1.Bytes(), v2.Bytes())
+	}
+	if work := v1.Bytes()[112:144]; work[0] != 0x00 || work[1] != 0x20 || !bytes.Equal(work[2:], make([]byte, 30)) {
+		t.Fatalf("unexpected work encoding %x", work)
+	}
+
+	if err = leaf.Serialize(&v1, SaplingBranchID); err == nil {
+		t.Fatal("expected error before Heartwood")
+	}
+	leaf.SubtreeTotalWork = new(big.Int).Lsh(big.NewInt(1), 256)
+	if _, err = leaf.Hash(NU5BranchID); err == nil {
+		t.Fatal("expected error for an overflowing work")
+	}
+	block.Header.Bits = 0
+	if _, err = NewHistoryLeaf(block, 1687104, chainhash.Hash{}, chainhash.Hash{}); err == nil {
+		t.Fatal("expected error for an invalid nBits")
+	}
+}
+
+func TestHistoryTree(t *testing.T) {
+	const activation = 903000
+	leaves := make([]*HistoryNode, 7)
+	for i := range leaves {
+		leaves[i] = newTestHistoryLeaf(t, activation+uint32(i))
+	}
+	combine := func(left, right *HistoryNode) *HistoryNode {
+		node, err := combineHistoryNodes(left, right, HeartwoodBranchID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return node
+	}
+	hash := func(node *HistoryNode) chainhash.Hash {
+		h, err := node.Hash(HeartwoodBranchID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	n01 := combine(leaves[0], leaves[1])
+	n23 := combine(leaves[2], leaves[3])
+	n0123 := combine(n01, n23)
+	n45 := combine(leaves[4], leaves[5])
+
+	var buf bytes.Buffer
+	_ = leaves[0].Serialize(&buf, HeartwoodBranchID)
+	_ = leaves[1].Serialize(&buf, HeartwoodBranchID)
+	if want, _ := blake2bHash(buf.Bytes(), branchPersonalization("ZcashHistory", HeartwoodBranchID)); n01.SubtreeCommitment != want {
+		t.Fatal("unexpected subtree commitment")
+	}
+	if n0123.EarliestHeight != activation || n0123.LatestHeight != activation+3 ||
+		n0123.EarliestTimestamp != leaves[0].EarliestTimestamp || n0123.LatestTimestamp != leaves[3].LatestTimestamp ||
+		n0123.EarliestSaplingRoot != leaves[0].EarliestSaplingRoot || n0123.LatestSaplingRoot != leaves[3].LatestSaplingRoot ||
+		n0123.SaplingTxCount != 4 || n0123.SubtreeTotalWork.Cmp(big.NewInt(4*8192)) != 0 {
+
+		t.Fatalf("unexpected node %+v", n0123)
+	}
+
+	roots := []chainhash.Hash{
+		hash(leaves[0]),
+		hash(n01),
+		hash(combine(n01, leaves[2])),
+		hash(n0123),
+		hash(combine(n0123, leaves[4])),
+		hash(combine(n0123, n45)),
+		hash(combine(n0123, combine(n45, leaves[6]))),
+	}
+	added := []int{1, 2, 1, 3, 1, 2, 1}
+
+	tree, err := NewHistoryTree(HeartwoodBranchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root, err := tree.Root(); err != nil || root != (chainhash.Hash{}) {
+		t.Fatalf("root of an empty tree = %s, %v", root, err)
+	}
+	for i, leaf := range leaves {
+		nodes, err := tree.Append(leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != added[i] || nodes[0] != leaf {
+			t.Fatalf("leaf %d: %d nodes added, want %d", i, len(nodes), added[i])
+		}
+		root, err := tree.Root()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root != roots[i] {
+			t.Fatalf("leaf %d: root %s, want %s", i, root, roots[i])
+		}
+	}
+	if tree.Len() != 7 {
+		t.Fatalf("len = %d, want 7", tree.Len())
+	}
+
+	if _, err = tree.Append(newTestHistoryLeaf(t, activation+8)); err == nil {
+		t.Fatal("expected error for a gap")
+	}
+	if _, err = tree.Append(newTestHistoryLeaf(t, activation+6)); err == nil {
+		t.Fatal("expected error for a repeated height")
+	}
+
+	// The branch ID personalizes every hash.
+	canopy, _ := NewHistoryTree(CanopyBranchID)
+	_, _ = canopy.Append(leaves[0])
+	if root, _ := canopy.Root(); root == roots[0] {
+		t.Fatal("roots do not depend on the branch ID")
+	}
+
+	for _, branchID := range []uint32{SaplingBranchID, BlossomBranchID, 0x12345678} {
+		if _, err = NewHistoryTree(branchID); err == nil {
+			t.Fatalf("%08x: expected error", branchID)
+		}
+	}
+}
+
+func TestBlockCommitments(t *testing.T) {
+	txs := []*MsgTx{newTestTx(t, versionSapling, 1, 1, 0), newTestTxV5(t, 1, 1, 1), newTestTxV5(t, 0, 0, 2)}
+	pair := func(a, b chainhash.Hash) chainhash.Hash {
+		h, _ := blake2bHash(append(a[:], b[:]...), []byte("ZcashAuthDatHash"))
+		return h
+	}
+
+	block := &MsgBlock{Transactions: txs[:1]}
+	if block.AuthDataRoot() != txs[0].AuthDigest() {
+		t.Fatal("auth data root of a single transaction is its digest")
+	}
+	block.Transactions = txs
+	want := pair(pair(txs[0].AuthDigest(), txs[1].AuthDigest()), pair(txs[2].AuthDigest(), chainhash.Hash{}))
+	if block.AuthDataRoot() != want {
+		t.Fatalf("auth data root = %s, want %s", block.AuthDataRoot(), want)
+	}
+
+	historyRoot, authDataRoot := chainhash.Hash{1}, chainhash.Hash{2}
+	data := append(append(historyRoot[:], authDataRoot[:]...), make([]byte, 32)...)
+	if want, _ := blake2bHash(data, []byte("ZcashBlockCommit")); BlockCommitmentsHash(historyRoot, authDataRoot) != want {
+		t.Fatal("unexpected block commitments hash")
+	}
+}
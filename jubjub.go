@@ -0,0 +1,132 @@
+package zecutil
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Jubjub is the twisted Edwards curve -u^2 + v^2 = 1 + d*u^2*v^2 defined
+// over the scalar field of BLS12-381, used by Sapling.
+// https://zips.z.cash/protocol/protocol.pdf#jubjub
+var (
+	// jubjubQ is the order of the base field.
+	jubjubQ, _ = new(big.Int).SetString("73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001", 16)
+
+	// jubjubR is the order of the prime-order subgroup.
+	jubjubR, _ = new(big.Int).SetString("0e7db4ea6533afa906673b0101343b00a6682093ccc81082d0970e5ed6f72cb7", 16)
+
+	// jubjubD is the curve parameter -(10240/10241).
+	jubjubD = func() *big.Int {
+		d := new(big.Int).ModInverse(big.NewInt(10241), jubjubQ)
+		d.Mul(d, big.NewInt(10240))
+		d.Neg(d)
+		return d.Mod(d, jubjubQ)
+	}()
+)
+
+// jubjubPoint is an affine point of the Jubjub curve.
+type jubjubPoint struct {
+	u, v *big.Int
+}
+
+// jubjubIdentity returns the neutral element (0, 1).
+func jubjubIdentity() *jubjubPoint {
+	return &jubjubPoint{u: new(big.Int), v: big.NewInt(1)}
+}
+
+// isIdentity reports whether p is the neutral element.
+func (p *jubjubPoint) isIdentity() bool {
+	return p.u.Sign() == 0 && p.v.Cmp(big.NewInt(1)) == 0
+}
+
+// add returns p + o. The addition law is complete on Jubjub since d is not a
+// square.
+func (p *jubjubPoint) add(o *jubjubPoint) *jubjubPoint {
+	q := jubjubQ
+
+	uu := new(big.Int).Mul(p.u, o.u)
+	vv := new(big.Int).Mul(p.v, o.v)
+	t := new(big.Int).Mul(jubjubD, uu)
+	t.Mul(t, vv).Mod(t, q)
+
+	un := new(big.Int).Mul(p.u, o.v)
+	un.Add(un, new(big.Int).Mul(p.v, o.u))
+	ud := new(big.Int).Add(big.NewInt(1), t)
+	ud.ModInverse(ud, q)
+	un.Mul(un, ud).Mod(un, q)
+
+	// With a = -1 the numerator of v is v1*v2 + u1*u2.
+	vn := new(big.Int).Add(vv, uu)
+	vd := new(big.Int).Sub(big.NewInt(1), t)
+	vd.Mod(vd, q).ModInverse(vd, q)
+	vn.Mul(vn, vd).Mod(vn, q)
+
+	return &jubjubPoint{u: un, v: vn}
+}
+
+// mul returns k*p.
+func (p *jubjubPoint) mul(k *big.Int) *jubjubPoint {
+	res := jubjubIdentity()
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		res = res.add(res)
+		if k.Bit(i) == 1 {
+			res = res.add(p)
+		}
+	}
+	return res
+}
+
+// inPrimeSubgroup reports whether p is in the subgroup of order r.
+func (p *jubjubPoint) inPrimeSubgroup() bool {
+	return p.mul(jubjubR).isIdentity()
+}
+
+// bytes returns the 32-byte encoding of p: the little-endian v-coordinate
+// with the parity of u in the most significant bit.
+func (p *jubjubPoint) bytes() [32]byte {
+	var b [32]byte
+	p.v.FillBytes(b[:])
+	reverseBytes(b[:])
+	b[31] |= byte(p.u.Bit(0)) << 7
+	return b
+}
+
+// decodeJubjubPoint decodes a point from its 32-byte encoding, rejecting
+// non-canonical encodings as required since ZIP-216.
+func decodeJubjubPoint(b [32]byte) (*jubjubPoint, error) {
+	sign := uint(b[31] >> 7)
+	b[31] &= 0x7f
+	reverseBytes(b[:])
+
+	v := new(big.Int).SetBytes(b[:])
+	if v.Cmp(jubjubQ) >= 0 {
+		return nil, errors.New("jubjub: non-canonical v-coordinate")
+	}
+
+	// u^2 = (v^2 - 1) / (d*v^2 + 1)
+	vv := new(big.Int).Mul(v, v)
+	num := new(big.Int).Sub(vv, big.NewInt(1))
+	den := new(big.Int).Mul(jubjubD, vv)
+	den.Add(den, big.NewInt(1)).Mod(den, jubjubQ)
+	den.ModInverse(den, jubjubQ)
+	uu := num.Mul(num, den).Mod(num, jubjubQ)
+
+	u := new(big.Int).ModSqrt(uu, jubjubQ)
+	if u == nil {
+		return nil, errors.New("jubjub: point is not on the curve")
+	}
+	if u.Sign() == 0 && sign == 1 {
+		return nil, errors.New("jubjub: non-canonical point encoding")
+	}
+	if u.Bit(0) != sign {
+		u.Sub(jubjubQ, u)
+	}
+
+	return &jubjubPoint{u: u, v: v}, nil
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
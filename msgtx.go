@@ -15,6 +15,23 @@ import (
 type MsgTx struct {
 	*wire.MsgTx
 	ExpiryHeight uint32
+
+	// ConsensusBranchID is serialized in the header of v5 transactions only.
+	ConsensusBranchID uint32
+
+	// Sprout JoinSplits, v2 to v4 transactions only.
+	JoinSplits      []*JoinSplitDescription
+	JoinSplitPubKey [32]byte
+	JoinSplitSig    [64]byte
+
+	// Sapling bundle.
+	ValueBalance    int64
+	ShieldedSpends  []*SpendDescription
+	ShieldedOutputs []*OutputDescription
+	BindingSig      [64]byte
+
+	// Orchard bundle, v5 transactions only.
+	Orchard *OrchardBundle
 }
 
 // witnessMarkerBytes are a pair of bytes specific to the witness encoding. If
@@ -26,8 +43,14 @@ type MsgTx struct {
 // fields.
 var witessMarkerBytes = []byte{0x00, 0x01}
 
-// TxHash generates the Hash for the transaction.
+// TxHash generates the Hash for the transaction. v5 transactions are
+// identified by their ZIP-244 txid digest.
 func (msg *MsgTx) TxHash() chainhash.Hash {
+	if msg.Version >= versionNU5 {
+		h, _ := v5TxID(msg)
+		return h
+	}
+
 	var buf bytes.Buffer
 	_ = msg.ZecEncode(&buf, 0, wire.BaseEncoding)
 	return chainhash.DoubleHashH(buf.Bytes())
@@ -37,8 +60,16 @@ func (msg *MsgTx) TxHash() chainhash.Hash {
 // This is part of the Message interface implementation.
 // See Serialize for encoding transactions to be stored to disk, such as in a
 // database, as opposed to encoding transactions for the wire.
-// msg.Version must be 3 or 4 and may or may not include the overwintered flag
+// msg.Version must be 1 to 5 and does not include the overwintered flag,
+// which is set for v3 and later.
 func (msg *MsgTx) ZecEncode(w io.Writer, pver uint32, enc wire.MessageEncoding) error {
+	switch {
+	case msg.Version == versionNU5:
+		return msg.zecEncodeV5(w, pver)
+	case msg.Version < versionOverwinter:
+		return msg.zecEncodeLegacy(w, pver)
+	}
+
 	err := binarySerializer.PutUint32(w, littleEndian, uint32(msg.Version)|(1<<31))
 	if err != nil {
 		return err
@@ -119,24 +150,113 @@ func (msg *MsgTx) ZecEncode(w io.Writer, pver uint32, enc wire.MessageEncoding)
 	}
 
 	if msg.Version == versionSapling {
-		// valueBalance
-		if err = binarySerializer.PutUint64(w, littleEndian, 0); err != nil {
+		if err = msg.writeSaplingV4(w, pver); err != nil {
 			return err
 		}
-		// nShieldedSpend
-		err = WriteVarInt(w, pver, 0)
-		if err != nil {
+	} else if msg.hasSapling() {
+		return fmt.Errorf("sapling descriptions are not allowed in v%d transactions", msg.Version)
+	}
+
+	if msg.hasOrchard() {
+		return fmt.Errorf("orchard actions are not allowed in v%d transactions", msg.Version)
+	}
+
+	if err = msg.writeJoinSplits(w, pver); err != nil {
+		return err
+	}
+
+	if msg.Version == versionSapling && msg.hasSapling() {
+		_, err = w.Write(msg.BindingSig[:])
+	}
+
+	return err
+}
+
+// zecEncodeV5 encodes the receiver using the v5 transaction format defined
+// in ZIP-225.
+func (msg *MsgTx) zecEncodeV5(w io.Writer, pver uint32) error {
+	if len(msg.JoinSplits) > 0 {
+		return fmt.Errorf("sprout joinsplits are not allowed in v%d transactions", msg.Version)
+	}
+
+	header := []uint32{
+		uint32(msg.Version) | (1 << 31),
+		versionNU5GroupID,
+		msg.ConsensusBranchID,
+		msg.LockTime,
+		msg.ExpiryHeight,
+	}
+	for _, v := range header {
+		if err := binarySerializer.PutUint32(w, littleEndian, v); err != nil {
 			return err
 		}
+	}
 
-		// nShieldedOutput
-		err = WriteVarInt(w, pver, 0)
-		if err != nil {
+	if err := msg.writeTransparent(w, pver); err != nil {
+		return err
+	}
+
+	if err := msg.writeSaplingV5(w, pver); err != nil {
+		return err
+	}
+
+	return msg.writeOrchard(w, pver)
+}
+
+// zecEncodeLegacy encodes the receiver using the pre-Overwinter v1 and v2
+// transaction formats. v2 transactions carry BCTV14 JoinSplits.
+func (msg *MsgTx) zecEncodeLegacy(w io.Writer, pver uint32) error {
+	switch {
+	case msg.Version < 1:
+		return fmt.Errorf("invalid transaction version %d", msg.Version)
+	case msg.ExpiryHeight != 0:
+		return fmt.Errorf("expiry height is not allowed in v%d transactions", msg.Version)
+	case msg.hasSapling() || msg.hasOrchard():
+		return fmt.Errorf("shielded bundles are not allowed in v%d transactions", msg.Version)
+	case msg.Version < 2 && len(msg.JoinSplits) > 0:
+		return fmt.Errorf("sprout joinsplits are not allowed in v%d transactions", msg.Version)
+	}
+
+	if err := binarySerializer.PutUint32(w, littleEndian, uint32(msg.Version)); err != nil {
+		return err
+	}
+
+	if err := msg.writeTransparent(w, pver); err != nil {
+		return err
+	}
+
+	if err := binarySerializer.PutUint32(w, littleEndian, msg.LockTime); err != nil {
+		return err
+	}
+
+	if msg.Version < 2 {
+		return nil
+	}
+
+	return msg.writeJoinSplits(w, pver)
+}
+
+// writeTransparent encodes the transparent inputs and outputs.
+func (msg *MsgTx) writeTransparent(w io.Writer, pver uint32) error {
+	if err := WriteVarInt(w, pver, uint64(len(msg.TxIn))); err != nil {
+		return err
+	}
+	for _, ti := range msg.TxIn {
+		if err := writeTxIn(w, pver, msg.Version, ti); err != nil {
+			return err
+		}
+	}
+
+	if err := WriteVarInt(w, pver, uint64(len(msg.TxOut))); err != nil {
+		return err
+	}
+	for _, to := range msg.TxOut {
+		if err := WriteTxOut(w, pver, msg.Version, to); err != nil {
 			return err
 		}
 	}
 
-	return WriteVarInt(w, pver, 0)
+	return nil
 }
 
 // WriteTxOut encodes to into the bitcoin protocol encoding for a transaction
@@ -209,7 +329,7 @@ func ZecTxFromHex(raw string) (*MsgTx, error) {
 	if err != nil {
 		return nil, err
 	}
-	mtx := &MsgTx{MsgTx: wire.NewMsgTx(3)} // 版本会在解码时覆盖为 3 或 4
+	mtx := &MsgTx{MsgTx: wire.NewMsgTx(3)} // 版本会在解码时覆盖为 1 到 5
 	if err := mtx.ZecDeserialize(bytes.NewReader(b)); err != nil {
 		return nil, err
 	}
@@ -232,7 +352,7 @@ func (msg *MsgTx) zecDecode(r io.Reader, _ uint32, enc wire.MessageEncoding) err
 	fOverwintered := (verWithFlag >> 31) == 1
 	msg.Version = int32(verWithFlag & 0x7fffffff)
 	if !fOverwintered {
-		return fmt.Errorf("not overwintered tx (expect v3/v4)")
+		return msg.zecDecodeLegacy(r)
 	}
 
 	var vgid uint32
@@ -241,70 +361,143 @@ func (msg *MsgTx) zecDecode(r io.Reader, _ uint32, enc wire.MessageEncoding) err
 	}
 	switch vgid {
 	case versionOverwinterGroupID:
-		msg.Version = versionOverwinter
+		if msg.Version != versionOverwinter {
+			return fmt.Errorf("invalid version %d for versionGroupID 0x%x", msg.Version, vgid)
+		}
 	case versionSaplingGroupID:
-		msg.Version = versionSapling
+		if msg.Version != versionSapling {
+			return fmt.Errorf("invalid version %d for versionGroupID 0x%x", msg.Version, vgid)
+		}
+	case versionNU5GroupID:
+		if msg.Version != versionNU5 {
+			return fmt.Errorf("invalid version %d for versionGroupID 0x%x", msg.Version, vgid)
+		}
+		return msg.zecDecodeV5(r)
 	default:
 		return fmt.Errorf("unknown versionGroupID: 0x%x", vgid)
 	}
 
-	nIn, err := ReadVarInt(r, 0)
-	if err != nil {
+	if err := msg.readTransparent(r); err != nil {
 		return err
 	}
-	msg.TxIn = make([]*wire.TxIn, 0, nIn)
-	for i := uint64(0); i < nIn; i++ {
-		ti, err := readTxInZec(r)
-		if err != nil {
+
+	if err := binary.Read(r, binary.LittleEndian, &msg.LockTime); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &msg.ExpiryHeight); err != nil {
+		return err
+	}
+
+	msg.ValueBalance = 0
+	msg.ShieldedSpends, msg.ShieldedOutputs = nil, nil
+	msg.BindingSig = [64]byte{}
+	msg.Orchard = nil
+
+	if msg.Version == versionSapling {
+		if err := msg.readSaplingV4(r, 0); err != nil {
 			return err
 		}
-		msg.AddTxIn(ti)
 	}
 
-	nOut, err := ReadVarInt(r, 0)
-	if err != nil {
+	if err := msg.readJoinSplits(r, 0); err != nil {
 		return err
 	}
-	msg.TxOut = make([]*wire.TxOut, 0, nOut)
-	for i := uint64(0); i < nOut; i++ {
-		to, err := readTxOutZec(r)
-		if err != nil {
+
+	if msg.Version == versionSapling && msg.hasSapling() {
+		if _, err := io.ReadFull(r, msg.BindingSig[:]); err != nil {
 			return err
 		}
-		msg.AddTxOut(to)
 	}
 
-	if err := binary.Read(r, binary.LittleEndian, &msg.LockTime); err != nil {
+	return nil
+}
+
+// zecDecodeV5 decodes the remainder of a v5 (ZIP-225) transaction, starting
+// right after the version group ID.
+func (msg *MsgTx) zecDecodeV5(r io.Reader) error {
+	msg.JoinSplits = nil
+	msg.JoinSplitPubKey, msg.JoinSplitSig = [32]byte{}, [64]byte{}
+
+	header := []*uint32{&msg.ConsensusBranchID, &msg.LockTime, &msg.ExpiryHeight}
+	for _, v := range header {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	if err := msg.readTransparent(r); err != nil {
 		return err
 	}
-	if err := binary.Read(r, binary.LittleEndian, &msg.ExpiryHeight); err != nil {
+
+	if err := msg.readSaplingV5(r, 0); err != nil {
 		return err
 	}
 
-	if msg.Version == versionSapling {
-		var vb uint64
-		if err := binary.Read(r, binary.LittleEndian, &vb); err != nil {
-			return err
-		}
-		ns, err := ReadVarInt(r, 0)
-		if err != nil {
-			return err
-		}
-		no, err := ReadVarInt(r, 0)
+	return msg.readOrchard(r, 0)
+}
+
+// zecDecodeLegacy decodes the remainder of a pre-Overwinter v1 or v2
+// transaction, starting right after the version.
+func (msg *MsgTx) zecDecodeLegacy(r io.Reader) error {
+	if msg.Version < 1 || msg.Version >= versionOverwinter {
+		return fmt.Errorf("invalid non-overwintered transaction version %d", msg.Version)
+	}
+
+	msg.ExpiryHeight = 0
+	msg.ValueBalance = 0
+	msg.ShieldedSpends, msg.ShieldedOutputs = nil, nil
+	msg.BindingSig = [64]byte{}
+	msg.Orchard = nil
+	msg.JoinSplits = nil
+	msg.JoinSplitPubKey, msg.JoinSplitSig = [32]byte{}, [64]byte{}
+
+	if err := msg.readTransparent(r); err != nil {
+		return err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &msg.LockTime); err != nil {
+		return err
+	}
+
+	if msg.Version < 2 {
+		return nil
+	}
+
+	return msg.readJoinSplits(r, 0)
+}
+
+// readTransparent decodes the transparent inputs and outputs.
+func (msg *MsgTx) readTransparent(r io.Reader) error {
+	nIn, err := ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	if nIn > maxTxSize/minTxInSize {
+		return fmt.Errorf("too many transparent inputs: %d", nIn)
+	}
+	msg.TxIn = make([]*wire.TxIn, 0, nIn)
+	for i := uint64(0); i < nIn; i++ {
+		ti, err := readTxInZec(r)
 		if err != nil {
 			return err
 		}
-		if ns != 0 || no != 0 {
-			return fmt.Errorf("non-transparent sapling fields present: nShieldedSpend=%d nShieldedOutput=%d", ns, no)
-		}
+		msg.AddTxIn(ti)
 	}
 
-	js, err := ReadVarInt(r, 0)
+	nOut, err := ReadVarInt(r, 0)
 	if err != nil {
 		return err
 	}
-	if js != 0 {
-		return fmt.Errorf("non-transparent sprout joinsplits present: n=%d", js)
+	if nOut > maxTxSize/minTxOutSize {
+		return fmt.Errorf("too many transparent outputs: %d", nOut)
+	}
+	msg.TxOut = make([]*wire.TxOut, 0, nOut)
+	for i := uint64(0); i < nOut; i++ {
+		to, err := readTxOutZec(r)
+		if err != nil {
+			return err
+		}
+		msg.AddTxOut(to)
 	}
 
 	return nil
@@ -350,6 +543,26 @@ func readTxOutZec(r io.Reader) (*wire.TxOut, error) {
 
 const MaxScriptSize = 10000
 
+const (
+	// ZatoshiPerZec is the number of zatoshi in one ZEC.
+	ZatoshiPerZec = 100000000
+
+	// MaxMoney is MAX_MONEY, the largest amount of zatoshi a value may have.
+	MaxMoney = 21000000 * ZatoshiPerZec
+)
+
+// maxTxSize is MAX_TX_SIZE_AFTER_SAPLING, used to bound variable length
+// shielded fields while decoding.
+const maxTxSize = 2000000
+
+// Sizes of the smallest transparent input and output, used to bound their
+// counts while decoding: an outpoint, an empty script and a sequence number,
+// and a value with an empty script.
+const (
+	minTxInSize  = 36 + 1 + 4
+	minTxOutSize = 8 + 1
+)
+
 const (
 	LocalMaxTxInPayload  = MaxScriptSize
 	LocalMaxTxOutPayload = MaxScriptSize
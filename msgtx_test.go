@@ -0,0 +1,444 @@
+package zecutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// fillRandom fills each of the passed fields with deterministic pseudo-random
+// bytes.
+func fillRandom(rnd *rand.Rand, fields ...[]byte) {
+	for _, f := range fields {
+		rnd.Read(f)
+	}
+}
+
+// newTestTxV5 builds a v5 transaction with transparent, Sapling and Orchard
+// components filled with pseudo-random data.
+func newTestTxV5(t *testing.T, nSpends, nOutputs, nActions int) *MsgTx {
+	t.Helper()
+	return newTestTx(t, versionNU5, nSpends, nOutputs, nActions)
+}
+
+// newTestTx builds a transaction of the given version with shielded
+// components filled with pseudo-random data.
+func newTestTx(t *testing.T, version int32, nSpends, nOutputs, nActions int) *MsgTx {
+	t.Helper()
+
+	rnd := rand.New(rand.NewSource(int64(nSpends<<16 | nOutputs<<8 | nActions)))
+
+	var prev chainhash.Hash
+	fillRandom(rnd, prev[:])
+
+	tx := &MsgTx{
+		MsgTx:             wire.NewMsgTx(version),
+		ExpiryHeight:      2726500,
+		ConsensusBranchID: 0xc8e71055,
+		ValueBalance:      -12345,
+	}
+	tx.LockTime = 7
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prev, 3), []byte{0x51, 0x52}, nil))
+	tx.AddTxOut(wire.NewTxOut(100000, []byte{0x76, 0xa9}))
+
+	var anchor [32]byte
+	fillRandom(rnd, anchor[:])
+	for i := 0; i < nSpends; i++ {
+		sd := &SpendDescription{Anchor: anchor}
+		fillRandom(rnd, sd.Cv[:], sd.Nullifier[:], sd.Rk[:], sd.ZkProof[:], sd.SpendAuthSig[:])
+		tx.ShieldedSpends = append(tx.ShieldedSpends, sd)
+	}
+	for i := 0; i < nOutputs; i++ {
+		od := &OutputDescription{}
+		fillRandom(rnd, od.Cv[:], od.Cmu[:], od.EphemeralKey[:], od.EncCiphertext[:],
+			od.OutCiphertext[:], od.ZkProof[:])
+		tx.ShieldedOutputs = append(tx.ShieldedOutputs, od)
+	}
+	if tx.hasSapling() {
+		fillRandom(rnd, tx.BindingSig[:])
+	} else {
+		tx.ValueBalance = 0
+	}
+
+	if nActions > 0 {
+		tx.Orchard = &OrchardBundle{
+			Flags:        0x03,
+			ValueBalance: 5000,
+			Proof:        make([]byte, 2720+2272*nActions),
+		}
+		fillRandom(rnd, tx.Orchard.Anchor[:], tx.Orchard.Proof, tx.Orchard.BindingSig[:])
+		for i := 0; i < nActions; i++ {
+			a := &OrchardAction{}
+			fillRandom(rnd, a.Cv[:], a.Nullifier[:], a.Rk[:], a.Cmx[:], a.EphemeralKey[:],
+				a.EncCiphertext[:], a.OutCiphertext[:], a.SpendAuthSig[:])
+			tx.Orchard.Actions = append(tx.Orchard.Actions, a)
+		}
+	}
+
+	return tx
+}
+
+func TestZecDecodeV5RoundTrip(t *testing.T) {
+	tests := []struct {
+		name                        string
+		nSpends, nOutputs, nActions int
+	}{
+		{"transparent", 0, 0, 0},
+		{"sapling spends", 2, 0, 0},
+		{"sapling outputs", 0, 2, 0},
+		{"sapling", 1, 2, 0},
+		{"orchard", 0, 0, 2},
+		{"sapling and orchard", 2, 1, 3},
+	}
+
+	for _, test := range tests {
+		tx := newTestTxV5(t, test.nSpends, test.nOutputs, test.nActions)
+
+		raw, err := tx.ZecToHex()
+		if err != nil {
+			t.Fatalf("%s: encode: %v", test.name, err)
+		}
+		if want := "050000800a27a7265510e7c807000000649a2900"; raw[:len(want)] != want {
+			t.Fatalf("%s: unexpected header %s", test.name, raw[:len(want)])
+		}
+
+		decoded, err := ZecTxFromHex(raw)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", test.name, err)
+		}
+		if decoded.Version != versionNU5 || decoded.ConsensusBranchID != tx.ConsensusBranchID {
+			t.Fatalf("%s: bad header: version %d branch %x", test.name, decoded.Version,
+				decoded.ConsensusBranchID)
+		}
+		if decoded.ValueBalance != tx.ValueBalance {
+			t.Fatalf("%s: valueBalance = %d, want %d", test.name, decoded.ValueBalance, tx.ValueBalance)
+		}
+		if len(decoded.ShieldedSpends) != test.nSpends || len(decoded.ShieldedOutputs) != test.nOutputs {
+			t.Fatalf("%s: bad sapling bundle", test.name)
+		}
+		if test.nActions > 0 && len(decoded.Orchard.Actions) != test.nActions {
+			t.Fatalf("%s: bad orchard bundle", test.name)
+		}
+
+		reencoded, err := decoded.ZecToHex()
+		if err != nil {
+			t.Fatalf("%s: re-encode: %v", test.name, err)
+		}
+		if reencoded != raw {
+			t.Fatalf("%s: round-trip mismatch:\n got:  %s\n want: %s", test.name, reencoded, raw)
+		}
+	}
+}
+
+func TestZecDecodeV5Truncated(t *testing.T) {
+	tx := newTestTxV5(t, 1, 1, 1)
+
+	var buf bytes.Buffer
+	if err := tx.ZecSerialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := buf.Bytes()
+	for _, n := range []int{len(raw) - 1, len(raw) - 64, 20} {
+		if _, err := ZecTxFromHex(hex.EncodeToString(raw[:n])); err == nil {
+			t.Fatalf("expected error decoding %d of %d bytes", n, len(raw))
+		}
+	}
+}
+
+func TestZecDecodeHugeCounts(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"v5 inputs", "050000800a27a726b4d0d6c20000000000000000ffffffffffffffff7f"},
+		{"v5 outputs", "050000800a27a726b4d0d6c2000000000000000000ffffffffffffffff7f"},
+		{"v4 inputs", "0400008085202f89ffffffffffffffff7f"},
+		{"v1 outputs", "0100000000fe00e1f505"},
+	}
+	for _, test := range tests {
+		if _, err := ZecTxFromHex(test.raw); err == nil || !strings.Contains(err.Error(), "too many") {
+			t.Fatalf("%s: got %v, want a count error", test.name, err)
+		}
+	}
+}
+
+func TestTxHashV5(t *testing.T) {
+	tx := newTestTxV5(t, 1, 1, 2)
+	txid, auth := tx.TxHash(), tx.AuthDigest()
+
+	// Authorizing data is committed to by the auth digest only.
+	tx.TxIn[0].SignatureScript = []byte{0x00}
+	tx.ShieldedSpends[0].SpendAuthSig[0] ^= 1
+	tx.Orchard.Proof[0] ^= 1
+	if tx.TxHash() != txid {
+		t.Fatal("txid commits to authorizing data")
+	}
+	if tx.AuthDigest() == auth {
+		t.Fatal("auth digest does not commit to authorizing data")
+	}
+
+	// Effecting data changes the txid.
+	tx.Orchard.Actions[1].EncCiphertext[100] ^= 1
+	if tx.TxHash() == txid {
+		t.Fatal("txid does not commit to orchard memo")
+	}
+	txid = tx.TxHash()
+	tx.ConsensusBranchID = 0xc2d6d0b4
+	if tx.TxHash() == txid {
+		t.Fatal("txid does not commit to consensus branch id")
+	}
+
+	legacy := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling)}
+	for _, b := range legacy.AuthDigest() {
+		if b != 0xff {
+			t.Fatal("pre-v5 auth digest must be all 0xff")
+		}
+	}
+}
+
+func TestZecDecodeV4SaplingRoundTrip(t *testing.T) {
+	for _, n := range [][2]int{{0, 0}, {1, 0}, {0, 2}, {3, 2}} {
+		tx := newTestTx(t, versionSapling, n[0], n[1], 0)
+		for i, sd := range tx.ShieldedSpends {
+			// v4 spends each carry their own anchor.
+			sd.Anchor[0] = byte(i)
+		}
+
+		raw, err := tx.ZecToHex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "0400008085202f89"; raw[:len(want)] != want {
+			t.Fatalf("unexpected header %s", raw[:len(want)])
+		}
+
+		decoded, err := ZecTxFromHex(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.ValueBalance != tx.ValueBalance {
+			t.Fatalf("valueBalance = %d, want %d", decoded.ValueBalance, tx.ValueBalance)
+		}
+		if len(decoded.ShieldedSpends) != n[0] || len(decoded.ShieldedOutputs) != n[1] {
+			t.Fatal("bad sapling bundle")
+		}
+		for i, sd := range decoded.ShieldedSpends {
+			if *sd != *tx.ShieldedSpends[i] {
+				t.Fatalf("spend %d mismatch", i)
+			}
+		}
+		for i, od := range decoded.ShieldedOutputs {
+			if *od != *tx.ShieldedOutputs[i] {
+				t.Fatalf("output %d mismatch", i)
+			}
+		}
+		if decoded.BindingSig != tx.BindingSig {
+			t.Fatal("binding sig mismatch")
+		}
+
+		reencoded, err := decoded.ZecToHex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reencoded != raw {
+			t.Fatalf("round-trip mismatch:\n got:  %s\n want: %s", reencoded, raw)
+		}
+	}
+
+	tx := newTestTx(t, versionOverwinter, 1, 0, 0)
+	if _, err := tx.ZecToHex(); err == nil {
+		t.Fatal("expected error encoding sapling spends in a v3 transaction")
+	}
+
+	// The version must match the version group ID.
+	raw, err := newTestTx(t, versionSapling, 0, 1, 0).ZecToHex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ZecTxFromHex("03" + raw[2:]); err == nil {
+		t.Fatal("expected error for a v3 transaction with the Sapling version group ID")
+	}
+}
+
+// newTestJoinSplit builds a JoinSplit filled with pseudo-random data.
+func newTestJoinSplit(rnd *rand.Rand, proofSize int) *JoinSplitDescription {
+	js := &JoinSplitDescription{
+		VPubOld: uint64(rnd.Int63n(1e8)),
+		ZkProof: make([]byte, proofSize),
+	}
+	fillRandom(rnd, js.Anchor[:], js.Nullifiers[0][:], js.Nullifiers[1][:], js.Commitments[0][:],
+		js.Commitments[1][:], js.EphemeralKey[:], js.RandomSeed[:], js.Macs[0][:], js.Macs[1][:],
+		js.ZkProof, js.EncCiphertexts[0][:], js.EncCiphertexts[1][:])
+	return js
+}
+
+func TestZecDecodeJoinSplitsRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	tests := []struct {
+		version   int32
+		nSpends   int
+		proofSize int
+	}{
+		{versionOverwinter, 0, bctv14ProofSize},
+		{versionSapling, 0, groth16ProofSize},
+		{versionSapling, 2, groth16ProofSize},
+	}
+
+	for _, test := range tests {
+		tx := newTestTx(t, test.version, test.nSpends, 0, 0)
+		tx.JoinSplits = []*JoinSplitDescription{
+			newTestJoinSplit(rnd, test.proofSize),
+			newTestJoinSplit(rnd, test.proofSize),
+		}
+		fillRandom(rnd, tx.JoinSplitPubKey[:], tx.JoinSplitSig[:])
+
+		raw, err := tx.ZecToHex()
+		if err != nil {
+			t.Fatalf("v%d: %v", test.version, err)
+		}
+
+		decoded, err := ZecTxFromHex(raw)
+		if err != nil {
+			t.Fatalf("v%d: %v", test.version, err)
+		}
+		if len(decoded.JoinSplits) != 2 || decoded.JoinSplitSig != tx.JoinSplitSig ||
+			decoded.JoinSplitPubKey != tx.JoinSplitPubKey {
+			t.Fatalf("v%d: bad joinsplits", test.version)
+		}
+		if decoded.JoinSplits[1].VPubOld != tx.JoinSplits[1].VPubOld ||
+			!bytes.Equal(decoded.JoinSplits[1].ZkProof, tx.JoinSplits[1].ZkProof) {
+			t.Fatalf("v%d: joinsplit mismatch", test.version)
+		}
+		if decoded.BindingSig != tx.BindingSig {
+			t.Fatalf("v%d: binding sig mismatch", test.version)
+		}
+
+		if reencoded, _ := decoded.ZecToHex(); reencoded != raw {
+			t.Fatalf("v%d: round-trip mismatch", test.version)
+		}
+	}
+
+	tx := newTestTx(t, versionSapling, 0, 0, 0)
+	tx.JoinSplits = []*JoinSplitDescription{newTestJoinSplit(rnd, bctv14ProofSize)}
+	if _, err := tx.ZecToHex(); err == nil {
+		t.Fatal("expected error encoding a BCTV14 proof in a v4 transaction")
+	}
+}
+
+func TestZecDecodeLegacy(t *testing.T) {
+	tx, err := ZecTxFromHex(genesisCoinbase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Version != 1 || len(tx.TxIn) != 1 || len(tx.TxOut) != 1 {
+		t.Fatalf("unexpected transaction: version %d, %d inputs, %d outputs", tx.Version, len(tx.TxIn), len(tx.TxOut))
+	}
+	if want := "c4eaa58879081de3c24a7b117ed2b28300e7ec4c4c1dff1d3f1268b7857a4ddb"; tx.TxHash().String() != want {
+		t.Fatalf("txid = %s, want %s", tx.TxHash(), want)
+	}
+	if raw, _ := tx.ZecToHex(); raw != genesisCoinbase {
+		t.Fatalf("round-trip mismatch:\n got:  %s\n want: %s", raw, genesisCoinbase)
+	}
+
+	rnd := rand.New(rand.NewSource(2))
+	v2 := &MsgTx{MsgTx: wire.NewMsgTx(2)}
+	v2.AddTxIn(tx.TxIn[0])
+	v2.JoinSplits = []*JoinSplitDescription{newTestJoinSplit(rnd, bctv14ProofSize)}
+	fillRandom(rnd, v2.JoinSplitPubKey[:], v2.JoinSplitSig[:])
+
+	raw, err := v2.ZecToHex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw[:8] != "02000000" {
+		t.Fatalf("unexpected header %s", raw[:8])
+	}
+	decoded, err := ZecTxFromHex(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Version != 2 || len(decoded.JoinSplits) != 1 || decoded.JoinSplitSig != v2.JoinSplitSig {
+		t.Fatal("bad v2 joinsplits")
+	}
+	if reencoded, _ := decoded.ZecToHex(); reencoded != raw {
+		t.Fatal("v2 round-trip mismatch")
+	}
+	if decoded.TxHash() != chainhash.DoubleHashH(mustDecodeHex(t, raw)) {
+		t.Fatal("v2 txid is not the double SHA-256 of the transaction")
+	}
+
+	v1 := &MsgTx{MsgTx: wire.NewMsgTx(1), ExpiryHeight: 10}
+	if _, err = v1.ZecToHex(); err == nil {
+		t.Fatal("expected error encoding expiry height in a v1 transaction")
+	}
+	if _, err = ZecTxFromHex("05000000" + genesisCoinbase[8:]); err == nil {
+		t.Fatal("expected error decoding non-overwintered v5 transaction")
+	}
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestOrchardBundle(t *testing.T) {
+	tx := newTestTxV5(t, 0, 0, 2)
+	tx.Orchard.Flags = OrchardFlagOutputsEnabled
+
+	raw, err := tx.ZecToHex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ZecTxFromHex(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := decoded.Orchard
+	if b.SpendsEnabled() || !b.OutputsEnabled() {
+		t.Fatalf("bad flags 0x%02x", b.Flags)
+	}
+	if decoded.ValueBalanceOrchard() != 5000 || b.Anchor != tx.Orchard.Anchor ||
+		b.BindingSig != tx.Orchard.BindingSig || !bytes.Equal(b.Proof, tx.Orchard.Proof) {
+		t.Fatal("orchard bundle mismatch")
+	}
+	for i, a := range b.Actions {
+		if *a != *tx.Orchard.Actions[i] {
+			t.Fatalf("action %d mismatch", i)
+		}
+		if b.Nullifiers()[i] != a.Nullifier || b.NoteCommitments()[i] != a.Cmx {
+			t.Fatalf("action %d: bad nullifier or commitment", i)
+		}
+	}
+
+	// Flip a reserved flag bit in the serialized bundle. The flags byte
+	// follows the actions.
+	flagsOffset := len(raw)/2 - 64 - 2*64 - len(tx.Orchard.Proof) - 3 - 32 - 8 - 1
+	bad := mustDecodeHex(t, raw)
+	if bad[flagsOffset] != OrchardFlagOutputsEnabled {
+		t.Fatalf("flags not found at offset %d", flagsOffset)
+	}
+	bad[flagsOffset] |= 0x80
+	if _, err = ZecTxFromHex(hex.EncodeToString(bad)); err == nil {
+		t.Fatal("expected error decoding reserved orchard flags")
+	}
+
+	v4 := newTestTx(t, versionSapling, 0, 0, 1)
+	if _, err = v4.ZecToHex(); err == nil {
+		t.Fatal("expected error encoding orchard actions in a v4 transaction")
+	}
+	if v4 := newTestTx(t, versionSapling, 0, 0, 0); v4.ValueBalanceOrchard() != 0 {
+		t.Fatal("expected zero orchard value balance without a bundle")
+	}
+}
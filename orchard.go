@@ -0,0 +1,203 @@
+package zecutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// orchardEncCiphertextSize is the size of an Orchard note ciphertext,
+	// including the 512-byte memo.
+	orchardEncCiphertextSize = 580
+
+	// orchardOutCiphertextSize is the size of an Orchard outgoing ciphertext.
+	orchardOutCiphertextSize = 80
+
+	// maxOrchardActions is the exclusive upper bound ZIP-225 places on
+	// nActionsOrchard.
+	maxOrchardActions = 1 << 16
+)
+
+// Orchard bundle flags.
+const (
+	// OrchardFlagSpendsEnabled allows the actions of the bundle to spend
+	// non-zero valued notes.
+	OrchardFlagSpendsEnabled byte = 1 << 0
+
+	// OrchardFlagOutputsEnabled allows the actions of the bundle to create
+	// non-zero valued notes.
+	OrchardFlagOutputsEnabled byte = 1 << 1
+
+	// orchardFlagsReserved are the bits that must be zero.
+	orchardFlagsReserved = ^(OrchardFlagSpendsEnabled | OrchardFlagOutputsEnabled)
+)
+
+// OrchardAction is a single Orchard action description. Its spend
+// authorization signature is serialized separately from the action in v5
+// transactions but is kept alongside it here.
+type OrchardAction struct {
+	Cv            [32]byte
+	Nullifier     [32]byte
+	Rk            [32]byte
+	Cmx           [32]byte
+	EphemeralKey  [32]byte
+	EncCiphertext [orchardEncCiphertextSize]byte
+	OutCiphertext [orchardOutCiphertextSize]byte
+	SpendAuthSig  [64]byte
+}
+
+// OrchardBundle is the Orchard part of a v5 transaction.
+type OrchardBundle struct {
+	Actions      []*OrchardAction
+	Flags        byte
+	ValueBalance int64
+	Anchor       [32]byte
+	Proof        []byte
+	BindingSig   [64]byte
+}
+
+// SpendsEnabled reports whether the bundle may spend Orchard notes.
+func (b *OrchardBundle) SpendsEnabled() bool {
+	return b.Flags&OrchardFlagSpendsEnabled != 0
+}
+
+// OutputsEnabled reports whether the bundle may create Orchard notes.
+func (b *OrchardBundle) OutputsEnabled() bool {
+	return b.Flags&OrchardFlagOutputsEnabled != 0
+}
+
+// Nullifiers returns the nullifiers revealed by the actions of the bundle.
+func (b *OrchardBundle) Nullifiers() [][32]byte {
+	nfs := make([][32]byte, len(b.Actions))
+	for i, a := range b.Actions {
+		nfs[i] = a.Nullifier
+	}
+	return nfs
+}
+
+// NoteCommitments returns the note commitments created by the actions of
+// the bundle.
+func (b *OrchardBundle) NoteCommitments() [][32]byte {
+	cmxs := make([][32]byte, len(b.Actions))
+	for i, a := range b.Actions {
+		cmxs[i] = a.Cmx
+	}
+	return cmxs
+}
+
+// ValueBalanceOrchard returns the net value flowing out of the Orchard pool
+// into the transparent value pool, in zatoshi. It is zero for transactions
+// without an Orchard bundle.
+func (msg *MsgTx) ValueBalanceOrchard() int64 {
+	if !msg.hasOrchard() {
+		return 0
+	}
+	return msg.Orchard.ValueBalance
+}
+
+// hasOrchard reports whether the transaction has a non-empty Orchard bundle.
+func (msg *MsgTx) hasOrchard() bool {
+	return msg.Orchard != nil && len(msg.Orchard.Actions) > 0
+}
+
+// writeOrchard encodes the Orchard bundle using the v5 (ZIP-225) layout.
+// A nil or empty bundle is written as a zero action count.
+func (msg *MsgTx) writeOrchard(w io.Writer, pver uint32) error {
+	if !msg.hasOrchard() {
+		return WriteVarInt(w, pver, 0)
+	}
+	b := msg.Orchard
+	if b.Flags&orchardFlagsReserved != 0 {
+		return fmt.Errorf("reserved orchard flags set: 0x%02x", b.Flags)
+	}
+
+	if err := WriteVarInt(w, pver, uint64(len(b.Actions))); err != nil {
+		return err
+	}
+	for _, a := range b.Actions {
+		err := writeBytes(w, a.Cv[:], a.Nullifier[:], a.Rk[:], a.Cmx[:], a.EphemeralKey[:],
+			a.EncCiphertext[:], a.OutCiphertext[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := binarySerializer.PutUint8(w, b.Flags); err != nil {
+		return err
+	}
+	if err := binarySerializer.PutUint64(w, littleEndian, uint64(b.ValueBalance)); err != nil {
+		return err
+	}
+	if _, err := w.Write(b.Anchor[:]); err != nil {
+		return err
+	}
+	if err := WriteVarBytes(w, pver, b.Proof); err != nil {
+		return err
+	}
+	for _, a := range b.Actions {
+		if _, err := w.Write(a.SpendAuthSig[:]); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(b.BindingSig[:])
+	return err
+}
+
+// readOrchard decodes the Orchard bundle using the v5 (ZIP-225) layout.
+func (msg *MsgTx) readOrchard(r io.Reader, pver uint32) error {
+	msg.Orchard = nil
+
+	nActions, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if nActions == 0 {
+		return nil
+	}
+	if nActions >= maxOrchardActions {
+		return fmt.Errorf("too many orchard actions: %d", nActions)
+	}
+
+	b := &OrchardBundle{Actions: make([]*OrchardAction, 0, nActions)}
+	for i := uint64(0); i < nActions; i++ {
+		a := &OrchardAction{}
+		err = readBytes(r, a.Cv[:], a.Nullifier[:], a.Rk[:], a.Cmx[:], a.EphemeralKey[:],
+			a.EncCiphertext[:], a.OutCiphertext[:])
+		if err != nil {
+			return err
+		}
+		b.Actions = append(b.Actions, a)
+	}
+
+	var flags [1]byte
+	if _, err = io.ReadFull(r, flags[:]); err != nil {
+		return err
+	}
+	b.Flags = flags[0]
+	if b.Flags&orchardFlagsReserved != 0 {
+		return fmt.Errorf("reserved orchard flags set: 0x%02x", b.Flags)
+	}
+
+	if err = binary.Read(r, binary.LittleEndian, &b.ValueBalance); err != nil {
+		return err
+	}
+	if _, err = io.ReadFull(r, b.Anchor[:]); err != nil {
+		return err
+	}
+	if b.Proof, err = ReadVarBytes(r, pver, maxTxSize); err != nil {
+		return err
+	}
+	for _, a := range b.Actions {
+		if _, err = io.ReadFull(r, a.SpendAuthSig[:]); err != nil {
+			return err
+		}
+	}
+	if _, err = io.ReadFull(r, b.BindingSig[:]); err != nil {
+		return err
+	}
+
+	msg.Orchard = b
+	return nil
+}
@@ -0,0 +1,282 @@
+package zecutil
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Params defines a Zcash network.
+//
+// The embedded chaincfg.Params carries the fields shared with Bitcoin (name,
+// network magic, default port, genesis hash, proof of work limit, coinbase
+// maturity, WIF and extended key version bytes, BIP44 coin type) so that it
+// can be passed to btcd packages as is. Its single byte address IDs are
+// unused, Zcash transparent addresses have two byte prefixes.
+type Params struct {
+	chaincfg.Params
+
+	// Transparent P2PKH and P2SH address prefixes.
+	PubHashPrefixes    []byte
+	ScriptHashPrefixes []byte
+
+	// Sapling Bech32 human-readable parts.
+	SaplingPaymentAddressHRP         string
+	SaplingExtendedSpendingKeyHRP    string
+	SaplingExtendedFullViewingKeyHRP string
+
+	// Unified (ZIP-316) Bech32m human-readable parts.
+	UnifiedAddressHRP            string
+	UnifiedFullViewingKeyHRP     string
+	UnifiedIncomingViewingKeyHRP string
+
+	// TexAddressHRP is the Bech32m human-readable part of ZIP-320
+	// transparent-source-only addresses.
+	TexAddressHRP string
+
+	// Upgrades is the network upgrade schedule, ordered by activation height.
+	Upgrades []NetworkUpgrade
+
+	// DefaultExpiryDelta is the number of blocks after which a transaction
+	// expires if it is not mined, DEFAULT_TX_EXPIRY_DELTA in zcashd.
+	DefaultExpiryDelta uint32
+
+	// EquihashN and EquihashK are the Equihash parameters of the block
+	// proof of work. The proof of work limit is the PowLimit of the
+	// embedded chaincfg.Params.
+	EquihashN uint32
+	EquihashK uint32
+}
+
+// newHashFromStr converts the passed big-endian hex string into a
+// chainhash.Hash. It only differs from the one available in chainhash in
+// that it panics on an error since it will only (and must only) be called
+// with hard-coded, and therefore known good, hashes.
+func newHashFromStr(hexStr string) *chainhash.Hash {
+	hash, err := chainhash.NewHashFromStr(hexStr)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// newBigFromHex converts the passed big-endian hex string into a big.Int,
+// panicking on an error like newHashFromStr.
+func newBigFromHex(hexStr string) *big.Int {
+	n, ok := new(big.Int).SetString(hexStr, 16)
+	if !ok {
+		panic("invalid hex number " + hexStr)
+	}
+	return n
+}
+
+var (
+	// MainNetParams defines the Zcash main network.
+	MainNetParams = Params{
+		Params: chaincfg.Params{
+			Name:             "mainnet",
+			Net:              wire.BitcoinNet(0x6427e924),
+			DefaultPort:      "8233",
+			GenesisHash:      newHashFromStr("00040fe8ec8471911baa1db1266ea15dd06b4a8a5c453883c000b031973dce08"),
+			PowLimit:         newBigFromHex("0007ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"),
+			PowLimitBits:     0x1f07ffff,
+			CoinbaseMaturity: 100,
+			PrivateKeyID:     0x80,
+			HDPrivateKeyID:   [4]byte{0x04, 0x88, 0xad, 0xe4}, // xprv
+			HDPublicKeyID:    [4]byte{0x04, 0x88, 0xb2, 0x1e}, // xpub
+			HDCoinType:       133,
+		},
+		PubHashPrefixes:                  []byte{0x1C, 0xB8},
+		ScriptHashPrefixes:               []byte{0x1C, 0xBD},
+		SaplingPaymentAddressHRP:         "zs",
+		SaplingExtendedSpendingKeyHRP:    "secret-extended-key-main",
+		SaplingExtendedFullViewingKeyHRP: "zxviews",
+		UnifiedAddressHRP:                "u",
+		UnifiedFullViewingKeyHRP:         "uview",
+		UnifiedIncomingViewingKeyHRP:     "uivk",
+		TexAddressHRP:                    "tex",
+		Upgrades:                         MainNetUpgrades,
+		DefaultExpiryDelta:               40,
+		EquihashN:                        200,
+		EquihashK:                        9,
+	}
+
+	// TestNet3Params defines the Zcash test network.
+	TestNet3Params = Params{
+		Params: chaincfg.Params{
+			Name:             "testnet3",
+			Net:              wire.BitcoinNet(0xbff91afa),
+			DefaultPort:      "18233",
+			GenesisHash:      newHashFromStr("05a60a92d99d85997cce3b87616c089f6124d7342af37106edc76126334a2c38"),
+			PowLimit:         newBigFromHex("07ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"),
+			PowLimitBits:     0x2007ffff,
+			CoinbaseMaturity: 100,
+			PrivateKeyID:     0xef,
+			HDPrivateKeyID:   [4]byte{0x04, 0x35, 0x83, 0x94}, // tprv
+			HDPublicKeyID:    [4]byte{0x04, 0x35, 0x87, 0xcf}, // tpub
+			HDCoinType:       1,
+		},
+		PubHashPrefixes:                  []byte{0x1D, 0x25},
+		ScriptHashPrefixes:               []byte{0x1C, 0xBA},
+		SaplingPaymentAddressHRP:         "ztestsapling",
+		SaplingExtendedSpendingKeyHRP:    "secret-extended-key-test",
+		SaplingExtendedFullViewingKeyHRP: "zxviewtestsapling",
+		UnifiedAddressHRP:                "utest",
+		UnifiedFullViewingKeyHRP:         "uviewtest",
+		UnifiedIncomingViewingKeyHRP:     "uivktest",
+		TexAddressHRP:                    "textest",
+		Upgrades:                         TestNetUpgrades,
+		DefaultExpiryDelta:               40,
+		EquihashN:                        200,
+		EquihashK:                        9,
+	}
+
+	// RegTestParams defines the default Zcash regression test network. It
+	// shares the testnet transparent prefixes. Use NewRegTestParams for
+	// regtest networks with another upgrade schedule.
+	RegTestParams = Params{
+		Params: chaincfg.Params{
+			Name:             "regtest",
+			Net:              wire.BitcoinNet(0x5f3fe8aa),
+			DefaultPort:      "18344",
+			GenesisHash:      newHashFromStr("029f11d80ef9765602235e1bc9727e3eb6ba20839319f761fee920d63401e327"),
+			PowLimit:         newBigFromHex("0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f0f"),
+			PowLimitBits:     0x200f0f0f,
+			CoinbaseMaturity: 100,
+			PrivateKeyID:     0xef,
+			HDPrivateKeyID:   [4]byte{0x04, 0x35, 0x83, 0x94}, // tprv
+			HDPublicKeyID:    [4]byte{0x04, 0x35, 0x87, 0xcf}, // tpub
+			HDCoinType:       1,
+		},
+		PubHashPrefixes:                  []byte{0x1D, 0x25},
+		ScriptHashPrefixes:               []byte{0x1C, 0xBA},
+		SaplingPaymentAddressHRP:         "zregtestsapling",
+		SaplingExtendedSpendingKeyHRP:    "secret-extended-key-regtest",
+		SaplingExtendedFullViewingKeyHRP: "zxviewregtestsapling",
+		UnifiedAddressHRP:                "uregtest",
+		UnifiedFullViewingKeyHRP:         "uviewregtest",
+		UnifiedIncomingViewingKeyHRP:     "uivkregtest",
+		TexAddressHRP:                    "texregtest",
+		Upgrades:                         RegTestUpgrades,
+		DefaultExpiryDelta:               40,
+		EquihashN:                        48,
+		EquihashK:                        5,
+	}
+)
+
+var (
+	// ErrDuplicateNet describes an error where the parameters for a Zcash
+	// network could not be registered due to the network name already being
+	// in use.
+	ErrDuplicateNet = errors.New("duplicate Zcash network")
+
+	// ErrUnknownNet describes an error where the parameters of a network
+	// were looked up by a name that is not registered.
+	ErrUnknownNet = errors.New("unknown Zcash network")
+)
+
+var (
+	registeredNetsMtx sync.RWMutex
+	registeredNets    = map[string]*Params{
+		MainNetParams.Name:  &MainNetParams,
+		TestNet3Params.Name: &TestNet3Params,
+		RegTestParams.Name:  &RegTestParams,
+	}
+)
+
+// Register registers the parameters of a Zcash network, typically a regtest
+// network with a custom upgrade schedule, so that addresses and keys bound to
+// it can be resolved by name. The network must be named and its upgrade
+// schedule must start with Sprout at height 0, followed by known upgrades in
+// activation order. ErrDuplicateNet is returned if a network with the same
+// name is already registered.
+func Register(params *Params) error {
+	if params == nil {
+		return errors.New("nil network parameters")
+	}
+	if params.Name == "" {
+		return errors.New("network parameters without a name")
+	}
+	if err := checkUpgrades(params.Upgrades); err != nil {
+		return fmt.Errorf("network %s: %w", params.Name, err)
+	}
+
+	registeredNetsMtx.Lock()
+	defer registeredNetsMtx.Unlock()
+
+	if _, ok := registeredNets[params.Name]; ok {
+		return ErrDuplicateNet
+	}
+	registeredNets[params.Name] = params
+
+	return nil
+}
+
+// checkUpgrades checks that an upgrade schedule starts with Sprout at height
+// 0 and lists known upgrades in the order they activate, each one at most
+// once.
+func checkUpgrades(upgrades []NetworkUpgrade) error {
+	if len(upgrades) == 0 || upgrades[0].BranchID != SproutBranchID || upgrades[0].ActivationHeight != 0 {
+		return errors.New("upgrade schedule does not start with Sprout at height 0")
+	}
+	for i := 1; i < len(upgrades); i++ {
+		prev, u := upgrades[i-1], upgrades[i]
+		if upgradeIndex(u.BranchID) < 0 {
+			return fmt.Errorf("unknown branch ID %08x of upgrade %s", u.BranchID, u.Name)
+		}
+		if upgradeIndex(u.BranchID) <= upgradeIndex(prev.BranchID) || u.ActivationHeight < prev.ActivationHeight {
+			return fmt.Errorf("upgrade %s is out of order after %s", u.Name, prev.Name)
+		}
+	}
+	return nil
+}
+
+// ParamsForNet returns the registered parameters of the named network.
+func ParamsForNet(name string) (*Params, error) {
+	registeredNetsMtx.RLock()
+	defer registeredNetsMtx.RUnlock()
+
+	params, ok := registeredNets[name]
+	if !ok {
+		return nil, ErrUnknownNet
+	}
+
+	return params, nil
+}
+
+// NewRegTestParams returns a copy of RegTestParams with the given name and
+// upgrade schedule. The result still has to be registered with Register.
+func NewRegTestParams(name string, upgrades []NetworkUpgrade) *Params {
+	params := RegTestParams
+	params.Name = name
+	params.Upgrades = append([]NetworkUpgrade(nil), upgrades...)
+	return &params
+}
+
+// ConsensusBranchID returns the consensus branch ID of the network at the
+// given block height.
+func (p *Params) ConsensusBranchID(height uint32) uint32 {
+	return BranchIDForHeight(p.Upgrades, height)
+}
+
+// UpgradeActive reports whether the network upgrade with the given branch ID
+// is active at the given block height.
+func (p *Params) UpgradeActive(branchID uint32, height uint32) bool {
+	for _, u := range p.Upgrades {
+		if u.BranchID == branchID {
+			return height >= u.ActivationHeight
+		}
+	}
+	return false
+}
+
+// validTransparent reports whether p defines the transparent address
+// prefixes.
+func (p *Params) validTransparent() bool {
+	return p != nil && len(p.PubHashPrefixes) == 2 && len(p.ScriptHashPrefixes) == 2
+}
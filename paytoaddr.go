@@ -29,6 +29,12 @@ func PayToAddrScript(addr btcutil.Address) ([]byte, error) {
 			return nil, errors.New(nilAddrErrStr)
 		}
 		return payToScriptHashScript(addr.ScriptAddress())
+
+	case *ZecAddressTex:
+		if addr == nil {
+			return nil, errors.New(nilAddrErrStr)
+		}
+		return payToPubKeyHashScript(addr.ScriptAddress())
 	}
 	return nil, fmt.Errorf("unable to generate payment script for unsupported address type %T", addr)
 }
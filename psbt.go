@@ -0,0 +1,867 @@
+package zecutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// psbtMagic starts every serialized PSBT. It differs from the BIP174 magic
+// so that Bitcoin tools reject Zcash containers.
+var psbtMagic = []byte("zpsbt\xff")
+
+// Key types of the global map.
+const (
+	psbtGlobalUnsignedTx   = 0x00
+	psbtGlobalBranchID     = 0x01
+	psbtGlobalExpiryHeight = 0x02
+)
+
+// Key types of the input maps.
+const (
+	psbtInPrevOut         = 0x00
+	psbtInRedeemScript    = 0x01
+	psbtInPartialSig      = 0x02
+	psbtInSigHashType     = 0x03
+	psbtInBip32Derivation = 0x04
+	psbtInFinalScriptSig  = 0x05
+)
+
+// Key types of the output maps.
+const (
+	psbtOutRedeemScript    = 0x00
+	psbtOutBip32Derivation = 0x01
+)
+
+// psbtMaxKeySize is the size of the largest key, a key type followed by an
+// uncompressed public key of 65 bytes.
+const psbtMaxKeySize = 1 + 65
+
+// PartialSig is a signature of a PSBT input by one of its public keys.
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// Bip32Derivation tells a signer which key of its wallet a public key
+// derives from.
+type Bip32Derivation struct {
+	PubKey               []byte
+	MasterKeyFingerprint uint32
+	Path                 []uint32
+}
+
+// PSBTInput holds what signers need to know about an input of a PSBT.
+type PSBTInput struct {
+	// Amount and PkScript describe the output spent by the input.
+	Amount   int64
+	PkScript []byte
+
+	// RedeemScript is required to sign inputs spending P2SH outputs.
+	RedeemScript []byte
+
+	PartialSigs     []*PartialSig
+	Bip32Derivation []*Bip32Derivation
+
+	// SigHashType is the hash type signers must use, zero stands for
+	// SigHashAll.
+	SigHashType txscript.SigHashType
+
+	// FinalScriptSig is set once the input is finalized, the other fields
+	// but Amount and PkScript are cleared then.
+	FinalScriptSig []byte
+}
+
+// PSBTOutput holds what signers need to know about an output of a PSBT to
+// recognize their change.
+type PSBTOutput struct {
+	RedeemScript    []byte
+	Bip32Derivation []*Bip32Derivation
+}
+
+// PSBT is a partially signed transparent Zcash transaction, a container
+// modeled on BIP174 that moves an unsigned transaction between the parties
+// signing it. It commits to the consensus branch ID the signatures are made
+// for.
+type PSBT struct {
+	Tx       *MsgTx
+	BranchID uint32
+	Inputs   []*PSBTInput
+	Outputs  []*PSBTOutput
+}
+
+// SigProgress is the signing progress of a PSBT input.
+type SigProgress struct {
+	Signatures int
+	Required   int
+	Final      bool
+}
+
+// NewPSBT returns a PSBT for the unsigned transaction tx, to be signed for the
+// given consensus branch ID. prevOuts[i] is the output spent by tx.TxIn[i].
+func NewPSBT(tx *MsgTx, prevOuts []*wire.TxOut, branchID uint32) (*PSBT, error) {
+	if len(prevOuts) != len(tx.TxIn) {
+		return nil, fmt.Errorf("got %d previous outputs for %d inputs", len(prevOuts), len(tx.TxIn))
+	}
+	if err := checkUnsignedTx(tx, branchID); err != nil {
+		return nil, err
+	}
+
+	p := &PSBT{
+		Tx:       tx,
+		BranchID: branchID,
+		Inputs:   make([]*PSBTInput, len(tx.TxIn)),
+		Outputs:  make([]*PSBTOutput, len(tx.TxOut)),
+	}
+	for i, prevOut := range prevOuts {
+		p.Inputs[i] = &PSBTInput{Amount: prevOut.Value, PkScript: prevOut.PkScript}
+	}
+	for i := range p.Outputs {
+		p.Outputs[i] = &PSBTOutput{}
+	}
+	return p, nil
+}
+
+// ParsePSBT decodes a PSBT serialized by Serialize.
+func ParsePSBT(r io.Reader) (*PSBT, error) {
+	magic := make([]byte, len(psbtMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, psbtMagic) {
+		return nil, errors.New("psbt: invalid magic")
+	}
+
+	p := &PSBT{}
+	var expiryHeight *uint32
+	err := readPSBTMap(r, func(keyType byte, keyData, value []byte) error {
+		if len(keyData) != 0 {
+			return fmt.Errorf("global key type %d has key data", keyType)
+		}
+		switch keyType {
+		case psbtGlobalUnsignedTx:
+			p.Tx = &MsgTx{MsgTx: wire.NewMsgTx(versionOverwinter)}
+			rd := bytes.NewReader(value)
+			if err := p.Tx.ZecDeserialize(rd); err != nil {
+				return err
+			}
+			if rd.Len() != 0 {
+				return errors.New("trailing bytes after the unsigned transaction")
+			}
+		case psbtGlobalBranchID:
+			v, err := psbtUint32(value)
+			if err != nil {
+				return err
+			}
+			p.BranchID = v
+		case psbtGlobalExpiryHeight:
+			v, err := psbtUint32(value)
+			if err != nil {
+				return err
+			}
+			expiryHeight = &v
+		default:
+			return fmt.Errorf("unknown global key type %d", keyType)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("psbt: %w", err)
+	}
+
+	if p.Tx == nil {
+		return nil, errors.New("psbt: missing unsigned transaction")
+	}
+	if expiryHeight == nil || *expiryHeight != p.Tx.ExpiryHeight {
+		return nil, errors.New("psbt: expiry height does not match the transaction")
+	}
+	if err = checkUnsignedTx(p.Tx, p.BranchID); err != nil {
+		return nil, fmt.Errorf("psbt: %w", err)
+	}
+
+	p.Inputs = make([]*PSBTInput, len(p.Tx.TxIn))
+	for i := range p.Inputs {
+		if p.Inputs[i], err = readPSBTInput(r); err != nil {
+			return nil, fmt.Errorf("psbt: input %d: %w", i, err)
+		}
+	}
+	p.Outputs = make([]*PSBTOutput, len(p.Tx.TxOut))
+	for i := range p.Outputs {
+		if p.Outputs[i], err = readPSBTOutput(r); err != nil {
+			return nil, fmt.Errorf("psbt: output %d: %w", i, err)
+		}
+	}
+
+	return p, nil
+}
+
+// ParsePSBTBase64 decodes a base64 encoded PSBT.
+func ParsePSBTBase64(s string) (*PSBT, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(b)
+	p, err := ParsePSBT(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("psbt: trailing bytes")
+	}
+	return p, nil
+}
+
+// Serialize writes the PSBT to w. Partial signatures and derivations are
+// sorted by public key so that equal PSBTs serialize the same.
+func (p *PSBT) Serialize(w io.Writer) error {
+	if _, err := w.Write(psbtMagic); err != nil {
+		return err
+	}
+
+	var tx bytes.Buffer
+	if err := p.Tx.ZecSerialize(&tx); err != nil {
+		return err
+	}
+	err := writePSBTRecords(w,
+		psbtRecord(psbtGlobalUnsignedTx, nil, tx.Bytes()),
+		psbtRecord(psbtGlobalBranchID, nil, psbtUint32Bytes(p.BranchID)),
+		psbtRecord(psbtGlobalExpiryHeight, nil, psbtUint32Bytes(p.Tx.ExpiryHeight)),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, in := range p.Inputs {
+		if err = in.serialize(w); err != nil {
+			return err
+		}
+	}
+	for _, out := range p.Outputs {
+		if err = out.serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Base64 returns the base64 encoding of the serialized PSBT.
+func (p *PSBT) Base64() (string, error) {
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// Sign adds the signatures of input idx that the keys of signer can make to
+// its partial signatures. Signing goes through SignTxOutput with the sighash
+// type of the input. Use KeyDBSigner to sign with in-memory keys.
+func (p *PSBT) Sign(chainParams *Params, idx int, signer Signer) error {
+	if idx < 0 || idx >= len(p.Inputs) {
+		return fmt.Errorf("psbt: no input %d", idx)
+	}
+	in := p.Inputs[idx]
+	if in.FinalScriptSig != nil {
+		return fmt.Errorf("psbt: input %d is finalized", idx)
+	}
+
+	script, err := in.scriptCode()
+	if err != nil {
+		return err
+	}
+	sigHashes, err := p.sigHashes()
+	if err != nil {
+		return err
+	}
+
+	sdb := txscript.ScriptClosure(func(btcutil.Address) ([]byte, error) {
+		return in.RedeemScript, nil
+	})
+	sigScript, err := signTxOutput(chainParams, p.Tx, sigHashes, idx, in.PkScript, in.sigHashType(), signer, sdb, nil, in.Amount)
+	if err != nil {
+		return err
+	}
+
+	pushes, err := txscript.PushedData(sigScript)
+	if err != nil {
+		return err
+	}
+	if txscript.IsPayToScriptHash(in.PkScript) {
+		// Drop the redeem script.
+		pushes = pushes[:len(pushes)-1]
+	}
+
+	// Match the signatures to the public keys that made them.
+	class, addresses, _, err := txscript.ExtractPkScriptAddrs(script, &chainParams.Params)
+	if err != nil {
+		return err
+	}
+	var pubKeys [][]byte
+	switch class {
+	case txscript.PubKeyHashTy:
+		pubKeys, pushes = pushes[1:], pushes[:1]
+	case txscript.MultiSigTy:
+		for _, addr := range addresses {
+			pubKeys = append(pubKeys, addr.ScriptAddress())
+		}
+	}
+
+	for _, sig := range pushes {
+		for _, pubKey := range pubKeys {
+			valid, err := checkSig(p.Tx, sigHashes, idx, script, in.Amount, sig, pubKey)
+			if err != nil {
+				return err
+			}
+			if valid {
+				in.addPartialSig(&PartialSig{PubKey: pubKey, Signature: sig})
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// Progress returns the signing progress of each input.
+func (p *PSBT) Progress(chainParams *Params) ([]SigProgress, error) {
+	progress := make([]SigProgress, len(p.Inputs))
+	for i, in := range p.Inputs {
+		if in.FinalScriptSig != nil {
+			progress[i].Final = true
+			continue
+		}
+
+		_, signers, nRequired, err := in.signers(chainParams)
+		if err != nil {
+			return nil, &InputError{Index: i, Err: err}
+		}
+		progress[i].Required = nRequired
+		for _, pubKey := range signers {
+			if in.partialSig(pubKey) != nil {
+				progress[i].Signatures++
+			}
+		}
+	}
+	return progress, nil
+}
+
+// Combine merges the signatures and metadata of other, a PSBT of the same
+// transaction, into p. Conflicting fields are rejected and leave p
+// unchanged.
+func (p *PSBT) Combine(other *PSBT) error {
+	var tx, otherTx bytes.Buffer
+	if err := p.Tx.ZecSerialize(&tx); err != nil {
+		return err
+	}
+	if err := other.Tx.ZecSerialize(&otherTx); err != nil {
+		return err
+	}
+	if !bytes.Equal(tx.Bytes(), otherTx.Bytes()) {
+		return errors.New("psbt: combining different transactions")
+	}
+	if p.BranchID != other.BranchID {
+		return fmt.Errorf("psbt: combining branch id %x with %x", p.BranchID, other.BranchID)
+	}
+	if len(p.Inputs) != len(other.Inputs) || len(p.Outputs) != len(other.Outputs) {
+		return errors.New("psbt: combining different numbers of inputs or outputs")
+	}
+
+	for i, in := range p.Inputs {
+		o := other.Inputs[i]
+		if in.Amount != o.Amount || !bytes.Equal(in.PkScript, o.PkScript) {
+			return fmt.Errorf("psbt: input %d spends different outputs", i)
+		}
+		if in.RedeemScript != nil && o.RedeemScript != nil && !bytes.Equal(in.RedeemScript, o.RedeemScript) {
+			return fmt.Errorf("psbt: input %d has different redeem scripts", i)
+		}
+		if in.SigHashType != 0 && o.SigHashType != 0 && in.SigHashType != o.SigHashType {
+			return fmt.Errorf("psbt: input %d has different sighash types", i)
+		}
+		for _, sig := range o.PartialSigs {
+			if known := in.partialSig(sig.PubKey); known != nil && !bytes.Equal(known.Signature, sig.Signature) {
+				return fmt.Errorf("psbt: input %d has different signatures of public key %x", i, sig.PubKey)
+			}
+		}
+	}
+	for i, out := range p.Outputs {
+		o := other.Outputs[i]
+		if out.RedeemScript != nil && o.RedeemScript != nil && !bytes.Equal(out.RedeemScript, o.RedeemScript) {
+			return fmt.Errorf("psbt: output %d has different redeem scripts", i)
+		}
+	}
+
+	for i, in := range p.Inputs {
+		in.combine(other.Inputs[i])
+	}
+	for i, out := range p.Outputs {
+		o := other.Outputs[i]
+		if out.RedeemScript == nil {
+			out.RedeemScript = o.RedeemScript
+		}
+		out.Bip32Derivation = mergeDerivations(out.Bip32Derivation, o.Bip32Derivation)
+	}
+	return nil
+}
+
+// Finalize builds the signature script of every input from its partial
+// signatures. Only P2PKH and bare or P2SH multisig inputs are supported.
+func (p *PSBT) Finalize(chainParams *Params) error {
+	for i, in := range p.Inputs {
+		if in.FinalScriptSig != nil {
+			continue
+		}
+		if err := in.finalize(chainParams); err != nil {
+			return fmt.Errorf("psbt: %w", &InputError{Index: i, Err: err})
+		}
+	}
+	return nil
+}
+
+// Extract returns the signed transaction of a finalized PSBT, after checking
+// that its scripts verify.
+func (p *PSBT) Extract() (*MsgTx, error) {
+	var buf bytes.Buffer
+	if err := p.Tx.ZecSerialize(&buf); err != nil {
+		return nil, err
+	}
+	tx := &MsgTx{MsgTx: wire.NewMsgTx(versionOverwinter)}
+	if err := tx.ZecDeserialize(&buf); err != nil {
+		return nil, err
+	}
+
+	for i, in := range p.Inputs {
+		if in.FinalScriptSig == nil {
+			return nil, fmt.Errorf("psbt: input %d is not finalized", i)
+		}
+		tx.TxIn[i].SignatureScript = in.FinalScriptSig
+	}
+	if err := VerifyTx(tx, p.prevOuts(), p.BranchID); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// prevOuts returns the outputs spent by the inputs.
+func (p *PSBT) prevOuts() []*wire.TxOut {
+	prevOuts := make([]*wire.TxOut, len(p.Inputs))
+	for i, in := range p.Inputs {
+		prevOuts[i] = wire.NewTxOut(in.Amount, in.PkScript)
+	}
+	return prevOuts
+}
+
+// sigHashes computes the sighash midstate of the transaction.
+func (p *PSBT) sigHashes() (*TxSigHashes, error) {
+	return newTxSigHashesForBranch(p.Tx, p.prevOuts(), p.BranchID)
+}
+
+// sigHashType returns the hash type signers use for the input.
+func (in *PSBTInput) sigHashType() txscript.SigHashType {
+	if in.SigHashType == 0 {
+		return txscript.SigHashAll
+	}
+	return in.SigHashType
+}
+
+// scriptCode returns the script the signatures of the input commit to, the
+// redeem script for P2SH outputs.
+func (in *PSBTInput) scriptCode() ([]byte, error) {
+	if !txscript.IsPayToScriptHash(in.PkScript) {
+		return in.PkScript, nil
+	}
+	if in.RedeemScript == nil {
+		return nil, errors.New("missing redeem script")
+	}
+	if !bytes.Equal(btcutil.Hash160(in.RedeemScript), in.PkScript[2:22]) {
+		return nil, errors.New("redeem script does not match the script hash")
+	}
+	return in.RedeemScript, nil
+}
+
+// signers returns the script class of the input, the public keys that may
+// sign it and the number of signatures required. For P2PKH outputs the public
+// key is only known once a partial signature provides it.
+func (in *PSBTInput) signers(chainParams *Params) (txscript.ScriptClass, [][]byte, int, error) {
+	script, err := in.scriptCode()
+	if err != nil {
+		return txscript.NonStandardTy, nil, 0, err
+	}
+	class, addresses, nRequired, err := txscript.ExtractPkScriptAddrs(script, &chainParams.Params)
+	if err != nil {
+		return class, nil, 0, err
+	}
+
+	switch class {
+	case txscript.PubKeyHashTy:
+		for _, sig := range in.PartialSigs {
+			if bytes.Equal(btcutil.Hash160(sig.PubKey), addresses[0].ScriptAddress()) {
+				return class, [][]byte{sig.PubKey}, 1, nil
+			}
+		}
+		return class, nil, 1, nil
+	case txscript.MultiSigTy:
+		pubKeys := make([][]byte, len(addresses))
+		for i, addr := range addresses {
+			pubKeys[i] = addr.ScriptAddress()
+		}
+		return class, pubKeys, nRequired, nil
+	}
+	return class, nil, 0, fmt.Errorf("unsupported script class %v", class)
+}
+
+// finalize sets the signature script of the input from its partial
+// signatures and clears them.
+func (in *PSBTInput) finalize(chainParams *Params) error {
+	class, signers, nRequired, err := in.signers(chainParams)
+	if err != nil {
+		return err
+	}
+
+	builder := txscript.NewScriptBuilder()
+	if class == txscript.MultiSigTy {
+		// Extra argument consumed by OP_CHECKMULTISIG.
+		builder.AddOp(txscript.OP_FALSE)
+	}
+
+	// Signatures are pushed in the order of the public keys of the script.
+	signatures := 0
+	for _, pubKey := range signers {
+		if signatures == nRequired {
+			break
+		}
+		if sig := in.partialSig(pubKey); sig != nil {
+			builder.AddData(sig.Signature)
+			signatures++
+		}
+	}
+	if signatures < nRequired {
+		return fmt.Errorf("%d of %d signatures", signatures, nRequired)
+	}
+
+	if class == txscript.PubKeyHashTy {
+		builder.AddData(signers[0])
+	}
+	if txscript.IsPayToScriptHash(in.PkScript) {
+		builder.AddData(in.RedeemScript)
+	}
+
+	sigScript, err := builder.Script()
+	if err != nil {
+		return err
+	}
+
+	in.FinalScriptSig = sigScript
+	in.RedeemScript = nil
+	in.PartialSigs = nil
+	in.Bip32Derivation = nil
+	in.SigHashType = 0
+	return nil
+}
+
+// partialSig returns the partial signature of pubKey, nil if there is none.
+func (in *PSBTInput) partialSig(pubKey []byte) *PartialSig {
+	for _, sig := range in.PartialSigs {
+		if bytes.Equal(sig.PubKey, pubKey) {
+			return sig
+		}
+	}
+	return nil
+}
+
+// addPartialSig adds sig unless the input has a signature of its public key.
+func (in *PSBTInput) addPartialSig(sig *PartialSig) {
+	if in.partialSig(sig.PubKey) == nil {
+		in.PartialSigs = append(in.PartialSigs, sig)
+	}
+}
+
+// combine merges the fields of o that in lacks. The callers checked that
+// the fields set in both do not conflict.
+func (in *PSBTInput) combine(o *PSBTInput) {
+	if in.FinalScriptSig != nil {
+		return
+	}
+	if o.FinalScriptSig != nil {
+		*in = *o
+		return
+	}
+
+	if in.RedeemScript == nil {
+		in.RedeemScript = o.RedeemScript
+	}
+	if in.SigHashType == 0 {
+		in.SigHashType = o.SigHashType
+	}
+	for _, sig := range o.PartialSigs {
+		in.addPartialSig(sig)
+	}
+	in.Bip32Derivation = mergeDerivations(in.Bip32Derivation, o.Bip32Derivation)
+}
+
+// mergeDerivations adds the derivations of b whose public keys are not in a.
+func mergeDerivations(a, b []*Bip32Derivation) []*Bip32Derivation {
+next:
+	for _, d := range b {
+		for _, known := range a {
+			if bytes.Equal(known.PubKey, d.PubKey) {
+				continue next
+			}
+		}
+		a = append(a, d)
+	}
+	return a
+}
+
+// serialize writes the input map to w.
+func (in *PSBTInput) serialize(w io.Writer) error {
+	var prevOut bytes.Buffer
+	if err := WriteTxOut(&prevOut, 0, 0, wire.NewTxOut(in.Amount, in.PkScript)); err != nil {
+		return err
+	}
+
+	records := []*psbtKV{psbtRecord(psbtInPrevOut, nil, prevOut.Bytes())}
+	if in.RedeemScript != nil {
+		records = append(records, psbtRecord(psbtInRedeemScript, nil, in.RedeemScript))
+	}
+
+	sigs := append([]*PartialSig(nil), in.PartialSigs...)
+	sort.Slice(sigs, func(i, j int) bool {
+		return bytes.Compare(sigs[i].PubKey, sigs[j].PubKey) < 0
+	})
+	for _, sig := range sigs {
+		records = append(records, psbtRecord(psbtInPartialSig, sig.PubKey, sig.Signature))
+	}
+
+	if in.SigHashType != 0 {
+		records = append(records, psbtRecord(psbtInSigHashType, nil, psbtUint32Bytes(uint32(in.SigHashType))))
+	}
+	records = append(records, derivationRecords(psbtInBip32Derivation, in.Bip32Derivation)...)
+	if in.FinalScriptSig != nil {
+		records = append(records, psbtRecord(psbtInFinalScriptSig, nil, in.FinalScriptSig))
+	}
+
+	return writePSBTRecords(w, records...)
+}
+
+// serialize writes the output map to w.
+func (out *PSBTOutput) serialize(w io.Writer) error {
+	var records []*psbtKV
+	if out.RedeemScript != nil {
+		records = append(records, psbtRecord(psbtOutRedeemScript, nil, out.RedeemScript))
+	}
+	records = append(records, derivationRecords(psbtOutBip32Derivation, out.Bip32Derivation)...)
+
+	return writePSBTRecords(w, records...)
+}
+
+// readPSBTInput reads an input map.
+func readPSBTInput(r io.Reader) (*PSBTInput, error) {
+	in := &PSBTInput{}
+	var hasPrevOut bool
+	err := readPSBTMap(r, func(keyType byte, keyData, value []byte) error {
+		if keyType != psbtInPartialSig && keyType != psbtInBip32Derivation && len(keyData) != 0 {
+			return fmt.Errorf("input key type %d has key data", keyType)
+		}
+
+		switch keyType {
+		case psbtInPrevOut:
+			rd := bytes.NewReader(value)
+			prevOut, err := readTxOutZec(rd)
+			if err != nil {
+				return err
+			}
+			if rd.Len() != 0 {
+				return errors.New("trailing bytes after the previous output")
+			}
+			in.Amount, in.PkScript = prevOut.Value, prevOut.PkScript
+			hasPrevOut = true
+		case psbtInRedeemScript:
+			in.RedeemScript = value
+		case psbtInPartialSig:
+			if _, err := btcec.ParsePubKey(keyData); err != nil {
+				return err
+			}
+			in.PartialSigs = append(in.PartialSigs, &PartialSig{PubKey: keyData, Signature: value})
+		case psbtInSigHashType:
+			v, err := psbtUint32(value)
+			if err != nil {
+				return err
+			}
+			in.SigHashType = txscript.SigHashType(v)
+		case psbtInBip32Derivation:
+			d, err := parseDerivation(keyData, value)
+			if err != nil {
+				return err
+			}
+			in.Bip32Derivation = append(in.Bip32Derivation, d)
+		case psbtInFinalScriptSig:
+			in.FinalScriptSig = value
+		default:
+			return fmt.Errorf("unknown input key type %d", keyType)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !hasPrevOut {
+		return nil, errors.New("missing previous output")
+	}
+	return in, nil
+}
+
+// readPSBTOutput reads an output map.
+func readPSBTOutput(r io.Reader) (*PSBTOutput, error) {
+	out := &PSBTOutput{}
+	err := readPSBTMap(r, func(keyType byte, keyData, value []byte) error {
+		switch {
+		case keyType == psbtOutRedeemScript && len(keyData) == 0:
+			out.RedeemScript = value
+		case keyType == psbtOutBip32Derivation:
+			d, err := parseDerivation(keyData, value)
+			if err != nil {
+				return err
+			}
+			out.Bip32Derivation = append(out.Bip32Derivation, d)
+		default:
+			return fmt.Errorf("invalid output key type %d", keyType)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// checkUnsignedTx checks that tx can be signed for branchID and carries no
+// signature yet.
+func checkUnsignedTx(tx *MsgTx, branchID uint32) error {
+	if tx.Version < versionOverwinter {
+		return fmt.Errorf("signing v%d transactions is not supported", tx.Version)
+	}
+	if tx.Version == versionNU5 && tx.ConsensusBranchID != branchID {
+		return fmt.Errorf("transaction branch id %x does not match %x", tx.ConsensusBranchID, branchID)
+	}
+	for i, in := range tx.TxIn {
+		if len(in.SignatureScript) != 0 {
+			return fmt.Errorf("input %d is signed", i)
+		}
+	}
+	return nil
+}
+
+// psbtKV is a record of a PSBT key-value map.
+type psbtKV struct {
+	key, value []byte
+}
+
+// psbtRecord returns the record of the given key type and data.
+func psbtRecord(keyType byte, keyData, value []byte) *psbtKV {
+	return &psbtKV{key: append([]byte{keyType}, keyData...), value: value}
+}
+
+// writePSBTRecords writes a key-value map terminated by its separator.
+func writePSBTRecords(w io.Writer, records ...*psbtKV) error {
+	for _, kv := range records {
+		if err := WriteVarBytes(w, 0, kv.key); err != nil {
+			return err
+		}
+		if err := WriteVarBytes(w, 0, kv.value); err != nil {
+			return err
+		}
+	}
+	return binarySerializer.PutUint8(w, 0)
+}
+
+// readPSBTMap reads the records of a key-value map up to its separator and
+// passes them to set. Duplicate keys are rejected.
+func readPSBTMap(r io.Reader, set func(keyType byte, keyData, value []byte) error) error {
+	seen := make(map[string]bool)
+	for {
+		key, err := ReadVarBytes(r, 0, psbtMaxKeySize)
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			return nil
+		}
+		if seen[string(key)] {
+			return fmt.Errorf("duplicate key %x", key)
+		}
+		seen[string(key)] = true
+
+		value, err := ReadVarBytes(r, 0, maxTxSize)
+		if err != nil {
+			return err
+		}
+		if err = set(key[0], key[1:], value); err != nil {
+			return err
+		}
+	}
+}
+
+// derivationRecords returns the records of the derivations, sorted by public
+// key.
+func derivationRecords(keyType byte, derivations []*Bip32Derivation) []*psbtKV {
+	sorted := append([]*Bip32Derivation(nil), derivations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].PubKey, sorted[j].PubKey) < 0
+	})
+
+	records := make([]*psbtKV, len(sorted))
+	for i, d := range sorted {
+		value := psbtUint32Bytes(d.MasterKeyFingerprint)
+		for _, level := range d.Path {
+			value = append(value, psbtUint32Bytes(level)...)
+		}
+		records[i] = psbtRecord(keyType, d.PubKey, value)
+	}
+	return records
+}
+
+// parseDerivation decodes the derivation of the public key pubKey.
+func parseDerivation(pubKey, value []byte) (*Bip32Derivation, error) {
+	if _, err := btcec.ParsePubKey(pubKey); err != nil {
+		return nil, err
+	}
+	if len(value) == 0 || len(value)%4 != 0 {
+		return nil, errors.New("invalid bip32 derivation")
+	}
+
+	d := &Bip32Derivation{
+		PubKey:               pubKey,
+		MasterKeyFingerprint: binary.LittleEndian.Uint32(value),
+		Path:                 make([]uint32, 0, len(value)/4-1),
+	}
+	for i := 4; i < len(value); i += 4 {
+		d.Path = append(d.Path, binary.LittleEndian.Uint32(value[i:]))
+	}
+	return d, nil
+}
+
+// psbtUint32 decodes a little endian uint32 value.
+func psbtUint32(value []byte) (uint32, error) {
+	if len(value) != 4 {
+		return 0, fmt.Errorf("invalid uint32 value %x", value)
+	}
+	return binary.LittleEndian.Uint32(value), nil
+}
+
+// psbtUint32Bytes encodes v as a little endian uint32 value.
+func psbtUint32Bytes(v uint32) []byte {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	return b[:]
+}
@@ -0,0 +1,222 @@
+package zecutil
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestPSBT(t *testing.T) {
+	store, pubKeys := newTestKeyStore(t, 3)
+	if _, err := store.ImportWIF(testWif); err != nil {
+		t.Fatal(err)
+	}
+	cosigner := func(i int) Signer {
+		return KeyDBSigner(txscript.KeyClosure(func(a btcutil.Address) (*btcec.PrivateKey, bool, error) {
+			if !bytes.Equal(a.ScriptAddress(), pubKeys[i].ScriptAddress()) {
+				return nil, false, ErrKeyNotFound
+			}
+			return store.GetKey(a)
+		}))
+	}
+
+	redeemScript, err := txscript.MultiSigScript(pubKeys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptAddr, err := btcutil.NewAddressScriptHash(redeemScript, &netParams.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2shScript, err := txscript.PayToAddrScript(scriptAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pkhScript := mustDecodeHex(t, "76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac")
+
+	tx := &MsgTx{MsgTx: wire.NewMsgTx(versionNU5), ExpiryHeight: 3000040, ConsensusBranchID: NU5BranchID}
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, nil, nil))
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{2}, Index: 1}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(180000, p2shScript))
+	prevOuts := []*wire.TxOut{wire.NewTxOut(100000, p2shScript), wire.NewTxOut(100000, p2pkhScript)}
+
+	p, err := NewPSBT(tx, prevOuts, NU5BranchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := BIP44Path(netParams, 0, 0, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Inputs[0].RedeemScript = redeemScript
+	p.Inputs[0].Bip32Derivation = []*Bip32Derivation{{
+		PubKey:               pubKeys[0].ScriptAddress(),
+		MasterKeyFingerprint: 0xdeadbeef,
+		Path:                 path,
+	}}
+	p.Outputs[0].RedeemScript = redeemScript
+	unsigned, err := p.Base64()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each party signs its own copy.
+	parse := func(s string) *PSBT {
+		p, err := ParsePSBTBase64(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	alice, bob := parse(unsigned), parse(unsigned)
+	if !reflect.DeepEqual(alice.Inputs, p.Inputs) || !reflect.DeepEqual(alice.Outputs, p.Outputs) ||
+		alice.Tx.TxHash() != tx.TxHash() {
+
+		t.Fatal("psbt does not round-trip")
+	}
+	if err = alice.Sign(netParams, 0, cosigner(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err = alice.Sign(netParams, 1, KeyDBSigner(store)); err != nil {
+		t.Fatal(err)
+	}
+	if err = bob.Sign(netParams, 0, cosigner(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	progress, err := alice.Progress(netParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SigProgress{{Signatures: 1, Required: 2}, {Signatures: 1, Required: 1}}
+	if !reflect.DeepEqual(progress, want) {
+		t.Fatalf("got progress %+v, want %+v", progress, want)
+	}
+	if err = parse(unsigned).Finalize(netParams); err == nil {
+		t.Fatal("expected error finalizing without signatures")
+	}
+
+	// Partial signatures survive serialization.
+	signed, err := alice.Base64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice = parse(signed)
+	if again, _ := alice.Base64(); again != signed {
+		t.Fatal("partially signed psbt does not round-trip")
+	}
+
+	other := parse(unsigned)
+	other.BranchID = SaplingBranchID
+	if err = alice.Combine(other); err == nil {
+		t.Fatal("expected error combining another branch id")
+	}
+	other = parse(unsigned)
+	other.Inputs[0].RedeemScript = p2pkhScript
+	if err = alice.Combine(other); err == nil {
+		t.Fatal("expected error combining another redeem script")
+	}
+
+	other = parse(unsigned)
+	other.Inputs = other.Inputs[:1]
+	if err = alice.Combine(other); err == nil {
+		t.Fatal("expected error combining fewer inputs")
+	}
+	other = parse(unsigned)
+	other.Outputs = append(other.Outputs, &PSBTOutput{})
+	if err = alice.Combine(other); err == nil {
+		t.Fatal("expected error combining more outputs")
+	}
+	other = parse(signed)
+	sig := other.Inputs[0].PartialSigs[0]
+	sig.Signature = append(sig.Signature[:len(sig.Signature)-1], byte(txscript.SigHashNone))
+	if err = alice.Combine(other); err == nil {
+		t.Fatal("expected error combining another signature of the same key")
+	}
+
+	if err = alice.Combine(bob); err != nil {
+		t.Fatal(err)
+	}
+	if progress, _ = alice.Progress(netParams); progress[0].Signatures != 2 {
+		t.Fatalf("got progress %+v after combining", progress)
+	}
+	if err = alice.Finalize(netParams); err != nil {
+		t.Fatal(err)
+	}
+	if progress, _ = alice.Progress(netParams); !progress[0].Final || !progress[1].Final {
+		t.Fatalf("got progress %+v after finalizing", progress)
+	}
+
+	final, err := alice.Base64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedTx, err := parse(final).Extract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyTx(signedTx, prevOuts, NU5BranchID); err != nil {
+		t.Fatal(err)
+	}
+	if signedTx.TxHash() != tx.TxHash() {
+		t.Fatal("signatures changed the txid")
+	}
+	if len(tx.TxIn[0].SignatureScript) != 0 {
+		t.Fatal("extract modified the unsigned transaction")
+	}
+
+	// A corrupted signature is caught when extracting.
+	alice.Inputs[1].FinalScriptSig[5] ^= 1
+	if _, err = alice.Extract(); err == nil {
+		t.Fatal("expected error extracting an invalid signature")
+	}
+}
+
+func TestParsePSBTInvalid(t *testing.T) {
+	tx := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling), ExpiryHeight: 300040}
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, mustDecodeHex(t, "76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac")))
+	prevOuts := []*wire.TxOut{wire.NewTxOut(2000, tx.TxOut[0].PkScript)}
+
+	p, err := NewPSBT(tx, prevOuts, SaplingBranchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = p.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.Bytes()
+
+	if _, err = ParsePSBT(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(raw); i++ {
+		if _, err = ParsePSBT(bytes.NewReader(raw[:i])); err == nil {
+			t.Fatalf("expected error for %d truncated bytes", len(raw)-i)
+		}
+	}
+
+	badMagic := append([]byte{'b'}, raw[1:]...)
+	if _, err = ParsePSBT(bytes.NewReader(badMagic)); err == nil {
+		t.Fatal("expected error for invalid magic")
+	}
+
+	// The branch id record is followed by a duplicate.
+	i := bytes.Index(raw, []byte{1, psbtGlobalBranchID, 4})
+	dup := append(append(append([]byte(nil), raw[:i+7]...), raw[i:i+7]...), raw[i+7:]...)
+	if _, err = ParsePSBT(bytes.NewReader(dup)); err == nil {
+		t.Fatal("expected error for a duplicate key")
+	}
+
+	tx.TxIn[0].SignatureScript = []byte{txscript.OP_TRUE}
+	if _, err = NewPSBT(tx, prevOuts, SaplingBranchID); err == nil {
+		t.Fatal("expected error for a signed transaction")
+	}
+}
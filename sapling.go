@@ -0,0 +1,269 @@
+package zecutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// saplingProofSize is the size of a Groth16 proof over BLS12-381.
+	saplingProofSize = 192
+
+	// saplingEncCiphertextSize is the size of the note plaintext ciphertext
+	// carried by an output, including the 512-byte memo.
+	saplingEncCiphertextSize = 580
+
+	// saplingOutCiphertextSize is the size of the outgoing ciphertext that
+	// allows the sender to recover the note.
+	saplingOutCiphertextSize = 80
+
+	// maxSaplingDescriptions is the exclusive upper bound ZIP-225 places on
+	// nSpendsSapling and nOutputsSapling.
+	maxSaplingDescriptions = 1 << 16
+)
+
+// SpendDescription is a Sapling shielded spend.
+//
+// In v4 transactions every spend carries its own anchor, in v5 transactions
+// the anchor is shared by all spends and is copied into each description on
+// decode.
+type SpendDescription struct {
+	Cv           [32]byte
+	Anchor       [32]byte
+	Nullifier    [32]byte
+	Rk           [32]byte
+	ZkProof      [saplingProofSize]byte
+	SpendAuthSig [64]byte
+}
+
+// OutputDescription is a Sapling shielded output.
+type OutputDescription struct {
+	Cv            [32]byte
+	Cmu           [32]byte
+	EphemeralKey  [32]byte
+	EncCiphertext [saplingEncCiphertextSize]byte
+	OutCiphertext [saplingOutCiphertextSize]byte
+	ZkProof       [saplingProofSize]byte
+}
+
+// hasSapling reports whether the transaction has a non-empty Sapling bundle.
+func (msg *MsgTx) hasSapling() bool {
+	return len(msg.ShieldedSpends) > 0 || len(msg.ShieldedOutputs) > 0
+}
+
+// writeSaplingV4 encodes valueBalance and the Sapling spend and output
+// descriptions of a v4 transaction. The binding signature follows the
+// JoinSplits and is written by the caller.
+func (msg *MsgTx) writeSaplingV4(w io.Writer, pver uint32) error {
+	if err := binarySerializer.PutUint64(w, littleEndian, uint64(msg.ValueBalance)); err != nil {
+		return err
+	}
+
+	if err := WriteVarInt(w, pver, uint64(len(msg.ShieldedSpends))); err != nil {
+		return err
+	}
+	for _, sd := range msg.ShieldedSpends {
+		err := writeBytes(w, sd.Cv[:], sd.Anchor[:], sd.Nullifier[:], sd.Rk[:], sd.ZkProof[:], sd.SpendAuthSig[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := WriteVarInt(w, pver, uint64(len(msg.ShieldedOutputs))); err != nil {
+		return err
+	}
+	for _, od := range msg.ShieldedOutputs {
+		err := writeBytes(w, od.Cv[:], od.Cmu[:], od.EphemeralKey[:], od.EncCiphertext[:], od.OutCiphertext[:],
+			od.ZkProof[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readSaplingV4 decodes valueBalance and the Sapling spend and output
+// descriptions of a v4 transaction.
+func (msg *MsgTx) readSaplingV4(r io.Reader, pver uint32) error {
+	if err := binary.Read(r, binary.LittleEndian, &msg.ValueBalance); err != nil {
+		return err
+	}
+
+	nSpends, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if nSpends >= maxSaplingDescriptions {
+		return fmt.Errorf("too many sapling spends: %d", nSpends)
+	}
+	msg.ShieldedSpends = make([]*SpendDescription, 0, nSpends)
+	for i := uint64(0); i < nSpends; i++ {
+		sd := &SpendDescription{}
+		err = readBytes(r, sd.Cv[:], sd.Anchor[:], sd.Nullifier[:], sd.Rk[:], sd.ZkProof[:], sd.SpendAuthSig[:])
+		if err != nil {
+			return err
+		}
+		msg.ShieldedSpends = append(msg.ShieldedSpends, sd)
+	}
+
+	nOutputs, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if nOutputs >= maxSaplingDescriptions {
+		return fmt.Errorf("too many sapling outputs: %d", nOutputs)
+	}
+	msg.ShieldedOutputs = make([]*OutputDescription, 0, nOutputs)
+	for i := uint64(0); i < nOutputs; i++ {
+		od := &OutputDescription{}
+		err = readBytes(r, od.Cv[:], od.Cmu[:], od.EphemeralKey[:], od.EncCiphertext[:], od.OutCiphertext[:],
+			od.ZkProof[:])
+		if err != nil {
+			return err
+		}
+		msg.ShieldedOutputs = append(msg.ShieldedOutputs, od)
+	}
+
+	return nil
+}
+
+// writeSaplingV5 encodes the Sapling bundle using the v5 (ZIP-225) layout.
+func (msg *MsgTx) writeSaplingV5(w io.Writer, pver uint32) error {
+	nSpends, nOutputs := len(msg.ShieldedSpends), len(msg.ShieldedOutputs)
+
+	if err := WriteVarInt(w, pver, uint64(nSpends)); err != nil {
+		return err
+	}
+	for _, sd := range msg.ShieldedSpends {
+		if err := writeBytes(w, sd.Cv[:], sd.Nullifier[:], sd.Rk[:]); err != nil {
+			return err
+		}
+	}
+
+	if err := WriteVarInt(w, pver, uint64(nOutputs)); err != nil {
+		return err
+	}
+	for _, od := range msg.ShieldedOutputs {
+		err := writeBytes(w, od.Cv[:], od.Cmu[:], od.EphemeralKey[:], od.EncCiphertext[:], od.OutCiphertext[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	if nSpends+nOutputs == 0 {
+		return nil
+	}
+
+	if err := binarySerializer.PutUint64(w, littleEndian, uint64(msg.ValueBalance)); err != nil {
+		return err
+	}
+
+	if nSpends > 0 {
+		anchor := msg.ShieldedSpends[0].Anchor
+		for _, sd := range msg.ShieldedSpends[1:] {
+			if sd.Anchor != anchor {
+				return errors.New("v5 sapling spends must share a single anchor")
+			}
+		}
+		if _, err := w.Write(anchor[:]); err != nil {
+			return err
+		}
+	}
+
+	for _, sd := range msg.ShieldedSpends {
+		if _, err := w.Write(sd.ZkProof[:]); err != nil {
+			return err
+		}
+	}
+	for _, sd := range msg.ShieldedSpends {
+		if _, err := w.Write(sd.SpendAuthSig[:]); err != nil {
+			return err
+		}
+	}
+	for _, od := range msg.ShieldedOutputs {
+		if _, err := w.Write(od.ZkProof[:]); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(msg.BindingSig[:])
+	return err
+}
+
+// readSaplingV5 decodes the Sapling bundle using the v5 (ZIP-225) layout.
+func (msg *MsgTx) readSaplingV5(r io.Reader, pver uint32) error {
+	nSpends, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if nSpends >= maxSaplingDescriptions {
+		return fmt.Errorf("too many sapling spends: %d", nSpends)
+	}
+	msg.ShieldedSpends = make([]*SpendDescription, 0, nSpends)
+	for i := uint64(0); i < nSpends; i++ {
+		sd := &SpendDescription{}
+		if err = readBytes(r, sd.Cv[:], sd.Nullifier[:], sd.Rk[:]); err != nil {
+			return err
+		}
+		msg.ShieldedSpends = append(msg.ShieldedSpends, sd)
+	}
+
+	nOutputs, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if nOutputs >= maxSaplingDescriptions {
+		return fmt.Errorf("too many sapling outputs: %d", nOutputs)
+	}
+	msg.ShieldedOutputs = make([]*OutputDescription, 0, nOutputs)
+	for i := uint64(0); i < nOutputs; i++ {
+		od := &OutputDescription{}
+		err = readBytes(r, od.Cv[:], od.Cmu[:], od.EphemeralKey[:], od.EncCiphertext[:], od.OutCiphertext[:])
+		if err != nil {
+			return err
+		}
+		msg.ShieldedOutputs = append(msg.ShieldedOutputs, od)
+	}
+
+	msg.ValueBalance = 0
+	msg.BindingSig = [64]byte{}
+	if nSpends+nOutputs == 0 {
+		return nil
+	}
+
+	if err = binary.Read(r, binary.LittleEndian, &msg.ValueBalance); err != nil {
+		return err
+	}
+
+	if nSpends > 0 {
+		var anchor [32]byte
+		if _, err = io.ReadFull(r, anchor[:]); err != nil {
+			return err
+		}
+		for _, sd := range msg.ShieldedSpends {
+			sd.Anchor = anchor
+		}
+	}
+
+	for _, sd := range msg.ShieldedSpends {
+		if _, err = io.ReadFull(r, sd.ZkProof[:]); err != nil {
+			return err
+		}
+	}
+	for _, sd := range msg.ShieldedSpends {
+		if _, err = io.ReadFull(r, sd.SpendAuthSig[:]); err != nil {
+			return err
+		}
+	}
+	for _, od := range msg.ShieldedOutputs {
+		if _, err = io.ReadFull(r, od.ZkProof[:]); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.ReadFull(r, msg.BindingSig[:])
+	return err
+}
@@ -0,0 +1,121 @@
+package zecutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// saplingDiversifierSize is the size of the diversifier of a Sapling payment
+// address.
+const saplingDiversifierSize = 11
+
+// SaplingAddress is a Sapling shielded payment address made of a diversifier
+// and the diversified transmission key pk_d.
+type SaplingAddress struct {
+	diversifier [saplingDiversifierSize]byte
+	pkd         [32]byte
+	net         *Params
+}
+
+// NewSaplingAddress returns a Sapling payment address for the given network.
+// pkd must encode a point of the prime-order subgroup of Jubjub other than
+// the identity.
+func NewSaplingAddress(diversifier [saplingDiversifierSize]byte, pkd [32]byte, net *Params) (*SaplingAddress, error) {
+	if net == nil || net.SaplingPaymentAddressHRP == "" {
+		return nil, errors.New("unknown network parameters")
+	}
+
+	p, err := decodeJubjubPoint(pkd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pk_d: %w", err)
+	}
+	if p.isIdentity() || !p.inPrimeSubgroup() {
+		return nil, errors.New("invalid pk_d: not in the prime-order subgroup")
+	}
+
+	return &SaplingAddress{diversifier: diversifier, pkd: pkd, net: net}, nil
+}
+
+// DecodeSaplingAddress decodes a Bech32 encoded Sapling payment address for
+// the given network.
+func DecodeSaplingAddress(address string, net *Params) (*SaplingAddress, error) {
+	if net == nil || net.SaplingPaymentAddressHRP == "" {
+		return nil, errors.New("unknown network parameters")
+	}
+
+	// The regtest HRP makes addresses longer than the 90 characters allowed
+	// by BIP-173.
+	hrp, data, version, err := bech32.DecodeNoLimitWithVersion(address)
+	if err != nil {
+		return nil, err
+	}
+	if version != bech32.Version0 {
+		return nil, errors.New("sapling address is not bech32 encoded")
+	}
+	if hrp != net.SaplingPaymentAddressHRP {
+		return nil, fmt.Errorf("sapling address hrp %q is not for %s", hrp, net.Name)
+	}
+
+	raw, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != shieldedReceiverSize {
+		return nil, errors.New("incorrect payload len")
+	}
+
+	var (
+		diversifier [saplingDiversifierSize]byte
+		pkd         [32]byte
+	)
+	copy(diversifier[:], raw[:saplingDiversifierSize])
+	copy(pkd[:], raw[saplingDiversifierSize:])
+
+	return NewSaplingAddress(diversifier, pkd, net)
+}
+
+// Diversifier returns the diversifier of the address.
+func (a *SaplingAddress) Diversifier() [saplingDiversifierSize]byte {
+	return a.diversifier
+}
+
+// Pkd returns the encoding of the diversified transmission key of the
+// address.
+func (a *SaplingAddress) Pkd() [32]byte {
+	return a.pkd
+}
+
+// EncodeAddress returns the Bech32 encoding of the Sapling payment address.
+// Part of the Address interface.
+func (a *SaplingAddress) EncodeAddress() string {
+	data, err := bech32.ConvertBits(a.ScriptAddress(), 8, 5, true)
+	if err != nil {
+		return ""
+	}
+	addr, _ := bech32.Encode(a.net.SaplingPaymentAddressHRP, data)
+	return addr
+}
+
+// ScriptAddress returns the raw 43-byte payment address. Sapling addresses
+// can't be paid with a transparent script. Part of the Address interface.
+func (a *SaplingAddress) ScriptAddress() []byte {
+	raw := make([]byte, 0, shieldedReceiverSize)
+	raw = append(raw, a.diversifier[:]...)
+	return append(raw, a.pkd[:]...)
+}
+
+// IsForNet returns whether or not the Sapling payment address is associated
+// with the passed network.
+func (a *SaplingAddress) IsForNet(net *chaincfg.Params) bool {
+	return a.net.Name == net.Name
+}
+
+// String returns a human-readable string for the Sapling payment address.
+// This is equivalent to calling EncodeAddress, but is provided so the type can
+// be used as a fmt.Stringer.
+func (a *SaplingAddress) String() string {
+	return a.EncodeAddress()
+}
@@ -0,0 +1,111 @@
+package zecutil
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+const testSaplingAddr = "zs1z7rejlpsa98s2rrrfkwmaxu53e4ue0ulcrw0h4x5g8jl04tak0d3mm47vdtahatqrlkngh9slya"
+
+func TestDecodeSaplingAddress(t *testing.T) {
+	addr, err := DecodeSaplingAddress(testSaplingAddr, &MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.EncodeAddress() != testSaplingAddr || addr.String() != testSaplingAddr {
+		t.Fatalf("got %s", addr)
+	}
+	if !addr.IsForNet(&MainNetParams.Params) || addr.IsForNet(&TestNet3Params.Params) {
+		t.Fatal("unexpected network")
+	}
+	if len(addr.ScriptAddress()) != shieldedReceiverSize {
+		t.Fatalf("got %d bytes", len(addr.ScriptAddress()))
+	}
+	var _ btcutil.Address = addr
+	if _, err = PayToAddrScript(addr); err == nil {
+		t.Fatal("expected error paying a sapling address with a transparent script")
+	}
+
+	if _, err = DecodeSaplingAddress(testSaplingAddr, &TestNet3Params); err == nil {
+		t.Fatal("expected error decoding mainnet address for testnet")
+	}
+	if _, err = DecodeSaplingAddress(senderAddr, &TestNet3Params); err == nil {
+		t.Fatal("expected error decoding transparent address")
+	}
+
+	// The same payload with a bech32m checksum.
+	data, _ := bech32.ConvertBits(addr.ScriptAddress(), 8, 5, true)
+	m, _ := bech32.EncodeM("zs", data)
+	if _, err = DecodeSaplingAddress(m, &MainNetParams); err == nil {
+		t.Fatal("expected error for bech32m checksum")
+	}
+
+	// Flipping a bit of pk_d moves it off the curve or out of the subgroup.
+	pkd := addr.Pkd()
+	pkd[0] ^= 1
+	if _, err = NewSaplingAddress(addr.Diversifier(), pkd, &MainNetParams); err == nil {
+		t.Fatal("expected error for invalid pk_d")
+	}
+}
+
+func TestSaplingAddressPkd(t *testing.T) {
+	var diversifier [saplingDiversifierSize]byte
+
+	// Clearing the cofactor of a curve point gives a point of the prime-order
+	// subgroup.
+	var p *jubjubPoint
+	for v := int64(2); p == nil; v++ {
+		var enc [32]byte
+		enc[0] = byte(v)
+		p, _ = decodeJubjubPoint(enc)
+	}
+	if p.inPrimeSubgroup() {
+		t.Fatal("expected point outside the prime-order subgroup")
+	}
+	if _, err := NewSaplingAddress(diversifier, p.bytes(), &RegTestParams); err == nil {
+		t.Fatal("expected error for point outside the prime-order subgroup")
+	}
+
+	g := p.mul(big.NewInt(8))
+	addr, err := NewSaplingAddress(diversifier, g.bytes(), &RegTestParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := addr.EncodeAddress()
+	if !strings.HasPrefix(encoded, "zregtestsapling1") || len(encoded) <= 90 {
+		t.Fatalf("got %s", encoded)
+	}
+	decoded, err := DecodeSaplingAddress(encoded, &RegTestParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Pkd() != g.bytes() {
+		t.Fatal("pk_d does not round-trip")
+	}
+
+	invalid := map[string][32]byte{
+		"identity":  jubjubIdentity().bytes(),
+		"order two": (&jubjubPoint{u: new(big.Int), v: new(big.Int).Sub(jubjubQ, big.NewInt(1))}).bytes(),
+	}
+
+	// v = q is the non-canonical encoding of v = 0.
+	var nonCanonical [32]byte
+	jubjubQ.FillBytes(nonCanonical[:])
+	reverseBytes(nonCanonical[:])
+	invalid["non-canonical v"] = nonCanonical
+
+	// u = 0 with the sign bit set.
+	negZero := jubjubIdentity().bytes()
+	negZero[31] |= 0x80
+	invalid["negative zero"] = negZero
+
+	for name, pkd := range invalid {
+		if _, err = NewSaplingAddress(diversifier, pkd, &RegTestParams); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
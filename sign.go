@@ -6,21 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"runtime"
+	"strings"
+	"sync"
 
 	"github.com/btcsuite/btcd/btcec/v2"
-	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
 	"github.com/btcsuite/btcd/btcutil"
-	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
-type upgradeParam struct {
-	ActivationHeight uint32
-	BranchID         []byte
-}
-
 const (
 	sigHashMask    = 0x1f
 	blake2BSigHash = "ZcashSigHash"
@@ -29,30 +25,22 @@ const (
 const (
 	versionOverwinter int32 = 3
 	versionSapling          = 4
+	versionNU5              = 5
 )
 
 const (
 	versionOverwinterGroupID uint32 = 0x3C48270
 	versionSaplingGroupID           = 0x892f2085
+	versionNU5GroupID               = 0x26A7270A
 )
 
-// https://github.com/zcash/zcash/blob/89f5ee5dec3fdfd70202baeaf74f09fa32bfb1a8/src/chainparams.cpp#L99
-// https://github.com/zcash/zcash/blob/master/src/consensus/upgrades.cpp#L11
-// activation levels are used for testnet because mainnet is already updated
-// TODO: need implement own complete chain params and use them
-var upgradeParams = []upgradeParam{
-	{0, []byte{0x00, 0x00, 0x00, 0x00}},
-	{207500, []byte{0x19, 0x1B, 0xA8, 0x5B}},  // Overwinter  0x5ba81b19
-	{280000, []byte{0xBB, 0x09, 0xB8, 0x76}},  // Sapling     0x76b809bb
-	{653600, []byte{0x60, 0x0E, 0xB4, 0x2B}},  // Blossom     0x2bb40e60
-	{903000, []byte{0x0B, 0x23, 0xB9, 0xF5}},  // Heartwood   0xf5b9230b
-	{1046400, []byte{0xA6, 0x75, 0xFF, 0xE9}}, // Canopy      0xe9ff75a6
-	{1687104, []byte{0xB4, 0xD0, 0xD6, 0xC2}}, // NU5         0xc2d6d0b4
-	{2726400, []byte{0x55, 0x10, 0xE7, 0xC8}}, // NU6         0xc8e71055
-}
-
 // RawTxInSignature returns the serialized ECDSA signature for the input idx of
 // the given transaction, with hashType appended to it.
+// The sighash midstate is computed on every call, SignAllInputs shares it
+// between the inputs of a transaction.
+//
+// Deprecated: the consensus branch ID is guessed from tx.ExpiryHeight. Use
+// RawTxInSignatureWithBranchID.
 func RawTxInSignature(
 	tx *MsgTx,
 	idx int,
@@ -66,38 +54,274 @@ func RawTxInSignature(
 		return nil, err
 	}
 
-	bHash, err := Blake2bSignatureHash(subScript, cache, hashType, tx, idx, amt)
+	signer := &privKeySigner{key: key, compress: true}
+	return rawTxInSignature(tx, cache, idx, subScript, hashType, signer, key.PubKey().SerializeCompressed(), amt)
+}
+
+// RawTxInSignatureWithBranchID is RawTxInSignature for a v3 or v4
+// transaction committing to an explicit consensus branch ID.
+func RawTxInSignatureWithBranchID(
+	tx *MsgTx,
+	branchID uint32,
+	idx int,
+	subScript []byte,
+	hashType txscript.SigHashType,
+	key *btcec.PrivateKey,
+	amt int64,
+) ([]byte, error) {
+	cache, err := NewTxSigHashesWithBranchID(tx, branchID)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &privKeySigner{key: key, compress: true}
+	return rawTxInSignature(tx, cache, idx, subScript, hashType, signer, key.PubKey().SerializeCompressed(), amt)
+}
+
+// rawTxInSignature is RawTxInSignature with a precomputed sighash cache,
+// signing with the key of pubKey held by signer.
+func rawTxInSignature(
+	tx *MsgTx,
+	sigHashes *TxSigHashes,
+	idx int,
+	subScript []byte,
+	hashType txscript.SigHashType,
+	signer Signer,
+	pubKey []byte,
+	amt int64,
+) ([]byte, error) {
+	bHash, err := Blake2bSignatureHash(subScript, sigHashes, hashType, tx, idx, amt)
 	if err != nil {
 		return nil, err
 	}
-	signature := ecdsa.Sign(key, bHash)
-	//signature, err := key.Sign(bHash)
-	//if err != nil {
-	//	return nil, fmt.Errorf("cannot sign tx input: %s", err)
-	//}
+	signature, err := signerSign(signer, bHash, pubKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot sign tx input: %w", err)
+	}
 
-	return append(signature.Serialize(), byte(hashType)), nil
+	return append(signature, byte(hashType)), nil
 }
 
 // SignTxOutput for sign zec transactions inputs
+//
+// Deprecated: the consensus branch ID is guessed from tx.ExpiryHeight, which
+// is wrong on mainnet near upgrade boundaries and for transactions without an
+// expiry height. Use SignTxOutputAtHeight or SignTxOutputWithBranchID.
 func SignTxOutput(
-	chainParams *chaincfg.Params,
+	chainParams *Params,
+	tx *MsgTx,
+	idx int,
+	pkScript []byte,
+	hashType txscript.SigHashType,
+	kdb txscript.KeyDB,
+	sdb txscript.ScriptDB,
+	previousScript []byte,
+	amt int64,
+) ([]byte, error) {
+	sigHashes, err := NewTxSigHashes(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return signTxOutput(chainParams, tx, sigHashes, idx, pkScript, hashType, KeyDBSigner(kdb), sdb, previousScript, amt)
+}
+
+// SignTxOutputAtHeight signs the input idx of a v3 or v4 transaction that is
+// to be mined at the given block height on the network described by
+// chainParams.
+func SignTxOutputAtHeight(
+	chainParams *Params,
+	height uint32,
+	tx *MsgTx,
+	idx int,
+	pkScript []byte,
+	hashType txscript.SigHashType,
+	kdb txscript.KeyDB,
+	sdb txscript.ScriptDB,
+	previousScript []byte,
+	amt int64,
+) ([]byte, error) {
+	return SignTxOutputWithBranchID(chainParams, chainParams.ConsensusBranchID(height), tx, idx, pkScript, hashType, kdb, sdb, previousScript, amt)
+}
+
+// SignTxOutputWithBranchID signs the input idx of a v3 or v4 transaction
+// committing to an explicit consensus branch ID.
+func SignTxOutputWithBranchID(
+	chainParams *Params,
+	branchID uint32,
+	tx *MsgTx,
+	idx int,
+	pkScript []byte,
+	hashType txscript.SigHashType,
+	kdb txscript.KeyDB,
+	sdb txscript.ScriptDB,
+	previousScript []byte,
+	amt int64,
+) ([]byte, error) {
+	sigHashes, err := NewTxSigHashesWithBranchID(tx, branchID)
+	if err != nil {
+		return nil, err
+	}
+
+	return signTxOutput(chainParams, tx, sigHashes, idx, pkScript, hashType, KeyDBSigner(kdb), sdb, previousScript, amt)
+}
+
+// SignTxOutputWithSigner signs the input idx of a transaction of any version
+// with the keys of signer. sigHashes is the midstate of tx computed by
+// NewTxSigHashesWithBranchID or, for v5 transactions, NewTxSigHashesV5.
+func SignTxOutputWithSigner(
+	chainParams *Params,
+	sigHashes *TxSigHashes,
 	tx *MsgTx,
 	idx int,
 	pkScript []byte,
 	hashType txscript.SigHashType,
+	signer Signer,
+	sdb txscript.ScriptDB,
+	previousScript []byte,
+	amt int64,
+) ([]byte, error) {
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("SignTxOutputWithSigner error: idx %d but %d txins", idx, len(tx.TxIn))
+	}
+
+	return signTxOutput(chainParams, tx, sigHashes, idx, pkScript, hashType, signer, sdb, previousScript, amt)
+}
+
+// SignTxOutputV5 signs the input idx of a v5 transaction. The ZIP-244
+// signature digest commits to the amount and script of every spent output,
+// so prevOuts must hold the output spent by each input, in input order.
+func SignTxOutputV5(
+	chainParams *Params,
+	tx *MsgTx,
+	idx int,
+	prevOuts []*wire.TxOut,
+	hashType txscript.SigHashType,
+	kdb txscript.KeyDB,
+	sdb txscript.ScriptDB,
+	previousScript []byte,
+) ([]byte, error) {
+	sigHashes, err := NewTxSigHashesV5(tx, prevOuts)
+	if err != nil {
+		return nil, err
+	}
+	if idx < 0 || idx >= len(prevOuts) {
+		return nil, fmt.Errorf("SignTxOutputV5 error: idx %d but %d txins", idx, len(prevOuts))
+	}
+
+	return signTxOutput(
+		chainParams,
+		tx,
+		sigHashes,
+		idx,
+		prevOuts[idx].PkScript,
+		hashType,
+		KeyDBSigner(kdb),
+		sdb,
+		previousScript,
+		prevOuts[idx].Value,
+	)
+}
+
+// TxSignError lists the inputs of a transaction which could not be signed.
+type TxSignError []*InputError
+
+func (e TxSignError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// SignAllInputs signs every input of tx with SigHashAll for the given
+// consensus branch ID, prevOuts[i] being the output spent by tx.TxIn[i]. The
+// sighash midstate is computed once and inputs are signed concurrently. The
+// new signatures are merged with the current signature scripts, so multisig
+// inputs may be signed in several passes by the holders of each key. The
+// signature scripts of the inputs which could be signed are set, the others
+// are reported together in a TxSignError.
+func SignAllInputs(
+	chainParams *Params,
+	tx *MsgTx,
+	prevOuts []*wire.TxOut,
 	kdb txscript.KeyDB,
 	sdb txscript.ScriptDB,
+	branchID uint32,
+) error {
+	if len(prevOuts) != len(tx.TxIn) {
+		return fmt.Errorf("got %d previous outputs for %d inputs", len(prevOuts), len(tx.TxIn))
+	}
+	sigHashes, err := newTxSigHashesForBranch(tx, prevOuts, branchID)
+	if err != nil {
+		return err
+	}
+
+	workers := runtime.NumCPU()
+	if workers > len(tx.TxIn) {
+		workers = len(tx.TxIn)
+	}
+
+	// Workers only read tx, the signature scripts are set once all of
+	// them are done.
+	var (
+		signer  = KeyDBSigner(kdb)
+		scripts = make([][]byte, len(tx.TxIn))
+		errs    = make([]error, len(tx.TxIn))
+		jobs    = make(chan int)
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				scripts[i], errs[i] = signTxOutput(chainParams, tx, sigHashes, i, prevOuts[i].PkScript,
+					txscript.SigHashAll, signer, sdb, tx.TxIn[i].SignatureScript, prevOuts[i].Value)
+			}
+		}()
+	}
+	for i := range tx.TxIn {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var signErr TxSignError
+	for i, err := range errs {
+		if err != nil {
+			signErr = append(signErr, &InputError{Index: i, Err: err})
+			continue
+		}
+		tx.TxIn[i].SignatureScript = scripts[i]
+	}
+	if len(signErr) > 0 {
+		return signErr
+	}
+	return nil
+}
+
+// signTxOutput is SignTxOutput with a precomputed sighash cache.
+func signTxOutput(
+	chainParams *Params,
+	tx *MsgTx,
+	sigHashes *TxSigHashes,
+	idx int,
+	pkScript []byte,
+	hashType txscript.SigHashType,
+	signer Signer,
+	sdb txscript.ScriptDB,
 	previousScript []byte,
 	amt int64,
 ) ([]byte, error) {
 	sigScript, class, addresses, nrequired, err := sign(
 		chainParams,
 		tx,
+		sigHashes,
 		idx,
 		pkScript,
 		hashType,
-		kdb,
+		signer,
 		sdb,
 		amt,
 	)
@@ -106,14 +330,14 @@ func SignTxOutput(
 	}
 
 	if class == txscript.ScriptHashTy {
-		// TODO: keep the sub addressed and pass down to merge.
 		realSigScript, _, _, _, err := sign(
 			chainParams,
 			tx,
+			sigHashes,
 			idx,
 			sigScript,
 			hashType,
-			kdb,
+			signer,
 			sdb,
 			amt,
 		)
@@ -127,13 +351,13 @@ func SignTxOutput(
 		builder.AddData(sigScript)
 
 		sigScript, _ = builder.Script()
-		// TODO: keep a copy of the script for merging.
 	}
 
 	// Merge scripts. with any previous data, if any.
 	mergedScript := mergeScripts(
 		chainParams,
 		tx,
+		sigHashes,
 		idx,
 		pkScript,
 		class,
@@ -141,22 +365,21 @@ func SignTxOutput(
 		nrequired,
 		sigScript,
 		previousScript,
+		amt,
 	)
 	return mergedScript, nil
 }
 
-// sigHashKey return blake2b key by current height
-func sigHashKey(activationHeight uint32) []byte {
-	var i int
-	for i = len(upgradeParams) - 1; i >= 0; i-- {
-		if activationHeight >= upgradeParams[i].ActivationHeight {
-			break
-		}
-	}
-
-	return append([]byte(blake2BSigHash), upgradeParams[i].BranchID...)
+// sigHashKey returns the ZIP-143/243 blake2b personalization for the given
+// consensus branch ID.
+func sigHashKey(branchID uint32) []byte {
+	return branchPersonalization(blake2BSigHash, branchID)
 }
 
+// Blake2bSignatureHash computes the signature digest of the input idx. v3 and
+// v4 transactions use the ZIP-143/243 digest under the branch ID held by
+// sigHashes, v5 transactions use the ZIP-244 digest under their own
+// ConsensusBranchID.
 func Blake2bSignatureHash(
 	subScript []byte,
 	sigHashes *TxSigHashes,
@@ -171,6 +394,10 @@ func Blake2bSignatureHash(
 		return nil, fmt.Errorf("Blake2bSignatureHash error: idx %d but %d txins", idx, len(tx.TxIn))
 	}
 
+	if tx.Version >= versionNU5 {
+		return zip244SignatureHash(subScript, sigHashes, hashType, tx, idx, amt)
+	}
+
 	// We'll utilize this buffer throughout to incrementally calculate
 	// the signature hash for this transaction.
 	var sigHash bytes.Buffer
@@ -243,16 +470,16 @@ func Blake2bSignatureHash(
 	}
 
 	// << hashJoinSplits
-	sigHash.Write(zeroHash[:])
+	sigHash.Write(sigHashes.HashJoinSplits[:])
 
 	// << hashShieldedSpends
 	if tx.Version == versionSapling {
-		sigHash.Write(zeroHash[:])
+		sigHash.Write(sigHashes.HashShieldedSpends[:])
 	}
 
 	// << hashShieldedOutputs
 	if tx.Version == versionSapling {
-		sigHash.Write(zeroHash[:])
+		sigHash.Write(sigHashes.HashShieldedOutputs[:])
 	}
 
 	// << nLockTime
@@ -268,7 +495,7 @@ func Blake2bSignatureHash(
 	// << valueBalance
 	if tx.Version == versionSapling {
 		var valueBalance [8]byte
-		binary.LittleEndian.PutUint64(valueBalance[:], 0)
+		binary.LittleEndian.PutUint64(valueBalance[:], uint64(tx.ValueBalance))
 		sigHash.Write(valueBalance[:])
 	}
 
@@ -308,7 +535,7 @@ func Blake2bSignatureHash(
 	}
 
 	var h chainhash.Hash
-	if h, err = blake2bHash(sigHash.Bytes(), sigHashKey(tx.ExpiryHeight)); err != nil {
+	if h, err = blake2bHash(sigHash.Bytes(), sigHashKey(sigHashes.BranchID)); err != nil {
 		return nil, err
 	}
 
@@ -316,16 +543,17 @@ func Blake2bSignatureHash(
 }
 
 func sign(
-	chainParams *chaincfg.Params,
+	chainParams *Params,
 	tx *MsgTx,
+	sigHashes *TxSigHashes,
 	idx int,
 	subScript []byte,
 	hashType txscript.SigHashType,
-	kdb txscript.KeyDB,
+	signer Signer,
 	sdb txscript.ScriptDB,
 	amt int64,
 ) ([]byte, txscript.ScriptClass, []btcutil.Address, int, error) {
-	class, addresses, nrequired, err := txscript.ExtractPkScriptAddrs(subScript, chainParams)
+	class, addresses, nrequired, err := txscript.ExtractPkScriptAddrs(subScript, &chainParams.Params)
 	if err != nil {
 		return nil, txscript.NonStandardTy, nil, 0, err
 	}
@@ -333,12 +561,12 @@ func sign(
 	switch class {
 	case txscript.PubKeyHashTy:
 		// look up key for address
-		key, compressed, err := kdb.GetKey(addresses[0])
+		pubKey, err := signerPubKey(signer, addresses[0])
 		if err != nil {
 			return nil, class, nil, 0, err
 		}
 
-		script, err := SignatureScript(tx, idx, subScript, hashType, key, compressed, amt)
+		script, err := signatureScript(tx, sigHashes, idx, subScript, hashType, signer, pubKey, amt)
 		if err != nil {
 			return nil, class, nil, 0, err
 		}
@@ -352,7 +580,7 @@ func sign(
 
 		return script, class, addresses, nrequired, nil
 	case txscript.MultiSigTy:
-		script, _ := signMultiSig(tx, idx, subScript, hashType, addresses, nrequired, kdb, amt)
+		script, _ := signMultiSig(tx, sigHashes, idx, subScript, hashType, addresses, nrequired, signer, amt)
 		return script, class, addresses, nrequired, nil
 	default:
 		return nil, class, nil, 0,
@@ -366,12 +594,13 @@ func sign(
 // legal to not be able to sign any of the outputs, no error is returned.
 func signMultiSig(
 	tx *MsgTx,
+	sigHashes *TxSigHashes,
 	idx int,
 	subScript []byte,
 	hashType txscript.SigHashType,
 	addresses []btcutil.Address,
 	nRequired int,
-	kdb txscript.KeyDB,
+	signer Signer,
 	amt int64,
 ) ([]byte, bool) {
 	// We start with a single OP_FALSE to work around the (now standard)
@@ -380,11 +609,11 @@ func signMultiSig(
 	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_FALSE)
 	signed := 0
 	for _, addr := range addresses {
-		key, _, err := kdb.GetKey(addr)
+		pubKey, err := signerPubKey(signer, addr)
 		if err != nil {
 			continue
 		}
-		sig, err := RawTxInSignature(tx, idx, subScript, hashType, key, amt)
+		sig, err := rawTxInSignature(tx, sigHashes, idx, subScript, hashType, signer, pubKey, amt)
 		if err != nil {
 			continue
 		}
@@ -402,6 +631,9 @@ func signMultiSig(
 }
 
 // SignatureScript generate transaction hash and sign it
+//
+// Deprecated: the consensus branch ID is guessed from tx.ExpiryHeight. Use
+// SignatureScriptWithBranchID.
 func SignatureScript(
 	tx *MsgTx,
 	idx int,
@@ -411,24 +643,88 @@ func SignatureScript(
 	compress bool,
 	amount int64,
 ) ([]byte, error) {
-	sig, err := RawTxInSignature(tx, idx, subscript, hashType, privKey, amount)
+	sigHashes, err := NewTxSigHashes(tx)
 	if err != nil {
 		return nil, err
 	}
-	pk := privKey.PubKey()
-	var pkData []byte
-	if compress {
-		pkData = pk.SerializeCompressed()
-	} else {
-		pkData = pk.SerializeUncompressed()
+
+	signer := &privKeySigner{key: privKey, compress: compress}
+	pubKey, _ := signer.PubKey(nil)
+	return signatureScript(tx, sigHashes, idx, subscript, hashType, signer, pubKey, amount)
+}
+
+// SignatureScriptWithBranchID returns the P2PKH signature script of input
+// idx of a v3 or v4 transaction committing to an explicit consensus branch
+// ID.
+func SignatureScriptWithBranchID(
+	tx *MsgTx,
+	branchID uint32,
+	idx int,
+	subscript []byte,
+	hashType txscript.SigHashType,
+	privKey *btcec.PrivateKey,
+	compress bool,
+	amount int64,
+) ([]byte, error) {
+	sigHashes, err := NewTxSigHashesWithBranchID(tx, branchID)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &privKeySigner{key: privKey, compress: compress}
+	pubKey, _ := signer.PubKey(nil)
+	return signatureScript(tx, sigHashes, idx, subscript, hashType, signer, pubKey, amount)
+}
+
+// SignatureScriptWithSigner returns the P2PKH signature script of input idx
+// signed by the key of pubKey held by signer. sigHashes is the midstate of
+// tx for the consensus branch the signature commits to.
+func SignatureScriptWithSigner(
+	tx *MsgTx,
+	sigHashes *TxSigHashes,
+	idx int,
+	subscript []byte,
+	hashType txscript.SigHashType,
+	signer Signer,
+	pubKey []byte,
+	amount int64,
+) ([]byte, error) {
+	if _, err := btcec.ParsePubKey(pubKey); err != nil {
+		return nil, err
 	}
 
-	return txscript.NewScriptBuilder().AddData(sig).AddData(pkData).Script()
+	return signatureScript(tx, sigHashes, idx, subscript, hashType, signer, pubKey, amount)
 }
 
+// signatureScript is SignatureScript with a precomputed sighash cache.
+func signatureScript(
+	tx *MsgTx,
+	sigHashes *TxSigHashes,
+	idx int,
+	subscript []byte,
+	hashType txscript.SigHashType,
+	signer Signer,
+	pubKey []byte,
+	amount int64,
+) ([]byte, error) {
+	sig, err := rawTxInSignature(tx, sigHashes, idx, subscript, hashType, signer, pubKey, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	return txscript.NewScriptBuilder().AddData(sig).AddData(pubKey).Script()
+}
+
+// mergeScripts merges sigScript and prevScript assuming they are both
+// partial solutions for pkScript spending output idx of tx. class, addresses
+// and nRequired are the result of extracting the addresses from pkScript.
+// The return value is the best effort merging of the two scripts. Calling
+// this function with addresses, class and nRequired that do not match
+// pkScript is an error and results in undefined behaviour.
 func mergeScripts(
-	chainParams *chaincfg.Params,
+	chainParams *Params,
 	tx *MsgTx,
+	sigHashes *TxSigHashes,
 	idx int,
 	pkScript []byte,
 	class txscript.ScriptClass,
@@ -436,8 +732,53 @@ func mergeScripts(
 	nRequired int,
 	sigScript,
 	prevScript []byte,
+	amt int64,
 ) []byte {
 	switch class {
+	case txscript.ScriptHashTy:
+		// Nothing to merge if either the new or previous signature
+		// scripts are empty or are not made of pushes only.
+		sigPushes, err := txscript.PushedData(sigScript)
+		if err != nil || len(sigPushes) == 0 || !txscript.IsPushOnlyScript(sigScript) {
+			return prevScript
+		}
+		prevPushes, err := txscript.PushedData(prevScript)
+		if err != nil || len(prevPushes) == 0 || !txscript.IsPushOnlyScript(prevScript) {
+			return sigScript
+		}
+
+		// The redeem script is the last push. Assume the one of sigScript
+		// is the correct one since it was just made.
+		script := sigPushes[len(sigPushes)-1]
+
+		// We already know this information somewhere up the stack,
+		// therefore the error is ignored.
+		class, addresses, nrequired, _ := txscript.ExtractPkScriptAddrs(script, &chainParams.Params)
+
+		// Merge the scripts without their redeem script.
+		mergedScript := mergeScripts(
+			chainParams,
+			tx,
+			sigHashes,
+			idx,
+			script,
+			class,
+			addresses,
+			nrequired,
+			pushesScript(sigPushes[:len(sigPushes)-1]),
+			pushesScript(prevPushes[:len(prevPushes)-1]),
+			amt,
+		)
+
+		// Reappend the script and return the result.
+		builder := txscript.NewScriptBuilder()
+		builder.AddOps(mergedScript)
+		builder.AddData(script)
+		finalScript, _ := builder.Script()
+		return finalScript
+
+	case txscript.MultiSigTy:
+		return mergeMultiSig(tx, sigHashes, idx, addresses, nRequired, pkScript, sigScript, prevScript, amt)
 
 	// It doesn't actually make sense to merge anything other than multiig
 	// and scripthash (because it could contain multisig). Everything else
@@ -453,3 +794,114 @@ func mergeScripts(
 		return prevScript
 	}
 }
+
+// mergeMultiSig combines the two signature scripts sigScript and prevScript
+// that both provide signatures for pkScript in output idx of tx. addresses
+// and nRequired should be the results from extracting the addresses from
+// pkScript. Signatures are checked against the Zcash signature hash and
+// ordered as the public keys of pkScript, missing ones are padded with
+// OP_0 as the reference implementation does.
+func mergeMultiSig(
+	tx *MsgTx,
+	sigHashes *TxSigHashes,
+	idx int,
+	addresses []btcutil.Address,
+	nRequired int,
+	pkScript,
+	sigScript,
+	prevScript []byte,
+	amt int64,
+) []byte {
+	// Nothing to merge if either the new or previous signature scripts are
+	// empty.
+	if len(sigScript) == 0 {
+		return prevScript
+	}
+	if len(prevScript) == 0 {
+		return sigScript
+	}
+
+	// Attempt to extract signatures from the two scripts. Return the other
+	// script that is intended to be merged in the case signature extraction
+	// fails for some reason.
+	sigPushes, err := txscript.PushedData(sigScript)
+	if err != nil {
+		return prevScript
+	}
+	prevPushes, err := txscript.PushedData(prevScript)
+	if err != nil {
+		return sigScript
+	}
+
+	// Now we need to match the signatures to pubkeys, the only real way to
+	// do that is to try to verify them all and match it to the pubkey that
+	// verifies it. We then can go through the addresses in order to build
+	// our script. Anything that doesn't parse or doesn't verify we throw
+	// away.
+	addrToSig := make(map[string][]byte)
+sigLoop:
+	for _, sig := range append(sigPushes, prevPushes...) {
+		if len(sig) == 0 {
+			continue
+		}
+
+		for _, addr := range addresses {
+			// All multisig addresses should be pubkey addresses, it is an
+			// error to call this internal function with bad input.
+			pkAddr, ok := addr.(*btcutil.AddressPubKey)
+			if !ok {
+				continue
+			}
+
+			// The hash is computed for each signature since hash types
+			// may vary between them.
+			valid, err := checkSig(tx, sigHashes, idx, pkScript, amt, sig, pkAddr.ScriptAddress())
+			if err != nil || !valid {
+				continue
+			}
+
+			// We only can take one signature per public key so if we
+			// already have one, we can throw this away.
+			aStr := addr.EncodeAddress()
+			if _, ok := addrToSig[aStr]; !ok {
+				addrToSig[aStr] = sig
+			}
+			continue sigLoop
+		}
+	}
+
+	// Extra opcode to handle the extra arg consumed (due to previous bugs
+	// in the reference implementation).
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_FALSE)
+	doneSigs := 0
+	// This assumes that addresses are in the same order as in the script.
+	for _, addr := range addresses {
+		sig, ok := addrToSig[addr.EncodeAddress()]
+		if !ok {
+			continue
+		}
+		builder.AddData(sig)
+		doneSigs++
+		if doneSigs == nRequired {
+			break
+		}
+	}
+
+	// Padding for missing ones.
+	for i := doneSigs; i < nRequired; i++ {
+		builder.AddOp(txscript.OP_0)
+	}
+
+	script, _ := builder.Script()
+	return script
+}
+
+// pushesScript returns the script pushing the given data.
+func pushesScript(pushes [][]byte) []byte {
+	builder := txscript.NewScriptBuilder()
+	for _, data := range pushes {
+		builder.AddData(data)
+	}
+	script, _ := builder.Script()
+	return script
+}
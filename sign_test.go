@@ -2,14 +2,16 @@ package zecutil
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"testing"
 
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/btcutil/base58"
-	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
@@ -20,9 +22,7 @@ const (
 	senderAddr = "tmRfZVuDK6gVDfwJie1zepKjAELqaGAgWZr"
 )
 
-var netParams = &chaincfg.Params{
-	Name: "test",
-}
+var netParams = &TestNet3Params
 
 func TestSign(t *testing.T) {
 	var (
@@ -58,7 +58,7 @@ func TestSign(t *testing.T) {
 	for _, receiver := range receivers {
 		decoded := base58.Decode(receiver.addr)
 		var addr *btcutil.AddressPubKeyHash
-		if addr, err = btcutil.NewAddressPubKeyHash(decoded[2:len(decoded)-4], netParams); err != nil {
+		if addr, err = btcutil.NewAddressPubKeyHash(decoded[2:len(decoded)-4], &netParams.Params); err != nil {
 			t.Fatal(err)
 		}
 
@@ -135,7 +135,7 @@ func TestHash(t *testing.T) {
 
 	decoded := base58.Decode("tmHuu9Z7m5W7PcT4orLEANwnHKrB2aDfx5C")
 	var addr *btcutil.AddressPubKeyHash
-	if addr, err = btcutil.NewAddressPubKeyHash(decoded[2:len(decoded)-4], netParams); err != nil {
+	if addr, err = btcutil.NewAddressPubKeyHash(decoded[2:len(decoded)-4], &netParams.Params); err != nil {
 		t.Fatal(err)
 	}
 
@@ -156,3 +156,386 @@ func TestHash(t *testing.T) {
 		t.Fatal("Incorrect hash", "expected", expected, "got", zecTx.TxHash().String())
 	}
 }
+
+func TestSignV5(t *testing.T) {
+	wif, err := btcutil.DecodeWIF(testWif)
+	if err != nil {
+		t.Fatal("can't parse wif")
+	}
+
+	pkScript, err := hex.DecodeString("76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := newTestTxV5(t, 0, 1, 1)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	prevOuts := []*wire.TxOut{
+		wire.NewTxOut(50000, []byte{txscript.OP_TRUE}),
+		wire.NewTxOut(300000000, pkScript),
+	}
+
+	kdb := txscript.KeyClosure(func(a btcutil.Address) (*btcec.PrivateKey, bool, error) {
+		return wif.PrivKey, wif.CompressPubKey, nil
+	})
+
+	if _, err = SignTxOutput(netParams, tx, 1, pkScript, txscript.SigHashAll, kdb, nil, nil, 0); err == nil {
+		t.Fatal("expected error signing v5 tx without previous outputs")
+	}
+	if _, err = SignTxOutputV5(netParams, tx, 1, prevOuts[:1], txscript.SigHashAll, kdb, nil, nil); err == nil {
+		t.Fatal("expected error with missing previous outputs")
+	}
+	if _, err = SignTxOutputV5(netParams, tx, 1, prevOuts, 0x04, kdb, nil, nil); err == nil {
+		t.Fatal("expected error with invalid v5 sighash type")
+	}
+
+	for _, hashType := range []txscript.SigHashType{
+		txscript.SigHashAll,
+		txscript.SigHashSingle | txscript.SigHashAnyOneCanPay,
+	} {
+		sigScript, err := SignTxOutputV5(netParams, tx, 1, prevOuts, hashType, kdb, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pushes, err := txscript.PushedData(sigScript)
+		if err != nil || len(pushes) != 2 {
+			t.Fatalf("unexpected sigScript %x", sigScript)
+		}
+		if txscript.SigHashType(pushes[0][len(pushes[0])-1]) != hashType {
+			t.Fatalf("sighash type not appended")
+		}
+
+		sig, err := ecdsa.ParseDERSignature(pushes[0][:len(pushes[0])-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigHashes, err := NewTxSigHashesV5(tx, prevOuts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := Blake2bSignatureHash(pkScript, sigHashes, hashType, tx, 1, prevOuts[1].Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sig.Verify(hash, wif.PrivKey.PubKey()) {
+			t.Fatalf("signature does not verify for hash type 0x%x", hashType)
+		}
+
+		// The digest commits to the amount of every spent output unless
+		// anyone can pay is set.
+		prevOuts[0].Value++
+		sigHashes, _ = NewTxSigHashesV5(tx, prevOuts)
+		changed, _ := Blake2bSignatureHash(pkScript, sigHashes, hashType, tx, 1, prevOuts[1].Value)
+		if bytes.Equal(changed, hash) == (hashType&txscript.SigHashAnyOneCanPay == 0) {
+			t.Fatalf("unexpected commitment to other inputs for hash type 0x%x", hashType)
+		}
+	}
+}
+
+func TestSignWithBranchID(t *testing.T) {
+	const signed = "030000807082c403011c15616e8b9a75ad4079a17bb296bcba8bda2712453baf1bde447bfe46be46e4010000006b48304502210093f8edae9784fee695d5ac5f84b4217084345a53c31c9e1e8e2a183ebe15cace02206872d90d0af77a4a4c18b761cf511e4583597ee5503e0e82e491da0f1a4377ed012103362327ee808f5961d26ef1a431386d6190638d67c14aa0e78e2eba1b58870cc0ffffffff02400d0300000000001976a9143b535da0ba90dad71ea005cccfe3cca47d746b3a88ac70d2dd11000000001976a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac00000000ff47030000"
+
+	wif, err := btcutil.DecodeWIF(testWif)
+	if err != nil {
+		t.Fatal("can't parse wif")
+	}
+	kdb := txscript.KeyClosure(func(a btcutil.Address) (*btcec.PrivateKey, bool, error) {
+		return wif.PrivKey, wif.CompressPubKey, nil
+	})
+	prevTxScript, err := hex.DecodeString("76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		sign func(tx *MsgTx) ([]byte, error)
+	}{
+		{"branch id", func(tx *MsgTx) ([]byte, error) {
+			return SignTxOutputWithBranchID(netParams, OverwinterBranchID, tx, 0, prevTxScript,
+				txscript.SigHashAll, kdb, nil, nil, 0)
+		}},
+		{"testnet height", func(tx *MsgTx) ([]byte, error) {
+			return SignTxOutputAtHeight(&TestNet3Params, 215000, tx, 0, prevTxScript,
+				txscript.SigHashAll, kdb, nil, nil, 0)
+		}},
+		{"signature script", func(tx *MsgTx) ([]byte, error) {
+			return SignatureScriptWithBranchID(tx, OverwinterBranchID, 0, prevTxScript,
+				txscript.SigHashAll, wif.PrivKey, true, 0)
+		}},
+		{"raw signature", func(tx *MsgTx) ([]byte, error) {
+			sig, err := RawTxInSignatureWithBranchID(tx, OverwinterBranchID, 0, prevTxScript,
+				txscript.SigHashAll, wif.PrivKey, 0)
+			if err != nil {
+				return nil, err
+			}
+			return txscript.NewScriptBuilder().AddData(sig).AddData(wif.SerializePubKey()).Script()
+		}},
+	}
+
+	for _, test := range tests {
+		tx, err := ZecTxFromHex(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.TxIn[0].SignatureScript = nil
+
+		if tx.TxIn[0].SignatureScript, err = test.sign(tx); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if raw, _ := tx.ZecToHex(); raw != signed {
+			t.Fatalf("%s: incorrect sig", test.name)
+		}
+	}
+
+	tx, _ := ZecTxFromHex(signed)
+	_, err = SignTxOutputAtHeight(&MainNetParams, 215000, tx, 0, prevTxScript,
+		txscript.SigHashAll, kdb, nil, nil, 0)
+	if err == nil {
+		t.Fatal("expected error signing before mainnet Overwinter activation")
+	}
+	if _, err = SignatureScriptWithBranchID(tx, SproutBranchID, 0, prevTxScript,
+		txscript.SigHashAll, wif.PrivKey, true, 0); err == nil {
+		t.Fatal("expected error signing under the Sprout branch ID")
+	}
+
+	// The deprecated functions keep signing transactions without an expiry
+	// height under the zero branch ID.
+	tx.ExpiryHeight = 0
+	if _, err = SignTxOutput(netParams, tx, 0, prevTxScript, txscript.SigHashAll, kdb, nil, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = SignatureScript(tx, 0, prevTxScript, txscript.SigHashAll, wif.PrivKey, true, 0); err != nil {
+		t.Fatal(err)
+	}
+	sigHashes, err := NewTxSigHashes(tx)
+	if err != nil || sigHashes.BranchID != SproutBranchID {
+		t.Fatalf("got %v, want a midstate for the zero branch ID", err)
+	}
+}
+
+func TestBranchIDForHeight(t *testing.T) {
+	tests := []struct {
+		upgrades []NetworkUpgrade
+		height   uint32
+		want     uint32
+	}{
+		{MainNetUpgrades, 0, SproutBranchID},
+		{MainNetUpgrades, 347499, SproutBranchID},
+		{MainNetUpgrades, 347500, OverwinterBranchID},
+		{MainNetUpgrades, 600000, SaplingBranchID},
+		{MainNetUpgrades, 1687104, NU5BranchID},
+		{MainNetUpgrades, 3000000, NU6BranchID},
+		{TestNetUpgrades, 600000, BlossomBranchID},
+		{TestNetUpgrades, 1842419, CanopyBranchID},
+		{RegTestUpgrades, 1, NU6BranchID},
+	}
+
+	for _, test := range tests {
+		if got := BranchIDForHeight(test.upgrades, test.height); got != test.want {
+			t.Fatalf("height %d: got branch 0x%08x, want 0x%08x", test.height, got, test.want)
+		}
+	}
+}
+
+func TestBlake2bSignatureHashSapling(t *testing.T) {
+	tx := newTestTx(t, versionSapling, 1, 1, 0)
+	tx.ExpiryHeight = 500000
+
+	sigHash := func() []byte {
+		sigHashes, err := NewTxSigHashesWithBranchID(tx, SaplingBranchID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := Blake2bSignatureHash(tx.TxOut[0].PkScript, sigHashes, txscript.SigHashAll, tx, 0, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	h := sigHash()
+	tx.ShieldedSpends[0].SpendAuthSig[0] ^= 1
+	if !bytes.Equal(sigHash(), h) {
+		t.Fatal("signature hash commits to spend authorization signature")
+	}
+
+	for _, mutate := range []func(){
+		func() { tx.ValueBalance++ },
+		func() { tx.ShieldedSpends[0].Nullifier[0] ^= 1 },
+		func() { tx.ShieldedOutputs[0].ZkProof[0] ^= 1 },
+	} {
+		mutate()
+		if next := sigHash(); bytes.Equal(next, h) {
+			t.Fatal("signature hash does not commit to sapling data")
+		} else {
+			h = next
+		}
+	}
+}
+
+func TestMergeMultiSig(t *testing.T) {
+	store, pubKeys := newTestKeyStore(t, 3)
+	cosigner := func(i int) txscript.KeyDB {
+		return txscript.KeyClosure(func(a btcutil.Address) (*btcec.PrivateKey, bool, error) {
+			if !bytes.Equal(a.ScriptAddress(), pubKeys[i].ScriptAddress()) {
+				return nil, false, ErrKeyNotFound
+			}
+			return store.GetKey(a)
+		})
+	}
+
+	redeemScript, err := txscript.MultiSigScript(pubKeys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptAddr, err := btcutil.NewAddressScriptHash(redeemScript, &netParams.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2shScript, err := txscript.PayToAddrScript(scriptAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb := txscript.ScriptClosure(func(btcutil.Address) ([]byte, error) {
+		return redeemScript, nil
+	})
+
+	for _, pkScript := range [][]byte{p2shScript, redeemScript} {
+		for _, order := range [][2]int{{0, 2}, {2, 0}, {1, 2}} {
+			tx := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling), ExpiryHeight: 300040}
+			tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+			tx.AddTxOut(wire.NewTxOut(90000, p2shScript))
+			prevOuts := []*wire.TxOut{wire.NewTxOut(100000, pkScript)}
+
+			var sigScript []byte
+			for n, i := range order {
+				sigScript, err = SignTxOutputWithBranchID(netParams, SaplingBranchID, tx, 0, pkScript,
+					txscript.SigHashAll, cosigner(i), sdb, sigScript, 100000)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				tx.TxIn[0].SignatureScript = sigScript
+				err = VerifyTx(tx, prevOuts, SaplingBranchID)
+				if (err == nil) != (n == 1) {
+					t.Fatalf("%x signed by %v: got %v after %d signatures", pkScript, order, err, n+1)
+				}
+			}
+
+			// A corrupted signature of the first key in script order is
+			// dropped when merging.
+			last := order[0]
+			if order[1] > last {
+				last = order[1]
+			}
+			garbage := append([]byte(nil), sigScript...)
+			garbage[3] ^= 1
+			merged, err := SignTxOutputWithBranchID(netParams, SaplingBranchID, tx, 0, pkScript,
+				txscript.SigHashAll, cosigner(last), sdb, garbage, 100000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx.TxIn[0].SignatureScript = merged; VerifyTx(tx, prevOuts, SaplingBranchID) == nil {
+				t.Fatalf("%x: expected a missing signature after merging garbage", pkScript)
+			}
+			if pushes, _ := txscript.PushedData(merged); len(pushes[2]) != 0 {
+				t.Fatalf("%x: corrupted signature kept", pkScript)
+			}
+		}
+	}
+}
+
+func TestSignAllInputs(t *testing.T) {
+	store, pubKeys := newTestKeyStore(t, 3)
+	redeemScript, err := txscript.MultiSigScript(pubKeys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptAddr, err := btcutil.NewAddressScriptHash(redeemScript, &netParams.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2shScript, err := txscript.PayToAddrScript(scriptAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pkhScript, err := txscript.PayToAddrScript(pubKeys[1].AddressPubKeyHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb := txscript.ScriptClosure(func(btcutil.Address) ([]byte, error) {
+		return redeemScript, nil
+	})
+
+	const inputs = 64
+	for _, branchID := range []uint32{SaplingBranchID, NU5BranchID} {
+		tx := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling), ExpiryHeight: 300040}
+		if branchID == NU5BranchID {
+			tx.Version, tx.ConsensusBranchID = versionNU5, NU5BranchID
+		}
+		prevOuts := make([]*wire.TxOut, inputs)
+		for i := range prevOuts {
+			pkScript := p2pkhScript
+			if i%3 == 0 {
+				pkScript = p2shScript
+			}
+			prevOuts[i] = wire.NewTxOut(int64(1000*(i+1)), pkScript)
+			tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{byte(i)}}, nil, nil))
+		}
+		tx.AddTxOut(wire.NewTxOut(1000, p2pkhScript))
+
+		if err = SignAllInputs(netParams, tx, prevOuts, store, sdb, branchID); err != nil {
+			t.Fatal(err)
+		}
+		if err = VerifyTx(tx, prevOuts, branchID); err != nil {
+			t.Fatal(err)
+		}
+
+		// Inputs without a key are reported, the others are signed.
+		for _, in := range tx.TxIn {
+			in.SignatureScript = nil
+		}
+		prevOuts[5].PkScript = mustDecodeHex(t, "76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac")
+		err = SignAllInputs(netParams, tx, prevOuts, store, sdb, branchID)
+		var signErr TxSignError
+		if !errors.As(err, &signErr) || len(signErr) != 1 || signErr[0].Index != 5 {
+			t.Fatalf("got %v, want a failure of input 5", err)
+		}
+		if len(tx.TxIn[5].SignatureScript) != 0 || len(tx.TxIn[4].SignatureScript) == 0 {
+			t.Fatal("unexpected signature scripts")
+		}
+	}
+
+	tx := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling)}
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	if err = SignAllInputs(netParams, tx, nil, store, sdb, SaplingBranchID); err == nil {
+		t.Fatal("expected error without previous outputs")
+	}
+
+	// Holders of two of the keys sign the multisig input in turn.
+	tx = &MsgTx{MsgTx: wire.NewMsgTx(versionSapling), ExpiryHeight: 300040}
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, p2pkhScript))
+	prevOuts := []*wire.TxOut{wire.NewTxOut(2000, p2shScript)}
+	for _, i := range []int{0, 2} {
+		seed := sha256.Sum256([]byte{byte(i)})
+		privKey, _ := btcec.PrivKeyFromBytes(seed[:])
+		wif, err := EncodeWIF(privKey, true, netParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		holder := NewKeyStore(netParams)
+		if _, err = holder.ImportWIF(wif); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = SignAllInputs(netParams, tx, prevOuts, holder, sdb, SaplingBranchID); err != nil {
+			t.Fatal(err)
+		}
+		if err = VerifyTx(tx, prevOuts, SaplingBranchID); (err == nil) != (i == 2) {
+			t.Fatalf("after signing with key %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package zecutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// Signer signs signature hashes with keys that need not be in memory, such
+// as keys held by a hardware security module or a remote custody service.
+// Keys are identified by their serialized public key.
+type Signer interface {
+	// PubKey returns the serialized public key paid by addr, compressed or
+	// not as scripts paying it expect. ErrKeyNotFound is returned for
+	// addresses of keys the signer does not hold.
+	PubKey(addr btcutil.Address) ([]byte, error)
+
+	// Sign returns the DER encoded signature of the 32-byte signature hash
+	// by the key of the given public key.
+	Sign(sigHash []byte, pubKey []byte) ([]byte, error)
+}
+
+// KeyDBSigner returns a Signer using the private keys of kdb.
+func KeyDBSigner(kdb txscript.KeyDB) Signer {
+	return &keyDBSigner{kdb: kdb, keys: make(map[string]*btcec.PrivateKey)}
+}
+
+// keyDBSigner is a Signer backed by a txscript.KeyDB. The keys looked up by
+// PubKey are kept for Sign, which only knows the public key.
+type keyDBSigner struct {
+	kdb txscript.KeyDB
+
+	mtx  sync.Mutex
+	keys map[string]*btcec.PrivateKey
+}
+
+func (s *keyDBSigner) PubKey(addr btcutil.Address) ([]byte, error) {
+	key, compressed, err := s.kdb.GetKey(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var pubKey []byte
+	switch {
+	case isPubKeyAddress(addr):
+		// Multisig scripts fix the serialization of their keys.
+		pubKey = addr.ScriptAddress()
+	case compressed:
+		pubKey = key.PubKey().SerializeCompressed()
+	default:
+		pubKey = key.PubKey().SerializeUncompressed()
+	}
+
+	s.mtx.Lock()
+	s.keys[string(pubKey)] = key
+	s.mtx.Unlock()
+
+	return pubKey, nil
+}
+
+func (s *keyDBSigner) Sign(sigHash []byte, pubKey []byte) ([]byte, error) {
+	s.mtx.Lock()
+	key, ok := s.keys[string(pubKey)]
+	s.mtx.Unlock()
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return ecdsa.Sign(key, sigHash).Serialize(), nil
+}
+
+// privKeySigner is a Signer holding a single private key.
+type privKeySigner struct {
+	key      *btcec.PrivateKey
+	compress bool
+}
+
+func (s *privKeySigner) PubKey(btcutil.Address) ([]byte, error) {
+	if s.compress {
+		return s.key.PubKey().SerializeCompressed(), nil
+	}
+	return s.key.PubKey().SerializeUncompressed(), nil
+}
+
+func (s *privKeySigner) Sign(sigHash []byte, _ []byte) ([]byte, error) {
+	return ecdsa.Sign(s.key, sigHash).Serialize(), nil
+}
+
+// isPubKeyAddress reports whether addr is a bare public key, as found in
+// multisig scripts.
+func isPubKeyAddress(addr btcutil.Address) bool {
+	_, ok := addr.(*btcutil.AddressPubKey)
+	return ok
+}
+
+// signerPubKey returns the public key the signer holds for addr, after
+// checking that it is a valid key paid by addr.
+func signerPubKey(signer Signer, addr btcutil.Address) ([]byte, error) {
+	pubKey, err := signer.PubKey(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = btcec.ParsePubKey(pubKey); err != nil {
+		return nil, fmt.Errorf("signer returned an invalid public key: %w", err)
+	}
+
+	var match bool
+	if isPubKeyAddress(addr) {
+		match = bytes.Equal(pubKey, addr.ScriptAddress())
+	} else {
+		match = bytes.Equal(btcutil.Hash160(pubKey), addr.ScriptAddress())
+	}
+	if !match {
+		return nil, fmt.Errorf("signer returned public key %x which does not pay %s", pubKey, addr)
+	}
+	return pubKey, nil
+}
+
+// signerSign signs sigHash with the key of pubKey. Signatures which are not
+// strict DER with a low S value, or which do not verify, are rejected.
+func signerSign(signer Signer, sigHash, pubKey []byte) ([]byte, error) {
+	der, err := signer.Sign(sigHash, pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := ecdsa.ParseDERSignature(der)
+	if err != nil {
+		return nil, fmt.Errorf("signer returned an invalid signature: %w", err)
+	}
+	// Serialize encodes the low S form, so high S signatures and non
+	// canonical encodings don't survive the round trip.
+	if !bytes.Equal(sig.Serialize(), der) {
+		return nil, errors.New("signer returned a non canonical or high S signature")
+	}
+
+	key, err := btcec.ParsePubKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	if !sig.Verify(sigHash, key) {
+		return nil, errors.New("signer returned a signature which does not verify")
+	}
+	return der, nil
+}
@@ -0,0 +1,148 @@
+package zecutil
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testSigner is a Signer standing in for a hardware security module. pubKey
+// and sig, when set, alter the public keys and signatures it returns.
+type testSigner struct {
+	key    *btcec.PrivateKey
+	pubKey func([]byte) []byte
+	sig    func([]byte) []byte
+}
+
+func (s *testSigner) PubKey(addr btcutil.Address) ([]byte, error) {
+	pubKey := s.key.PubKey().SerializeCompressed()
+	if !bytes.Equal(btcutil.Hash160(pubKey), addr.ScriptAddress()) {
+		return nil, ErrKeyNotFound
+	}
+	if s.pubKey != nil {
+		pubKey = s.pubKey(pubKey)
+	}
+	return pubKey, nil
+}
+
+func (s *testSigner) Sign(sigHash []byte, pubKey []byte) ([]byte, error) {
+	if len(sigHash) != 32 {
+		return nil, ErrKeyNotFound
+	}
+	sig := ecdsa.Sign(s.key, sigHash).Serialize()
+	if s.sig != nil {
+		sig = s.sig(sig)
+	}
+	return sig, nil
+}
+
+// highS returns the high S form of a low S DER signature.
+func highS(der []byte) []byte {
+	rLen := int(der[3])
+	r := der[4 : 4+rLen]
+	s := new(big.Int).SetBytes(der[6+rLen:])
+	s.Sub(btcec.S256().N, s)
+
+	sBytes := s.Bytes()
+	if sBytes[0]&0x80 != 0 {
+		sBytes = append([]byte{0}, sBytes...)
+	}
+	sig := []byte{0x30, byte(4 + len(r) + len(sBytes)), 0x02, byte(len(r))}
+	sig = append(sig, r...)
+	sig = append(sig, 0x02, byte(len(sBytes)))
+	return append(sig, sBytes...)
+}
+
+func TestSignTxOutputWithSigner(t *testing.T) {
+	wif, err := btcutil.DecodeWIF(testWif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript := mustDecodeHex(t, "76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac")
+
+	tx := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling), ExpiryHeight: 300040}
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(90000, pkScript))
+	prevOuts := []*wire.TxOut{wire.NewTxOut(100000, pkScript)}
+	sigHashes, err := NewTxSigHashesWithBranchID(tx, SaplingBranchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := &testSigner{key: wif.PrivKey}
+	sigScript, err := SignTxOutputWithSigner(netParams, sigHashes, tx, 0, pkScript, txscript.SigHashAll,
+		signer, nil, nil, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TxIn[0].SignatureScript = sigScript
+	if err = VerifyTx(tx, prevOuts, SaplingBranchID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Signing is deterministic, in-memory keys give the same script.
+	keySigScript, err := SignTxOutputWithBranchID(netParams, SaplingBranchID, tx, 0, pkScript, txscript.SigHashAll,
+		txscript.KeyClosure(func(btcutil.Address) (*btcec.PrivateKey, bool, error) {
+			return wif.PrivKey, true, nil
+		}), nil, nil, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keySigScript, sigScript) {
+		t.Fatalf("got %x, want %x", keySigScript, sigScript)
+	}
+	pubKey := wif.PrivKey.PubKey().SerializeCompressed()
+	direct, err := SignatureScriptWithSigner(tx, sigHashes, 0, pkScript, txscript.SigHashAll, signer, pubKey, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(direct, sigScript) {
+		t.Fatalf("got %x, want %x", direct, sigScript)
+	}
+
+	other, _ := btcec.NewPrivateKey()
+	tests := []struct {
+		name   string
+		signer *testSigner
+	}{
+		{"high s", &testSigner{key: wif.PrivKey, sig: highS}},
+		{"not der", &testSigner{key: wif.PrivKey, sig: func(sig []byte) []byte { return sig[:len(sig)-1] }}},
+		{"another key", &testSigner{key: wif.PrivKey, sig: func(sig []byte) []byte {
+			hash := bytes.Repeat([]byte{1}, 32)
+			return ecdsa.Sign(other, hash).Serialize()
+		}}},
+		{"wrong public key", &testSigner{key: wif.PrivKey, pubKey: func([]byte) []byte {
+			return other.PubKey().SerializeCompressed()
+		}}},
+		{"uncompressed public key", &testSigner{key: wif.PrivKey, pubKey: func([]byte) []byte {
+			return wif.PrivKey.PubKey().SerializeUncompressed()
+		}}},
+		{"invalid public key", &testSigner{key: wif.PrivKey, pubKey: func(pubKey []byte) []byte {
+			return pubKey[1:]
+		}}},
+	}
+	for _, test := range tests {
+		_, err = SignTxOutputWithSigner(netParams, sigHashes, tx, 0, pkScript, txscript.SigHashAll,
+			test.signer, nil, nil, 100000)
+		if err == nil {
+			t.Fatalf("%s: expected error", test.name)
+		}
+	}
+
+	if _, err = signerSign(signer, make([]byte, 32), pubKey); err != nil {
+		t.Fatal(err)
+	}
+	high := highS(ecdsa.Sign(wif.PrivKey, make([]byte, 32)).Serialize())
+	if sig, err := ecdsa.ParseDERSignature(high); err != nil || !sig.Verify(make([]byte, 32), wif.PrivKey.PubKey()) {
+		t.Fatalf("invalid high S signature %x: %v", high, err)
+	}
+	if _, err = signerSign(&testSigner{key: wif.PrivKey, sig: highS}, make([]byte, 32), pubKey); err == nil {
+		t.Fatal("expected error for a high S signature")
+	}
+}
@@ -0,0 +1,142 @@
+package zecutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// bctv14ProofSize is the size of a PHGR13/BCTV14 proof, used by
+	// JoinSplits of v2 and v3 transactions.
+	bctv14ProofSize = 296
+
+	// groth16ProofSize is the size of a Groth16 proof, used by JoinSplits of
+	// v4 transactions.
+	groth16ProofSize = 192
+
+	// sproutCiphertextSize is the size of a Sprout note ciphertext.
+	sproutCiphertextSize = 601
+
+	// joinSplitFixedSize is the size of a JoinSplit description without its
+	// proof.
+	joinSplitFixedSize = 8 + 8 + 32 + 2*32 + 2*32 + 32 + 32 + 2*32 + 2*sproutCiphertextSize
+)
+
+// JoinSplitDescription is a Sprout JoinSplit with two inputs and two outputs.
+// ZkProof holds a BCTV14 proof in v2 and v3 transactions and a Groth16 proof
+// in v4 transactions.
+type JoinSplitDescription struct {
+	VPubOld        uint64
+	VPubNew        uint64
+	Anchor         [32]byte
+	Nullifiers     [2][32]byte
+	Commitments    [2][32]byte
+	EphemeralKey   [32]byte
+	RandomSeed     [32]byte
+	Macs           [2][32]byte
+	ZkProof        []byte
+	EncCiphertexts [2][sproutCiphertextSize]byte
+}
+
+// joinSplitProofSize returns the JoinSplit proof size of the given
+// transaction version.
+func joinSplitProofSize(version int32) int {
+	if version >= versionSapling {
+		return groth16ProofSize
+	}
+	return bctv14ProofSize
+}
+
+// writeJoinSplits encodes the JoinSplits of the transaction, followed by
+// joinSplitPubKey and joinSplitSig when there is at least one.
+func (msg *MsgTx) writeJoinSplits(w io.Writer, pver uint32) error {
+	if err := WriteVarInt(w, pver, uint64(len(msg.JoinSplits))); err != nil {
+		return err
+	}
+	if len(msg.JoinSplits) == 0 {
+		return nil
+	}
+
+	proofSize := joinSplitProofSize(msg.Version)
+	for i, js := range msg.JoinSplits {
+		if len(js.ZkProof) != proofSize {
+			return fmt.Errorf("joinsplit %d: proof is %d bytes, v%d transactions require %d",
+				i, len(js.ZkProof), msg.Version, proofSize)
+		}
+		if err := writeJoinSplit(w, js); err != nil {
+			return err
+		}
+	}
+
+	return writeBytes(w, msg.JoinSplitPubKey[:], msg.JoinSplitSig[:])
+}
+
+// writeJoinSplit encodes a single JoinSplit description.
+func writeJoinSplit(w io.Writer, js *JoinSplitDescription) error {
+	if err := binarySerializer.PutUint64(w, littleEndian, js.VPubOld); err != nil {
+		return err
+	}
+	if err := binarySerializer.PutUint64(w, littleEndian, js.VPubNew); err != nil {
+		return err
+	}
+
+	return writeBytes(w,
+		js.Anchor[:],
+		js.Nullifiers[0][:], js.Nullifiers[1][:],
+		js.Commitments[0][:], js.Commitments[1][:],
+		js.EphemeralKey[:],
+		js.RandomSeed[:],
+		js.Macs[0][:], js.Macs[1][:],
+		js.ZkProof,
+		js.EncCiphertexts[0][:], js.EncCiphertexts[1][:],
+	)
+}
+
+// readJoinSplits decodes the JoinSplits of the transaction together with
+// joinSplitPubKey and joinSplitSig.
+func (msg *MsgTx) readJoinSplits(r io.Reader, pver uint32) error {
+	msg.JoinSplits = nil
+	msg.JoinSplitPubKey = [32]byte{}
+	msg.JoinSplitSig = [64]byte{}
+
+	n, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+
+	proofSize := joinSplitProofSize(msg.Version)
+	if n > maxTxSize/uint64(joinSplitFixedSize+proofSize) {
+		return fmt.Errorf("too many joinsplits: %d", n)
+	}
+
+	msg.JoinSplits = make([]*JoinSplitDescription, 0, n)
+	for i := uint64(0); i < n; i++ {
+		js := &JoinSplitDescription{ZkProof: make([]byte, proofSize)}
+		if err = binary.Read(r, binary.LittleEndian, &js.VPubOld); err != nil {
+			return err
+		}
+		if err = binary.Read(r, binary.LittleEndian, &js.VPubNew); err != nil {
+			return err
+		}
+		err = readBytes(r,
+			js.Anchor[:],
+			js.Nullifiers[0][:], js.Nullifiers[1][:],
+			js.Commitments[0][:], js.Commitments[1][:],
+			js.EphemeralKey[:],
+			js.RandomSeed[:],
+			js.Macs[0][:], js.Macs[1][:],
+			js.ZkProof,
+			js.EncCiphertexts[0][:], js.EncCiphertexts[1][:],
+		)
+		if err != nil {
+			return err
+		}
+		msg.JoinSplits = append(msg.JoinSplits, js)
+	}
+
+	return readBytes(r, msg.JoinSplitPubKey[:], msg.JoinSplitSig[:])
+}
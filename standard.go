@@ -0,0 +1,225 @@
+package zecutil
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// zcashd relay policy limits.
+// https://github.com/zcash/zcash/blob/master/src/policy/policy.h
+const (
+	// MaxStandardTxSize is MAX_STANDARD_TX_SIZE, the largest relayed
+	// transaction.
+	MaxStandardTxSize = 100000
+
+	// MaxStandardScriptSigSize is the largest relayed signature script, that
+	// of a 15-of-15 P2SH multisig spend with compressed keys.
+	MaxStandardScriptSigSize = 1650
+
+	// MaxOpReturnRelay is MAX_OP_RETURN_RELAY, the largest relayed null data
+	// output script.
+	MaxOpReturnRelay = 223
+
+	// MaxUnpaidActions is the default -txunpaidactionlimit, the number of
+	// ZIP-317 unpaid actions above which transactions are not relayed.
+	MaxUnpaidActions = 50
+
+	// txExpiringSoonThreshold is TX_EXPIRING_SOON_THRESHOLD, transactions
+	// expiring within that many blocks are not relayed.
+	txExpiringSoonThreshold = 3
+)
+
+// StandardReason is a zcashd relay policy rule, named after its reject
+// reason.
+type StandardReason string
+
+// Relay policy rules checked by CheckStandard.
+const (
+	ReasonCoinbase             StandardReason = "coinbase"
+	ReasonTxSize               StandardReason = "tx-size"
+	ReasonScriptSigSize        StandardReason = "scriptsig-size"
+	ReasonScriptSigNotPushOnly StandardReason = "scriptsig-not-pushonly"
+	ReasonScriptPubKey         StandardReason = "scriptpubkey"
+	ReasonDust                 StandardReason = "dust"
+	ReasonMultiOpReturn        StandardReason = "multi-op-return"
+	ReasonExpiryTooHigh        StandardReason = "bad-tx-expiry-height-too-high"
+	ReasonExpired              StandardReason = "tx-overwinter-expired"
+	ReasonExpiringSoon         StandardReason = "tx-expiring-soon"
+	ReasonUnpaidActions        StandardReason = "tx-unpaid-action-limit"
+)
+
+// StandardViolation is a relay policy rule broken by a transaction.
+type StandardViolation struct {
+	Reason StandardReason
+
+	// Index is the input or output at fault for the script and dust rules,
+	// -1 for rules about the whole transaction.
+	Index int
+
+	Detail string
+}
+
+func (v *StandardViolation) Error() string {
+	switch v.Reason {
+	case ReasonScriptSigSize, ReasonScriptSigNotPushOnly:
+		return fmt.Sprintf("input %d: %s: %s", v.Index, v.Reason, v.Detail)
+	case ReasonScriptPubKey, ReasonDust, ReasonMultiOpReturn:
+		return fmt.Sprintf("output %d: %s: %s", v.Index, v.Reason, v.Detail)
+	}
+	return fmt.Sprintf("%s: %s", v.Reason, v.Detail)
+}
+
+// NonStandardError lists the relay policy rules broken by a transaction.
+type NonStandardError []*StandardViolation
+
+func (e NonStandardError) Error() string {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		msgs[i] = v.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Has reports whether the transaction broke the given rule.
+func (e NonStandardError) Has(reason StandardReason) bool {
+	for _, v := range e {
+		if v.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// isNullData reports whether pkScript is OP_RETURN followed by pushes, the
+// TX_NULL_DATA of zcashd. Unlike the NullDataTy of btcd, any number of pushes
+// of any size is accepted and the size limit is left to the caller.
+func isNullData(pkScript []byte) bool {
+	return len(pkScript) > 0 && pkScript[0] == txscript.OP_RETURN && txscript.IsPushOnlyScript(pkScript[1:])
+}
+
+// CheckStandard reports whether zcashd would relay tx into the mempool for
+// the block at the given height, prevOuts[i] being the output spent by
+// tx.TxIn[i]. Every broken rule is reported in a NonStandardError.
+//
+// Only the relay policy is checked, consensus rules and input scripts are
+// not.
+func CheckStandard(tx *MsgTx, params *Params, height uint32, prevOuts []*wire.TxOut) error {
+	if len(prevOuts) != len(tx.TxIn) {
+		return fmt.Errorf("got %d previous outputs for %d inputs", len(prevOuts), len(tx.TxIn))
+	}
+
+	var violations NonStandardError
+	add := func(reason StandardReason, index int, format string, a ...interface{}) {
+		violations = append(violations, &StandardViolation{Reason: reason, Index: index, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	if isCoinBase(tx) {
+		add(ReasonCoinbase, -1, "coinbase transactions are not relayed")
+	}
+
+	var buf bytes.Buffer
+	if err := tx.ZecSerialize(&buf); err != nil {
+		return err
+	}
+	if buf.Len() > MaxStandardTxSize {
+		add(ReasonTxSize, -1, "%d bytes is above %d", buf.Len(), MaxStandardTxSize)
+	}
+
+	for i, in := range tx.TxIn {
+		if len(in.SignatureScript) > MaxStandardScriptSigSize {
+			add(ReasonScriptSigSize, i, "%d bytes is above %d", len(in.SignatureScript), MaxStandardScriptSigSize)
+		}
+		if !txscript.IsPushOnlyScript(in.SignatureScript) {
+			add(ReasonScriptSigNotPushOnly, i, "signature script has non-push opcodes")
+		}
+	}
+
+	nullData := 0
+	for i, out := range tx.TxOut {
+		if isNullData(out.PkScript) {
+			nullData++
+			if len(out.PkScript) > MaxOpReturnRelay {
+				add(ReasonScriptPubKey, i, "null data script of %d bytes is above %d", len(out.PkScript), MaxOpReturnRelay)
+			}
+			if nullData > 1 {
+				add(ReasonMultiOpReturn, i, "more than one null data output")
+			}
+			continue
+		}
+
+		class, addresses, nRequired, err := txscript.ExtractPkScriptAddrs(out.PkScript, &params.Params)
+		switch {
+		case err != nil:
+			add(ReasonScriptPubKey, i, "%v", err)
+			continue
+		case class == txscript.MultiSigTy:
+			if nRequired < 1 || len(addresses) > 3 || nRequired > len(addresses) {
+				add(ReasonScriptPubKey, i, "%d-of-%d multisig", nRequired, len(addresses))
+				continue
+			}
+		case class != txscript.PubKeyHashTy && class != txscript.ScriptHashTy && class != txscript.PubKeyTy:
+			add(ReasonScriptPubKey, i, "non-standard script class %s", class)
+			continue
+		}
+
+		if IsDust(out) {
+			add(ReasonDust, i, "%d zatoshi is below %d", out.Value, DustThreshold(out))
+		}
+	}
+
+	if tx.Version >= versionOverwinter && tx.ExpiryHeight != 0 {
+		switch {
+		case tx.ExpiryHeight >= txExpiryHeightThreshold:
+			add(ReasonExpiryTooHigh, -1, "expiry height %d is not below %d", tx.ExpiryHeight, txExpiryHeightThreshold)
+		case height > tx.ExpiryHeight:
+			add(ReasonExpired, -1, "expired at height %d", tx.ExpiryHeight)
+		case height+txExpiringSoonThreshold > tx.ExpiryHeight:
+			add(ReasonExpiringSoon, -1, "expiry height %d is within %d blocks of %d",
+				tx.ExpiryHeight, txExpiringSoonThreshold, height)
+		}
+	}
+
+	if unpaid := UnpaidActions(tx, txFee(tx, prevOuts)); unpaid > MaxUnpaidActions {
+		add(ReasonUnpaidActions, -1, "%d unpaid actions is above %d", unpaid, MaxUnpaidActions)
+	}
+
+	if len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+// UnpaidActions returns the number of ZIP-317 logical actions of the
+// transaction, at least GraceActions, that the given fee does not pay for.
+func UnpaidActions(tx *MsgTx, fee int64) int {
+	actions := LogicalActions(tx)
+	if actions < GraceActions {
+		actions = GraceActions
+	}
+	paid := fee / MarginalFee
+	if paid >= int64(actions) {
+		return 0
+	}
+	return actions - int(paid)
+}
+
+// txFee returns the fee of the transaction: the value of its transparent
+// inputs and of its shielded value balances minus the value of its
+// transparent outputs.
+func txFee(tx *MsgTx, prevOuts []*wire.TxOut) int64 {
+	var fee int64
+	for _, prevOut := range prevOuts {
+		fee += prevOut.Value
+	}
+	for _, out := range tx.TxOut {
+		fee -= out.Value
+	}
+	for _, js := range tx.JoinSplits {
+		fee += int64(js.VPubNew) - int64(js.VPubOld)
+	}
+	return fee + tx.ValueBalance + tx.ValueBalanceOrchard()
+}
@@ -0,0 +1,174 @@
+package zecutil
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestCheckStandard(t *testing.T) {
+	const height = 3000000
+	pkScript := mustDecodeHex(t, "76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac")
+	sigScript, _ := txscript.NewScriptBuilder().AddData(make([]byte, 72)).AddData(make([]byte, 33)).Script()
+	nullData, _ := txscript.NullDataScript([]byte("memo"))
+
+	newTx := func() (*MsgTx, []*wire.TxOut) {
+		tx := &MsgTx{MsgTx: wire.NewMsgTx(versionNU5), ExpiryHeight: height + 40, ConsensusBranchID: NU6BranchID}
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}}, sigScript, nil))
+		tx.AddTxOut(wire.NewTxOut(90000, pkScript))
+		tx.AddTxOut(wire.NewTxOut(0, nullData))
+		return tx, []*wire.TxOut{wire.NewTxOut(100000, pkScript)}
+	}
+
+	tx, prevOuts := newTx()
+	if err := CheckStandard(tx, netParams, height, prevOuts); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckStandard(tx, netParams, height, nil); err == nil {
+		t.Fatal("expected error for missing previous outputs")
+	}
+
+	_, pubKeys := newTestKeyStore(t, 4)
+	multiSig := func(n int) []byte {
+		script, err := txscript.MultiSigScript(pubKeys[:n], 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return script
+	}
+
+	tests := []struct {
+		name   string
+		modify func(tx *MsgTx, prevOuts []*wire.TxOut)
+		reason StandardReason
+		index  int
+	}{
+		{"1-of-3 multisig", func(tx *MsgTx, _ []*wire.TxOut) {
+			tx.AddTxOut(wire.NewTxOut(1000, multiSig(3)))
+		}, "", 0},
+		{"no expiry", func(tx *MsgTx, _ []*wire.TxOut) { tx.ExpiryHeight = 0 }, "", 0},
+		{"v4", func(tx *MsgTx, _ []*wire.TxOut) { tx.Version = versionSapling }, "", 0},
+		{"coinbase", func(tx *MsgTx, _ []*wire.TxOut) {
+			tx.TxIn[0].PreviousOutPoint = wire.OutPoint{Index: wire.MaxPrevOutIndex}
+		}, ReasonCoinbase, -1},
+		{"large script sig", func(tx *MsgTx, _ []*wire.TxOut) {
+			tx.TxIn[0].SignatureScript, _ = txscript.NewScriptBuilder().AddFullData(make([]byte, 1648)).Script()
+		}, ReasonScriptSigSize, 0},
+		{"non-push script sig", func(tx *MsgTx, _ []*wire.TxOut) {
+			tx.TxIn[0].SignatureScript = append(sigScript, txscript.OP_DUP)
+		}, ReasonScriptSigNotPushOnly, 0},
+		{"non-standard output", func(tx *MsgTx, _ []*wire.TxOut) {
+			tx.AddTxOut(wire.NewTxOut(1000, []byte{txscript.OP_TRUE}))
+		}, ReasonScriptPubKey, 2},
+		{"1-of-4 multisig", func(tx *MsgTx, _ []*wire.TxOut) {
+			tx.AddTxOut(wire.NewTxOut(1000, multiSig(4)))
+		}, ReasonScriptPubKey, 2},
+		{"100 byte null data", func(tx *MsgTx, _ []*wire.TxOut) {
+			tx.TxOut[1].PkScript, _ = txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).
+				AddFullData(make([]byte, 100)).Script()
+		}, "", 0},
+		{"null data at the limit", func(tx *MsgTx, _ []*wire.TxOut) {
+			// OP_RETURN OP_PUSHDATA1 <length> <data>
+			tx.TxOut[1].PkScript, _ = txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).
+				AddFullData(make([]byte, MaxOpReturnRelay-3)).Script()
+		}, "", 0},
+		{"null data of several pushes", func(tx *MsgTx, _ []*wire.TxOut) {
+			tx.TxOut[1].PkScript, _ = txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).
+				AddData([]byte("memo")).AddInt64(16).AddData(make([]byte, 80)).Script()
+		}, "", 0},
+		{"large null data", func(tx *MsgTx, _ []*wire.TxOut) {
+			tx.TxOut[1].PkScript, _ = txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).
+				AddFullData(make([]byte, MaxOpReturnRelay-2)).Script()
+		}, ReasonScriptPubKey, 1},
+		{"non-push null data", func(tx *MsgTx, _ []*wire.TxOut) {
+			tx.TxOut[1].PkScript = append(nullData, txscript.OP_DUP)
+		}, ReasonScriptPubKey, 1},
+		{"two null data outputs", func(tx *MsgTx, _ []*wire.TxOut) {
+			tx.AddTxOut(wire.NewTxOut(0, nullData))
+		}, ReasonMultiOpReturn, 2},
+		{"dust", func(tx *MsgTx, prevOuts []*wire.TxOut) {
+			tx.TxOut[0].Value = 53
+			prevOuts[0].Value = 10053
+		}, ReasonDust, 0},
+		{"expiry threshold", func(tx *MsgTx, _ []*wire.TxOut) { tx.ExpiryHeight = txExpiryHeightThreshold }, ReasonExpiryTooHigh, -1},
+		{"expired", func(tx *MsgTx, _ []*wire.TxOut) { tx.ExpiryHeight = height - 1 }, ReasonExpired, -1},
+		{"expiring soon", func(tx *MsgTx, _ []*wire.TxOut) { tx.ExpiryHeight = height + 2 }, ReasonExpiringSoon, -1},
+		{"unpaid actions", func(tx *MsgTx, _ []*wire.TxOut) {
+			for i := 0; i < 60; i++ {
+				tx.AddTxOut(wire.NewTxOut(1000, pkScript))
+			}
+		}, ReasonUnpaidActions, -1},
+		{"large transaction", func(tx *MsgTx, prevOuts []*wire.TxOut) {
+			for i := 0; i < 3000; i++ {
+				tx.AddTxOut(wire.NewTxOut(1000, pkScript))
+			}
+			prevOuts[0].Value += (MarginalFee + 1000) * 3000
+		}, ReasonTxSize, -1},
+	}
+	for _, test := range tests {
+		tx, prevOuts := newTx()
+		test.modify(tx, prevOuts)
+		err := CheckStandard(tx, netParams, height, prevOuts)
+		if test.reason == "" {
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			continue
+		}
+
+		var nonStandard NonStandardError
+		if !errors.As(err, &nonStandard) {
+			t.Fatalf("%s: got %v, want a NonStandardError", test.name, err)
+		}
+		if len(nonStandard) != 1 || nonStandard[0].Reason != test.reason || nonStandard[0].Index != test.index {
+			t.Fatalf("%s: got %v, want %s at %d", test.name, err, test.reason, test.index)
+		}
+	}
+
+	// Every broken rule is reported.
+	tx, prevOuts = newTx()
+	tx.TxIn[0].SignatureScript = []byte{txscript.OP_DUP}
+	tx.TxOut[0].Value = 1
+	tx.ExpiryHeight = height
+	err := CheckStandard(tx, netParams, height, prevOuts)
+	nonStandard, ok := err.(NonStandardError)
+	if !ok || len(nonStandard) != 3 || !nonStandard.Has(ReasonScriptSigNotPushOnly) ||
+		!nonStandard.Has(ReasonDust) || !nonStandard.Has(ReasonExpiringSoon) || nonStandard.Has(ReasonUnpaidActions) {
+
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := "input 0: scriptsig-not-pushonly: "; !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("unexpected message %q", err)
+	}
+}
+
+func TestUnpaidActions(t *testing.T) {
+	tx := newTestTxV5(t, 2, 3, 4)
+	// One transparent action, three Sapling and four Orchard actions.
+	tests := []struct {
+		fee    int64
+		unpaid int
+	}{
+		{0, 8},
+		{4999, 8},
+		{5000, 7},
+		{35000, 1},
+		{40000, 0},
+		{100000, 0},
+		{-5000, 9},
+	}
+	for _, test := range tests {
+		if unpaid := UnpaidActions(tx, test.fee); unpaid != test.unpaid {
+			t.Fatalf("fee %d: %d unpaid actions, want %d", test.fee, unpaid, test.unpaid)
+		}
+	}
+
+	empty := &MsgTx{MsgTx: wire.NewMsgTx(versionNU5)}
+	if unpaid := UnpaidActions(empty, 0); unpaid != GraceActions {
+		t.Fatalf("got %d unpaid actions, want %d", unpaid, GraceActions)
+	}
+}
@@ -0,0 +1,112 @@
+package zecutil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// ErrTexNonP2PKHInput is returned when a transaction paying a TEX address
+// spends an output other than P2PKH.
+var ErrTexNonP2PKHInput = errors.New("transactions paying a TEX address must only spend P2PKH outputs")
+
+// ZecAddressTex is a ZIP-320 transparent-source-only (TEX) address. It is
+// paid with the same script as the P2PKH address of the same hash, the
+// sender must only spend P2PKH outputs.
+// https://zips.z.cash/zip-0320
+type ZecAddressTex struct {
+	hash [ripemd160.Size]byte
+	net  *Params
+}
+
+func NewAddressTex(hash [ripemd160.Size]byte, net *Params) *ZecAddressTex {
+	return &ZecAddressTex{hash, net}
+}
+
+// DecodeTexAddress decodes a Bech32m encoded TEX address for the given
+// network.
+func DecodeTexAddress(address string, net *Params) (*ZecAddressTex, error) {
+	if net == nil || net.TexAddressHRP == "" {
+		return nil, errors.New("unknown network parameters")
+	}
+
+	hrp, data, version, err := bech32.DecodeNoLimitWithVersion(address)
+	if err != nil {
+		return nil, err
+	}
+	if version != bech32.VersionM {
+		return nil, errors.New("tex address is not bech32m encoded")
+	}
+	if hrp != net.TexAddressHRP {
+		return nil, fmt.Errorf("tex address hrp %q is not for %s", hrp, net.Name)
+	}
+
+	hash, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(hash) != ripemd160.Size {
+		return nil, errors.New("incorrect payload len")
+	}
+
+	addr := &ZecAddressTex{net: net}
+	copy(addr.hash[:], hash)
+	return addr, nil
+}
+
+// isTexAddress reports whether the address has the TEX human-readable part of
+// the network.
+func isTexAddress(address string, net *Params) bool {
+	return net.TexAddressHRP != "" && strings.HasPrefix(strings.ToLower(address), net.TexAddressHRP+"1")
+}
+
+// PubKeyHashAddress returns the P2PKH address of the same hash.
+func (a *ZecAddressTex) PubKeyHashAddress() *ZecAddressPubKeyHash {
+	return NewAddressPubKeyHash(a.hash, a.net)
+}
+
+// EncodeAddress returns the Bech32m encoding of the TEX address. Part of the
+// Address interface.
+func (a *ZecAddressTex) EncodeAddress() string {
+	data, err := bech32.ConvertBits(a.hash[:], 8, 5, true)
+	if err != nil {
+		return ""
+	}
+	addr, _ := bech32.EncodeM(a.net.TexAddressHRP, data)
+	return addr
+}
+
+// ScriptAddress returns the bytes to be included in a txout script to pay
+// to a pubkey hash.  Part of the Address interface.
+func (a *ZecAddressTex) ScriptAddress() []byte {
+	return a.hash[:]
+}
+
+// IsForNet returns whether or not the TEX address is associated with the
+// passed network.
+func (a *ZecAddressTex) IsForNet(net *chaincfg.Params) bool {
+	return a.net.Name == net.Name
+}
+
+// String returns a human-readable string for the TEX address. This is
+// equivalent to calling EncodeAddress, but is provided so the type can be
+// used as a fmt.Stringer.
+func (a *ZecAddressTex) String() string {
+	return a.EncodeAddress()
+}
+
+// checkTexInputs returns an *InputError wrapping ErrTexNonP2PKHInput for
+// the first UTXO not paying to a public key hash.
+func checkTexInputs(utxos []*UTXO) error {
+	for i, utxo := range utxos {
+		if !txscript.IsPayToPubKeyHash(utxo.PkScript) {
+			return &InputError{Index: i, Err: ErrTexNonP2PKHInput}
+		}
+	}
+	return nil
+}
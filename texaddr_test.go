@@ -0,0 +1,99 @@
+package zecutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestTexAddress(t *testing.T) {
+	// Test vector from ZIP-320.
+	const (
+		tAddr   = "t1VmmGiyjVNeCjxDZzg7vZmd99WyzVby9yC"
+		texAddr = "tex1s2rt77ggv6q989lr49rkgzmh5slsksa9khdgte"
+	)
+
+	decoded, err := DecodeAddress(texAddr, &MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tex, ok := decoded.(*ZecAddressTex)
+	if !ok {
+		t.Fatalf("unexpected address type %T", decoded)
+	}
+	if tex.String() != texAddr {
+		t.Fatalf("got %s", tex)
+	}
+	if tex.PubKeyHashAddress().EncodeAddress() != tAddr {
+		t.Fatalf("got p2pkh address %s", tex.PubKeyHashAddress())
+	}
+	if !tex.IsForNet(&MainNetParams.Params) || tex.IsForNet(&TestNet3Params.Params) {
+		t.Fatal("unexpected network")
+	}
+
+	p2pkh, err := DecodeAddress(tAddr, &MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := PayToAddrScript(p2pkh)
+	got, err := PayToAddrScript(tex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got script %x, want %x", got, want)
+	}
+
+	if _, err = DecodeAddress(texAddr, &TestNet3Params); err == nil {
+		t.Fatal("expected error decoding mainnet address for testnet")
+	}
+	testnet := NewAddressTex(tex.hash, &TestNet3Params)
+	if _, err = DecodeTexAddress(testnet.EncodeAddress(), &TestNet3Params); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxBuilderTex(t *testing.T) {
+	wif, err := btcutil.DecodeWIF(testWif)
+	if err != nil {
+		t.Fatal("can't parse wif")
+	}
+	kdb := txscript.KeyClosure(func(a btcutil.Address) (*btcec.PrivateKey, bool, error) {
+		return wif.PrivKey, wif.CompressPubKey, nil
+	})
+	pkScript := mustDecodeHex(t, "76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac")
+
+	var hash [20]byte
+	hash[0] = 1
+	b := NewTxBuilder(netParams)
+	b.AddInput(&UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{1}}, PkScript: pkScript, Amount: 110000})
+	if err = b.AddOutput(NewAddressTex(hash, netParams), 100000); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := b.Build(3000000, kdb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tx.TxOut[0].PkScript[3:23], hash[:]) {
+		t.Fatalf("unexpected script %x", tx.TxOut[0].PkScript)
+	}
+
+	// Outputs other than P2PKH may not fund a TEX payment.
+	p2pk, err := txscript.NewScriptBuilder().AddData(wif.SerializePubKey()).AddOp(txscript.OP_CHECKSIG).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.AddInput(&UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{2}}, PkScript: p2pk, Amount: 10000})
+	var inputErr *InputError
+	if _, err = b.Build(3000000, kdb, nil); !errors.Is(err, ErrTexNonP2PKHInput) ||
+		!errors.As(err, &inputErr) || inputErr.Index != 1 {
+
+		t.Fatalf("got %v, want %v for input 1", err, ErrTexNonP2PKHInput)
+	}
+}
@@ -0,0 +1,269 @@
+package zecutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Unified Address typecodes of ZIP-316.
+// https://zips.z.cash/zip-0316#encoding-of-unified-addresses
+const (
+	UATypeP2PKH   uint64 = 0x00
+	UATypeP2SH    uint64 = 0x01
+	UATypeSapling uint64 = 0x02
+	UATypeOrchard uint64 = 0x03
+
+	// UATypeMetadataMin and UATypeMetadataMax bound the typecodes reserved
+	// for metadata items.
+	UATypeMetadataMin uint64 = 0xE0
+	UATypeMetadataMax uint64 = 0xFC
+)
+
+const (
+	// shieldedReceiverSize is the size of a Sapling or Orchard raw address,
+	// an 11-byte diversifier followed by a 32-byte transmission key.
+	shieldedReceiverSize = 43
+
+	// uaPaddingSize is the size of the padding holding the HRP appended to
+	// the items before jumbling.
+	uaPaddingSize = 16
+)
+
+// UnifiedItem is a receiver or metadata item of a Unified Address which is not
+// interpreted by this package.
+type UnifiedItem struct {
+	Typecode uint64
+	Data     []byte
+}
+
+// UnifiedAddress is a decoded ZIP-316 Unified Address. Nil receivers are not
+// part of the address.
+type UnifiedAddress struct {
+	P2PKH   *[ripemd160.Size]byte
+	P2SH    *[ripemd160.Size]byte
+	Sapling *[shieldedReceiverSize]byte
+	Orchard *[shieldedReceiverSize]byte
+
+	// Unknown holds receivers with typecodes this package does not know.
+	Unknown []UnifiedItem
+
+	// Metadata holds the metadata items of the address.
+	Metadata []UnifiedItem
+}
+
+// DecodeUnifiedAddress decodes a Unified Address for the given network.
+func DecodeUnifiedAddress(address string, net *Params) (*UnifiedAddress, error) {
+	if net == nil || net.UnifiedAddressHRP == "" {
+		return nil, errors.New("unknown network parameters")
+	}
+
+	hrp, data, version, err := bech32.DecodeNoLimitWithVersion(address)
+	if err != nil {
+		return nil, err
+	}
+	if version != bech32.VersionM {
+		return nil, errors.New("unified address is not bech32m encoded")
+	}
+	if hrp != net.UnifiedAddressHRP {
+		return nil, fmt.Errorf("unified address hrp %q is not for %s", hrp, net.Name)
+	}
+
+	jumbled, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := f4JumbleInv(jumbled)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) < uaPaddingSize {
+		return nil, errors.New("unified address too short")
+	}
+	padding := uaPadding(hrp)
+	if !bytes.Equal(raw[len(raw)-uaPaddingSize:], padding[:]) {
+		return nil, errors.New("invalid unified address padding")
+	}
+
+	ua := &UnifiedAddress{}
+	r := bytes.NewReader(raw[:len(raw)-uaPaddingSize])
+	var prev uint64
+	for i := 0; r.Len() > 0; i++ {
+		typecode, err := ReadVarInt(r, 0)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && typecode <= prev {
+			return nil, errors.New("unified address items are not in ascending typecode order")
+		}
+		prev = typecode
+
+		data, err := ReadVarBytes(r, 0, r.Len())
+		if err != nil {
+			return nil, err
+		}
+		if err = ua.setItem(typecode, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = ua.validate(); err != nil {
+		return nil, err
+	}
+	return ua, nil
+}
+
+// Encode returns the string encoding of the Unified Address for the given
+// network.
+func (ua *UnifiedAddress) Encode(net *Params) (string, error) {
+	if net == nil || net.UnifiedAddressHRP == "" {
+		return "", errors.New("unknown network parameters")
+	}
+	if err := ua.validate(); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	for _, item := range ua.items() {
+		if err := WriteVarInt(&buf, 0, item.Typecode); err != nil {
+			return "", err
+		}
+		if err := WriteVarBytes(&buf, 0, item.Data); err != nil {
+			return "", err
+		}
+	}
+	padding := uaPadding(net.UnifiedAddressHRP)
+	buf.Write(padding[:])
+
+	jumbled, err := f4Jumble(buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+	data, err := bech32.ConvertBits(jumbled, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	return bech32.EncodeM(net.UnifiedAddressHRP, data)
+}
+
+// TransparentAddress returns the transparent receiver of the Unified Address
+// as a ZecAddressPubKeyHash or a ZecAddressScriptHash, so it can be paid with
+// PayToAddrScript.
+func (ua *UnifiedAddress) TransparentAddress(net *Params) (btcutil.Address, error) {
+	switch {
+	case ua.P2PKH != nil:
+		return NewAddressPubKeyHash(*ua.P2PKH, net), nil
+	case ua.P2SH != nil:
+		return NewAddressScriptHash(*ua.P2SH, net), nil
+	}
+
+	return nil, errors.New("unified address has no transparent receiver")
+}
+
+// setItem stores a decoded item in the matching field of the address.
+func (ua *UnifiedAddress) setItem(typecode uint64, data []byte) error {
+	switch typecode {
+	case UATypeP2PKH, UATypeP2SH:
+		if len(data) != ripemd160.Size {
+			return fmt.Errorf("invalid transparent receiver length %d", len(data))
+		}
+		var hash [ripemd160.Size]byte
+		copy(hash[:], data)
+		if typecode == UATypeP2PKH {
+			ua.P2PKH = &hash
+		} else {
+			ua.P2SH = &hash
+		}
+
+	case UATypeSapling, UATypeOrchard:
+		if len(data) != shieldedReceiverSize {
+			return fmt.Errorf("invalid shielded receiver length %d", len(data))
+		}
+		var addr [shieldedReceiverSize]byte
+		copy(addr[:], data)
+		if typecode == UATypeSapling {
+			ua.Sapling = &addr
+		} else {
+			ua.Orchard = &addr
+		}
+
+	default:
+		item := UnifiedItem{Typecode: typecode, Data: data}
+		if typecode >= UATypeMetadataMin {
+			ua.Metadata = append(ua.Metadata, item)
+		} else {
+			ua.Unknown = append(ua.Unknown, item)
+		}
+	}
+
+	return nil
+}
+
+// items returns the items of the address in ascending typecode order.
+func (ua *UnifiedAddress) items() []UnifiedItem {
+	var items []UnifiedItem
+	if ua.P2PKH != nil {
+		items = append(items, UnifiedItem{UATypeP2PKH, ua.P2PKH[:]})
+	}
+	if ua.P2SH != nil {
+		items = append(items, UnifiedItem{UATypeP2SH, ua.P2SH[:]})
+	}
+	if ua.Sapling != nil {
+		items = append(items, UnifiedItem{UATypeSapling, ua.Sapling[:]})
+	}
+	if ua.Orchard != nil {
+		items = append(items, UnifiedItem{UATypeOrchard, ua.Orchard[:]})
+	}
+	items = append(items, ua.Unknown...)
+	items = append(items, ua.Metadata...)
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Typecode < items[j].Typecode
+	})
+	return items
+}
+
+// validate checks the receivers of the address against the rules of ZIP-316.
+func (ua *UnifiedAddress) validate() error {
+	if ua.P2PKH != nil && ua.P2SH != nil {
+		return errors.New("unified address has both p2pkh and p2sh receivers")
+	}
+	if ua.Sapling == nil && ua.Orchard == nil && len(ua.Unknown) == 0 {
+		return errors.New("unified address has only transparent receivers")
+	}
+
+	seen := make(map[uint64]bool)
+	for _, item := range ua.Unknown {
+		if item.Typecode <= UATypeOrchard || item.Typecode >= UATypeMetadataMin {
+			return fmt.Errorf("invalid unknown receiver typecode 0x%x", item.Typecode)
+		}
+		if seen[item.Typecode] {
+			return fmt.Errorf("duplicate typecode 0x%x", item.Typecode)
+		}
+		seen[item.Typecode] = true
+	}
+	for _, item := range ua.Metadata {
+		if item.Typecode < UATypeMetadataMin || item.Typecode > UATypeMetadataMax {
+			return fmt.Errorf("invalid metadata typecode 0x%x", item.Typecode)
+		}
+		if seen[item.Typecode] {
+			return fmt.Errorf("duplicate typecode 0x%x", item.Typecode)
+		}
+		seen[item.Typecode] = true
+	}
+
+	return nil
+}
+
+// uaPadding returns the HRP padded with zeros to 16 bytes.
+func uaPadding(hrp string) (padding [uaPaddingSize]byte) {
+	copy(padding[:], hrp)
+	return padding
+}
@@ -0,0 +1,231 @@
+package zecutil
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+func TestF4Jumble(t *testing.T) {
+	rnd := rand.New(rand.NewSource(316))
+	for _, n := range []int{f4MinLen, 49, 127, 128, 129, 200, 1000} {
+		msg := make([]byte, n)
+		rnd.Read(msg)
+
+		jumbled, err := f4Jumble(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(jumbled, msg) || len(jumbled) != n {
+			t.Fatalf("length %d: message not jumbled", n)
+		}
+		got, err := f4JumbleInv(jumbled)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("length %d: inverse does not restore the message", n)
+		}
+
+		// Every byte of the output depends on every byte of the input.
+		msg[n-1] ^= 1
+		flipped, _ := f4Jumble(msg)
+		if flipped[0] == jumbled[0] && flipped[n/2] == jumbled[n/2] {
+			t.Fatalf("length %d: output does not depend on the last byte", n)
+		}
+	}
+
+	if _, err := f4Jumble(make([]byte, f4MinLen-1)); err == nil {
+		t.Fatal("expected error for short message")
+	}
+}
+
+func TestUnifiedAddress(t *testing.T) {
+	var p2pkh [20]byte
+	var sapling, orchard [shieldedReceiverSize]byte
+	copy(p2pkh[:], mustDecodeHex(t, "aefaebf9c83deba2ec76e080e2cec850dec161b1"))
+	for i := range sapling {
+		sapling[i] = byte(i)
+		orchard[i] = byte(0xff - i)
+	}
+
+	ua := &UnifiedAddress{
+		P2PKH:    &p2pkh,
+		Sapling:  &sapling,
+		Orchard:  &orchard,
+		Unknown:  []UnifiedItem{{Typecode: 0x05, Data: []byte{1, 2, 3}}},
+		Metadata: []UnifiedItem{{Typecode: 0xE0, Data: []byte{0x40, 0x42, 0x0f, 0x00}}},
+	}
+
+	for _, net := range []*Params{&MainNetParams, &TestNet3Params} {
+		encoded, err := ua.Encode(net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(encoded, net.UnifiedAddressHRP+"1") {
+			t.Fatalf("unexpected prefix of %s", encoded)
+		}
+
+		decoded, err := DecodeUnifiedAddress(encoded, net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *decoded.P2PKH != p2pkh || decoded.P2SH != nil || *decoded.Sapling != sapling || *decoded.Orchard != orchard {
+			t.Fatal("receivers do not round-trip")
+		}
+		if len(decoded.Unknown) != 1 || !bytes.Equal(decoded.Unknown[0].Data, []byte{1, 2, 3}) {
+			t.Fatalf("unexpected unknown receivers %v", decoded.Unknown)
+		}
+		if len(decoded.Metadata) != 1 || decoded.Metadata[0].Typecode != 0xE0 {
+			t.Fatalf("unexpected metadata %v", decoded.Metadata)
+		}
+
+		addr, err := decoded.TransparentAddress(net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := addr.(*ZecAddressPubKeyHash); !ok {
+			t.Fatalf("unexpected transparent address type %T", addr)
+		}
+		script, err := PayToAddrScript(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac"; !bytes.Equal(script, mustDecodeHex(t, want)) {
+			t.Fatalf("got script %x", script)
+		}
+
+		if _, err = DecodeUnifiedAddress(strings.ToUpper(encoded), net); err != nil {
+			t.Fatalf("uppercase address rejected: %v", err)
+		}
+		corrupted := []byte(encoded)
+		corrupted[len(corrupted)-10] ^= 1
+		if _, err = DecodeUnifiedAddress(string(corrupted), net); err == nil {
+			t.Fatal("expected checksum error")
+		}
+	}
+
+	encoded, _ := ua.Encode(&MainNetParams)
+	if _, err := DecodeUnifiedAddress(encoded, &TestNet3Params); err == nil {
+		t.Fatal("expected error decoding mainnet address for testnet")
+	}
+
+	shielded := &UnifiedAddress{Orchard: &orchard}
+	if _, err := shielded.TransparentAddress(&MainNetParams); err == nil {
+		t.Fatal("expected error without transparent receiver")
+	}
+
+	invalid := []*UnifiedAddress{
+		{P2PKH: &p2pkh},
+		{P2PKH: &p2pkh, P2SH: &p2pkh, Orchard: &orchard},
+		{Orchard: &orchard, Unknown: []UnifiedItem{{Typecode: UATypeSapling}}},
+		{Orchard: &orchard, Metadata: []UnifiedItem{{Typecode: 0xFD}}},
+		{Orchard: &orchard, Unknown: []UnifiedItem{{Typecode: 0x10}, {Typecode: 0x10}}},
+	}
+	for i, ua := range invalid {
+		if _, err := ua.Encode(&MainNetParams); err == nil {
+			t.Fatalf("%d: expected encoding error", i)
+		}
+	}
+}
+
+func TestUnifiedAddressVectors(t *testing.T) {
+	// Mainnet addresses produced by other wallets: decoding checks their
+	// bech32m checksum and padding, encoding must restore them exactly.
+	tests := []struct {
+		addr        string
+		transparent string
+		orchard     bool
+	}{
+		{
+			"u1l8xunezsvhq8fgzfl7404m450nwnd76zshscn6nfys7vyz2ywyh4cc5daaq0c7q2su5lqfh23sp7fkf3kt27ve5948mzpfdvckzaect2jtte308mkwlycj2u0eac077wu70vqcetkxf",
+			"t1V9mnyk5Z5cTNMCkLbaDwSskgJZucTLdgW", false,
+		},
+		{
+			"u1pg2aaph7jp8rpf6yhsza25722sg5fcn3vaca6ze27hqjw7jvvhhuxkpcg0ge9xh6drsgdkda8qjq5chpehkcpxf87rnjryjqwymdheptpvnljqqrjqzjwkc2ma6hcq666kgwfytxwac8eyex6ndgr6ezte66706e3vaqrd25dzvzkc69kw0jgywtd0cmq52q5lkw6uh7hyvzjse8ksx",
+			"t1cN2ZVWzWcVRrnfeQzmkpLhzQ4dYRv8yRY", true,
+		},
+		{
+			"u1rl2zw85dmjc8m4dmqvtstcyvdjn23n0ad53u5533c97affg9jq208du0vf787vfx4vkd6cd0ma4pxkkuc6xe6ue4dlgjvn9dhzacgk9peejwxdn0ksw3v3yf0dy47znruqftfqgf6xpuelle29g2qxquudxsnnen3dvdx8az6w3tggalc4pla3n4jcs8vf4h29ach3zd8enxulush89",
+			"t1fcRAz6hqyeEB2RScaUeHJESgunu3EkBbw", true,
+		},
+	}
+	for _, test := range tests {
+		ua, err := DecodeUnifiedAddress(test.addr, &MainNetParams)
+		if err != nil {
+			t.Fatalf("%s: %v", test.addr, err)
+		}
+		if ua.Sapling == nil || (ua.Orchard != nil) != test.orchard || ua.P2SH != nil ||
+			len(ua.Unknown) != 0 || len(ua.Metadata) != 0 {
+
+			t.Fatalf("%s: unexpected receivers", test.addr)
+		}
+		addr, err := ua.TransparentAddress(&MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr.EncodeAddress() != test.transparent {
+			t.Fatalf("%s: got transparent receiver %s, want %s", test.addr, addr.EncodeAddress(), test.transparent)
+		}
+
+		encoded, err := ua.Encode(&MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoded != test.addr {
+			t.Fatalf("got %s, want %s", encoded, test.addr)
+		}
+	}
+}
+
+func TestDecodeUnifiedAddressInvalid(t *testing.T) {
+	net := &MainNetParams
+	encode := func(raw []byte, hrp string) string {
+		padding := uaPadding(hrp)
+		jumbled, err := f4Jumble(append(raw, padding[:]...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := bech32.ConvertBits(jumbled, 8, 5, true)
+		s, err := bech32.EncodeM(hrp, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	orchard := append([]byte{0x03, 43}, make([]byte, 43)...)
+	sapling := append([]byte{0x02, 43}, make([]byte, 43)...)
+
+	if _, err := DecodeUnifiedAddress(encode(orchard, "u"), net); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		addr string
+	}{
+		{"descending typecodes", encode(append(append([]byte(nil), orchard...), sapling...), "u")},
+		{"duplicate typecodes", encode(append(append([]byte(nil), orchard...), orchard...), "u")},
+		{"short receiver", encode(append([]byte{0x03, 42}, make([]byte, 42)...), "u")},
+		{"wrong padding", encode(orchard, "utest")},
+	}
+	for _, test := range tests {
+		if _, err := DecodeUnifiedAddress(test.addr, net); err == nil {
+			t.Fatalf("%s: expected error", test.name)
+		}
+	}
+
+	// Bech32 instead of bech32m.
+	padded := append(append([]byte(nil), orchard...), make([]byte, uaPaddingSize)...)
+	copy(padded[len(orchard):], "u")
+	jumbled, _ := f4Jumble(padded)
+	data, _ := bech32.ConvertBits(jumbled, 8, 5, true)
+	s, _ := bech32.Encode("u", data)
+	if _, err := DecodeUnifiedAddress(s, net); err == nil {
+		t.Fatal("expected error for bech32 checksum")
+	}
+}
@@ -0,0 +1,101 @@
+package zecutil
+
+// Consensus branch IDs of the Zcash network upgrades.
+// https://github.com/zcash/zcash/blob/master/src/consensus/upgrades.cpp
+const (
+	SproutBranchID     uint32 = 0x00000000
+	OverwinterBranchID uint32 = 0x5ba81b19
+	SaplingBranchID    uint32 = 0x76b809bb
+	BlossomBranchID    uint32 = 0x2bb40e60
+	HeartwoodBranchID  uint32 = 0xf5b9230b
+	CanopyBranchID     uint32 = 0xe9ff75a6
+	NU5BranchID        uint32 = 0xc2d6d0b4
+	NU6BranchID        uint32 = 0xc8e71055
+)
+
+// NetworkUpgrade is a consensus rule change that activates at a fixed block
+// height. Transactions mined at or above ActivationHeight commit to BranchID.
+type NetworkUpgrade struct {
+	Name             string
+	ActivationHeight uint32
+	BranchID         uint32
+}
+
+var (
+	// MainNetUpgrades is the upgrade schedule of the Zcash main network.
+	// https://github.com/zcash/zcash/blob/master/src/chainparams.cpp
+	MainNetUpgrades = []NetworkUpgrade{
+		{"Sprout", 0, SproutBranchID},
+		{"Overwinter", 347500, OverwinterBranchID},
+		{"Sapling", 419200, SaplingBranchID},
+		{"Blossom", 653600, BlossomBranchID},
+		{"Heartwood", 903000, HeartwoodBranchID},
+		{"Canopy", 1046400, CanopyBranchID},
+		{"NU5", 1687104, NU5BranchID},
+		{"NU6", 2726400, NU6BranchID},
+	}
+
+	// TestNetUpgrades is the upgrade schedule of the Zcash test network.
+	TestNetUpgrades = []NetworkUpgrade{
+		{"Sprout", 0, SproutBranchID},
+		{"Overwinter", 207500, OverwinterBranchID},
+		{"Sapling", 280000, SaplingBranchID},
+		{"Blossom", 584000, BlossomBranchID},
+		{"Heartwood", 903800, HeartwoodBranchID},
+		{"Canopy", 1028500, CanopyBranchID},
+		{"NU5", 1842420, NU5BranchID},
+		{"NU6", 2976000, NU6BranchID},
+	}
+
+	// RegTestUpgrades is the default regtest upgrade schedule, with every
+	// upgrade active from height 1 as with -nuparams=<branch>:1 in zcashd.
+	RegTestUpgrades = []NetworkUpgrade{
+		{"Sprout", 0, SproutBranchID},
+		{"Overwinter", 1, OverwinterBranchID},
+		{"Sapling", 1, SaplingBranchID},
+		{"Blossom", 1, BlossomBranchID},
+		{"Heartwood", 1, HeartwoodBranchID},
+		{"Canopy", 1, CanopyBranchID},
+		{"NU5", 1, NU5BranchID},
+		{"NU6", 1, NU6BranchID},
+	}
+)
+
+// legacyUpgrades is the schedule NewTxSigHashes guesses the branch ID from
+// using the transaction expiry height. It mixes testnet activation heights
+// for the early upgrades with mainnet ones for the later upgrades and is only
+// kept so that existing signatures stay reproducible.
+var legacyUpgrades = []NetworkUpgrade{
+	{"Sprout", 0, SproutBranchID},
+	{"Overwinter", 207500, OverwinterBranchID},
+	{"Sapling", 280000, SaplingBranchID},
+	{"Blossom", 653600, BlossomBranchID},
+	{"Heartwood", 903000, HeartwoodBranchID},
+	{"Canopy", 1046400, CanopyBranchID},
+	{"NU5", 1687104, NU5BranchID},
+	{"NU6", 2726400, NU6BranchID},
+}
+
+// BranchIDForHeight returns the consensus branch ID that a transaction mined
+// at the given height must commit to under the passed upgrade schedule.
+func BranchIDForHeight(upgrades []NetworkUpgrade, height uint32) uint32 {
+	for i := len(upgrades) - 1; i >= 0; i-- {
+		if height >= upgrades[i].ActivationHeight {
+			return upgrades[i].BranchID
+		}
+	}
+
+	return SproutBranchID
+}
+
+// upgradeIndex returns the position of the upgrade with the given branch ID
+// in MainNetUpgrades, which orders the upgrades of every network, or -1 for an
+// unknown branch ID.
+func upgradeIndex(branchID uint32) int {
+	for i, u := range MainNetUpgrades {
+		if u.BranchID == branchID {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,845 @@
+package zecutil
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Script execution limits enforced by VerifyTx, as in zcashd.
+const (
+	maxScriptElementSize  = 520
+	maxOpsPerScript       = 201
+	maxStackSize          = 1000
+	maxPubKeysPerMultiSig = 20
+
+	// lockTimeThreshold is the lock time below which it is a block height
+	// and above which it is a timestamp.
+	lockTimeThreshold = 500000000
+)
+
+// InputError is the verification failure of a single transparent input.
+type InputError struct {
+	Index int
+	Err   error
+}
+
+func (e *InputError) Error() string {
+	return fmt.Sprintf("input %d: %v", e.Index, e.Err)
+}
+
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+// TxVerifyError lists the inputs of a transaction which failed to verify.
+type TxVerifyError []*InputError
+
+func (e TxVerifyError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// VerifyTx executes the scripts of every transparent input of tx, computing
+// signature hashes with Blake2bSignatureHash for the given consensus branch
+// ID. prevOuts[i] is the output spent by tx.TxIn[i]. Inputs which fail are
+// reported together in a TxVerifyError.
+//
+// Only the opcodes of standard scripts, hash locks, OP_CODESEPARATOR and
+// CHECKLOCKTIMEVERIFY are supported, other scripts fail to verify. As in
+// zcashd, disabled opcodes fail scripts even in unexecuted branches and
+// signatures are removed from the script code they sign.
+func VerifyTx(tx *MsgTx, prevOuts []*wire.TxOut, branchID uint32) error {
+	if len(prevOuts) != len(tx.TxIn) {
+		return fmt.Errorf("got %d previous outputs for %d inputs", len(prevOuts), len(tx.TxIn))
+	}
+
+	sigHashes, err := newTxSigHashesForBranch(tx, prevOuts, branchID)
+	if err != nil {
+		return err
+	}
+
+	var errs TxVerifyError
+	for i, prevOut := range prevOuts {
+		if err = verifyInput(tx, sigHashes, i, prevOut); err != nil {
+			errs = append(errs, &InputError{Index: i, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// verifyInput executes the signature script of an input followed by the
+// script of the output it spends and, for P2SH outputs, the redeem script.
+func verifyInput(tx *MsgTx, sigHashes *TxSigHashes, idx int, prevOut *wire.TxOut) error {
+	sigScript := tx.TxIn[idx].SignatureScript
+	pkScript := prevOut.PkScript
+
+	vm := &scriptVM{tx: tx, sigHashes: sigHashes, idx: idx, amt: prevOut.Value}
+	if err := vm.execute(sigScript); err != nil {
+		return fmt.Errorf("signature script: %w", err)
+	}
+
+	p2sh := txscript.IsPayToScriptHash(pkScript)
+	if p2sh && !txscript.IsPushOnlyScript(sigScript) {
+		return errors.New("signature script of p2sh input is not push only")
+	}
+	stack := append([][]byte(nil), vm.stack...)
+
+	if err := vm.execute(pkScript); err != nil {
+		return err
+	}
+	if !vm.success() {
+		return errors.New("script evaluated to false")
+	}
+	if !p2sh {
+		return nil
+	}
+
+	// The redeem script is the last push of the signature script, which the
+	// output committed to the hash of.
+	if len(stack) == 0 {
+		return errors.New("missing redeem script")
+	}
+	vm.stack = stack[:len(stack)-1]
+	if err := vm.execute(stack[len(stack)-1]); err != nil {
+		return fmt.Errorf("redeem script: %w", err)
+	}
+	if !vm.success() {
+		return errors.New("redeem script evaluated to false")
+	}
+	return nil
+}
+
+// scriptVM executes transparent scripts against an input of a transaction.
+type scriptVM struct {
+	tx        *MsgTx
+	sigHashes *TxSigHashes
+	idx       int
+	amt       int64
+
+	// stack persists across the scripts of an input, altStack and nOps are
+	// reset for each script.
+	stack    [][]byte
+	altStack [][]byte
+	nOps     int
+}
+
+// success reports whether the script left a true value on top of the stack.
+func (vm *scriptVM) success() bool {
+	return len(vm.stack) > 0 && asBool(vm.stack[len(vm.stack)-1])
+}
+
+func (vm *scriptVM) push(b []byte) {
+	vm.stack = append(vm.stack, b)
+}
+
+func (vm *scriptVM) pop() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, errors.New("stack underflow")
+	}
+	b := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return b, nil
+}
+
+func (vm *scriptVM) peek(depth int) ([]byte, error) {
+	if depth >= len(vm.stack) {
+		return nil, errors.New("stack underflow")
+	}
+	return vm.stack[len(vm.stack)-1-depth], nil
+}
+
+// need fails unless the stack holds at least n elements.
+func (vm *scriptVM) need(n int) error {
+	if len(vm.stack) < n {
+		return errors.New("stack underflow")
+	}
+	return nil
+}
+
+// roll moves the n elements starting at the given depth to the top of the
+// stack, the elements above them moving down.
+func (vm *scriptVM) roll(depth, n int) {
+	i := len(vm.stack) - 1 - depth
+	moved := append([][]byte(nil), vm.stack[i:i+n]...)
+	copy(vm.stack[i:], vm.stack[i+n:])
+	copy(vm.stack[len(vm.stack)-n:], moved)
+}
+
+func (vm *scriptVM) popInt(maxLen int) (int64, error) {
+	b, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	return scriptNum(b, maxLen)
+}
+
+// execute runs script on the current stack.
+func (vm *scriptVM) execute(script []byte) error {
+	if len(script) > MaxScriptSize {
+		return errors.New("script too large")
+	}
+
+	// conds holds whether each enclosing IF branch is executed.
+	var conds []bool
+	executing := func() bool {
+		for _, c := range conds {
+			if !c {
+				return false
+			}
+		}
+		return true
+	}
+
+	// scriptCode is the part of the script signatures commit to, following
+	// the last executed OP_CODESEPARATOR.
+	scriptCode := script
+
+	vm.altStack = nil
+	vm.nOps = 0
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for tokenizer.Next() {
+		op := tokenizer.Opcode()
+		if len(tokenizer.Data()) > maxScriptElementSize {
+			return errors.New("push exceeds the maximum element size")
+		}
+		if op > txscript.OP_16 {
+			if vm.nOps++; vm.nOps > maxOpsPerScript {
+				return errors.New("too many operations")
+			}
+		}
+		if isDisabledOpcode(op) {
+			return fmt.Errorf("disabled opcode 0x%02x", op)
+		}
+
+		switch op {
+		case txscript.OP_IF, txscript.OP_NOTIF:
+			cond := false
+			if executing() {
+				b, err := vm.pop()
+				if err != nil {
+					return err
+				}
+				cond = asBool(b) == (op == txscript.OP_IF)
+			}
+			conds = append(conds, cond)
+			continue
+		case txscript.OP_ELSE:
+			if len(conds) == 0 {
+				return errors.New("OP_ELSE without OP_IF")
+			}
+			conds[len(conds)-1] = !conds[len(conds)-1]
+			continue
+		case txscript.OP_ENDIF:
+			if len(conds) == 0 {
+				return errors.New("OP_ENDIF without OP_IF")
+			}
+			conds = conds[:len(conds)-1]
+			continue
+		}
+		if !executing() {
+			continue
+		}
+
+		if op == txscript.OP_CODESEPARATOR {
+			scriptCode = script[tokenizer.ByteIndex():]
+			continue
+		}
+		if err := vm.step(op, tokenizer.Data(), scriptCode); err != nil {
+			return err
+		}
+		if len(vm.stack)+len(vm.altStack) > maxStackSize {
+			return errors.New("stack size exceeded")
+		}
+	}
+	if err := tokenizer.Err(); err != nil {
+		return err
+	}
+	if len(conds) > 0 {
+		return errors.New("unbalanced conditional")
+	}
+	return nil
+}
+
+// step executes a single opcode, signatures committing to scriptCode.
+func (vm *scriptVM) step(op byte, data, scriptCode []byte) error {
+	switch {
+	case op == txscript.OP_0:
+		vm.push(nil)
+		return nil
+	case op <= txscript.OP_PUSHDATA4:
+		vm.push(data)
+		return nil
+	case op == txscript.OP_1NEGATE:
+		vm.push([]byte{0x81})
+		return nil
+	case op >= txscript.OP_1 && op <= txscript.OP_16:
+		vm.push([]byte{op - txscript.OP_1 + 1})
+		return nil
+	}
+
+	switch op {
+	case txscript.OP_NOP, txscript.OP_NOP1, txscript.OP_NOP3, txscript.OP_NOP4, txscript.OP_NOP5,
+		txscript.OP_NOP6, txscript.OP_NOP7, txscript.OP_NOP8, txscript.OP_NOP9, txscript.OP_NOP10:
+
+	case txscript.OP_VERIFY:
+		return vm.verify(op)
+
+	case txscript.OP_RETURN:
+		return errors.New("OP_RETURN executed")
+
+	case txscript.OP_TOALTSTACK:
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.altStack = append(vm.altStack, b)
+
+	case txscript.OP_FROMALTSTACK:
+		if len(vm.altStack) == 0 {
+			return errors.New("alt stack underflow")
+		}
+		vm.push(vm.altStack[len(vm.altStack)-1])
+		vm.altStack = vm.altStack[:len(vm.altStack)-1]
+
+	case txscript.OP_DROP, txscript.OP_2DROP:
+		n := 1
+		if op == txscript.OP_2DROP {
+			n = 2
+		}
+		if err := vm.need(n); err != nil {
+			return err
+		}
+		vm.stack = vm.stack[:len(vm.stack)-n]
+
+	case txscript.OP_DUP, txscript.OP_2DUP, txscript.OP_3DUP:
+		n := 1
+		switch op {
+		case txscript.OP_2DUP:
+			n = 2
+		case txscript.OP_3DUP:
+			n = 3
+		}
+		if err := vm.need(n); err != nil {
+			return err
+		}
+		vm.stack = append(vm.stack, vm.stack[len(vm.stack)-n:]...)
+
+	case txscript.OP_OVER, txscript.OP_2OVER:
+		n := 1
+		if op == txscript.OP_2OVER {
+			n = 2
+		}
+		if err := vm.need(2 * n); err != nil {
+			return err
+		}
+		top := len(vm.stack) - 2*n
+		vm.stack = append(vm.stack, vm.stack[top:top+n]...)
+
+	case txscript.OP_ROT, txscript.OP_2ROT:
+		n := 1
+		if op == txscript.OP_2ROT {
+			n = 2
+		}
+		if err := vm.need(3 * n); err != nil {
+			return err
+		}
+		vm.roll(3*n-1, n)
+
+	case txscript.OP_SWAP, txscript.OP_2SWAP:
+		n := 1
+		if op == txscript.OP_2SWAP {
+			n = 2
+		}
+		if err := vm.need(2 * n); err != nil {
+			return err
+		}
+		vm.roll(2*n-1, n)
+
+	case txscript.OP_IFDUP:
+		b, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		if asBool(b) {
+			vm.push(b)
+		}
+
+	case txscript.OP_DEPTH:
+		vm.push(scriptNumBytes(int64(len(vm.stack))))
+
+	case txscript.OP_NIP:
+		if err := vm.need(2); err != nil {
+			return err
+		}
+		vm.roll(1, 1)
+		vm.stack = vm.stack[:len(vm.stack)-1]
+
+	case txscript.OP_PICK, txscript.OP_ROLL:
+		n, err := vm.popInt(4)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n >= int64(len(vm.stack)) {
+			return fmt.Errorf("invalid stack index %d", n)
+		}
+		if op == txscript.OP_ROLL {
+			vm.roll(int(n), 1)
+		} else {
+			vm.push(vm.stack[len(vm.stack)-1-int(n)])
+		}
+
+	case txscript.OP_TUCK:
+		if err := vm.need(2); err != nil {
+			return err
+		}
+		top := vm.stack[len(vm.stack)-1]
+		vm.stack = append(vm.stack, nil)
+		copy(vm.stack[len(vm.stack)-2:], vm.stack[len(vm.stack)-3:len(vm.stack)-1])
+		vm.stack[len(vm.stack)-3] = top
+
+	case txscript.OP_SIZE:
+		b, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		vm.push(scriptNumBytes(int64(len(b))))
+
+	case txscript.OP_EQUAL, txscript.OP_EQUALVERIFY:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.push(boolBytes(bytes.Equal(a, b)))
+		if op == txscript.OP_EQUALVERIFY {
+			return vm.verify(op)
+		}
+
+	case txscript.OP_1ADD, txscript.OP_1SUB, txscript.OP_NEGATE, txscript.OP_ABS, txscript.OP_NOT,
+		txscript.OP_0NOTEQUAL:
+
+		n, err := vm.popInt(4)
+		if err != nil {
+			return err
+		}
+		switch op {
+		case txscript.OP_1ADD:
+			n++
+		case txscript.OP_1SUB:
+			n--
+		case txscript.OP_NEGATE:
+			n = -n
+		case txscript.OP_ABS:
+			if n < 0 {
+				n = -n
+			}
+		case txscript.OP_NOT:
+			n = boolNum(n == 0)
+		default:
+			n = boolNum(n != 0)
+		}
+		vm.push(scriptNumBytes(n))
+
+	case txscript.OP_ADD, txscript.OP_SUB, txscript.OP_BOOLAND, txscript.OP_BOOLOR, txscript.OP_NUMEQUAL,
+		txscript.OP_NUMEQUALVERIFY, txscript.OP_NUMNOTEQUAL, txscript.OP_LESSTHAN, txscript.OP_GREATERTHAN,
+		txscript.OP_LESSTHANOREQUAL, txscript.OP_GREATERTHANOREQUAL, txscript.OP_MIN, txscript.OP_MAX:
+
+		b, err := vm.popInt(4)
+		if err != nil {
+			return err
+		}
+		a, err := vm.popInt(4)
+		if err != nil {
+			return err
+		}
+		var n int64
+		switch op {
+		case txscript.OP_ADD:
+			n = a + b
+		case txscript.OP_SUB:
+			n = a - b
+		case txscript.OP_BOOLAND:
+			n = boolNum(a != 0 && b != 0)
+		case txscript.OP_BOOLOR:
+			n = boolNum(a != 0 || b != 0)
+		case txscript.OP_NUMEQUAL, txscript.OP_NUMEQUALVERIFY:
+			n = boolNum(a == b)
+		case txscript.OP_NUMNOTEQUAL:
+			n = boolNum(a != b)
+		case txscript.OP_LESSTHAN:
+			n = boolNum(a < b)
+		case txscript.OP_GREATERTHAN:
+			n = boolNum(a > b)
+		case txscript.OP_LESSTHANOREQUAL:
+			n = boolNum(a <= b)
+		case txscript.OP_GREATERTHANOREQUAL:
+			n = boolNum(a >= b)
+		case txscript.OP_MIN:
+			n = min(a, b)
+		default:
+			n = max(a, b)
+		}
+		vm.push(scriptNumBytes(n))
+		if op == txscript.OP_NUMEQUALVERIFY {
+			return vm.verify(op)
+		}
+
+	case txscript.OP_WITHIN:
+		hi, err := vm.popInt(4)
+		if err != nil {
+			return err
+		}
+		lo, err := vm.popInt(4)
+		if err != nil {
+			return err
+		}
+		x, err := vm.popInt(4)
+		if err != nil {
+			return err
+		}
+		vm.push(boolBytes(lo <= x && x < hi))
+
+	case txscript.OP_RIPEMD160, txscript.OP_SHA1, txscript.OP_SHA256, txscript.OP_HASH160, txscript.OP_HASH256:
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case txscript.OP_RIPEMD160:
+			h := ripemd160.New()
+			h.Write(b)
+			vm.push(h.Sum(nil))
+		case txscript.OP_SHA1:
+			h := sha1.Sum(b)
+			vm.push(h[:])
+		case txscript.OP_SHA256:
+			h := sha256.Sum256(b)
+			vm.push(h[:])
+		case txscript.OP_HASH160:
+			vm.push(btcutil.Hash160(b))
+		default:
+			vm.push(chainhash.DoubleHashB(b))
+		}
+
+	case txscript.OP_CHECKSIG, txscript.OP_CHECKSIGVERIFY:
+		pubKey, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		valid, err := checkSig(vm.tx, vm.sigHashes, vm.idx, findAndDelete(scriptCode, sig), vm.amt, sig, pubKey)
+		if err != nil {
+			return err
+		}
+		vm.push(boolBytes(valid))
+		if op == txscript.OP_CHECKSIGVERIFY {
+			return vm.verify(op)
+		}
+
+	case txscript.OP_CHECKMULTISIG, txscript.OP_CHECKMULTISIGVERIFY:
+		if err := vm.checkMultiSig(scriptCode); err != nil {
+			return err
+		}
+		if op == txscript.OP_CHECKMULTISIGVERIFY {
+			return vm.verify(op)
+		}
+
+	case txscript.OP_CHECKLOCKTIMEVERIFY:
+		return vm.checkLockTime()
+
+	default:
+		return fmt.Errorf("unsupported opcode 0x%02x", op)
+	}
+
+	return nil
+}
+
+// verify pops the top of the stack and fails unless it is true.
+func (vm *scriptVM) verify(op byte) error {
+	b, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if !asBool(b) {
+		return fmt.Errorf("opcode 0x%02x failed", op)
+	}
+	return nil
+}
+
+// checkMultiSig executes OP_CHECKMULTISIG. Signatures must be in the same
+// order as the public keys they sign for.
+func (vm *scriptVM) checkMultiSig(scriptCode []byte) error {
+	nKeys, err := vm.popInt(4)
+	if err != nil {
+		return err
+	}
+	if nKeys < 0 || nKeys > maxPubKeysPerMultiSig {
+		return fmt.Errorf("invalid public key count %d", nKeys)
+	}
+	// Every key counts as an operation.
+	if vm.nOps += int(nKeys); vm.nOps > maxOpsPerScript {
+		return errors.New("too many operations")
+	}
+	pubKeys := make([][]byte, nKeys)
+	for i := range pubKeys {
+		if pubKeys[i], err = vm.pop(); err != nil {
+			return err
+		}
+	}
+
+	nSigs, err := vm.popInt(4)
+	if err != nil {
+		return err
+	}
+	if nSigs < 0 || nSigs > nKeys {
+		return fmt.Errorf("invalid signature count %d", nSigs)
+	}
+	sigs := make([][]byte, nSigs)
+	for i := range sigs {
+		if sigs[i], err = vm.pop(); err != nil {
+			return err
+		}
+	}
+
+	// The extra element consumed by the original implementation.
+	if _, err = vm.pop(); err != nil {
+		return err
+	}
+
+	for _, sig := range sigs {
+		scriptCode = findAndDelete(scriptCode, sig)
+	}
+
+	// Keys and signatures were popped in reverse order, match them from
+	// the last one.
+	valid := true
+	for len(sigs) > 0 {
+		if len(sigs) > len(pubKeys) {
+			valid = false
+			break
+		}
+		ok, err := checkSig(vm.tx, vm.sigHashes, vm.idx, scriptCode, vm.amt, sigs[0], pubKeys[0])
+		if err != nil {
+			return err
+		}
+		if ok {
+			sigs = sigs[1:]
+		}
+		pubKeys = pubKeys[1:]
+	}
+
+	vm.push(boolBytes(valid))
+	return nil
+}
+
+// checkLockTime executes OP_CHECKLOCKTIMEVERIFY (BIP65).
+func (vm *scriptVM) checkLockTime() error {
+	b, err := vm.peek(0)
+	if err != nil {
+		return err
+	}
+	lockTime, err := scriptNum(b, 5)
+	if err != nil {
+		return err
+	}
+	if lockTime < 0 {
+		return errors.New("negative lock time")
+	}
+
+	txLockTime := int64(vm.tx.LockTime)
+	if (lockTime < lockTimeThreshold) != (txLockTime < lockTimeThreshold) {
+		return errors.New("mismatched lock time types")
+	}
+	if lockTime > txLockTime {
+		return fmt.Errorf("lock time %d not reached by %d", lockTime, txLockTime)
+	}
+	if vm.tx.TxIn[vm.idx].Sequence == wire.MaxTxInSequenceNum {
+		return errors.New("lock time disabled by input sequence")
+	}
+	return nil
+}
+
+// checkSig reports whether sig, a DER signature followed by its hash type,
+// is a valid signature by pubKey of the Zcash signature hash of input idx with
+// the given script code. Malformed signatures and public keys are invalid.
+func checkSig(
+	tx *MsgTx,
+	sigHashes *TxSigHashes,
+	idx int,
+	script []byte,
+	amt int64,
+	sig, pubKey []byte,
+) (bool, error) {
+	if len(sig) == 0 {
+		return false, nil
+	}
+	hashType := txscript.SigHashType(sig[len(sig)-1])
+
+	signature, err := ecdsa.ParseDERSignature(sig[:len(sig)-1])
+	if err != nil {
+		return false, nil
+	}
+	key, err := btcec.ParsePubKey(pubKey)
+	if err != nil {
+		return false, nil
+	}
+
+	// The hash fails for hash types undefined in v5 transactions, which
+	// makes the signature invalid rather than the script.
+	hash, err := Blake2bSignatureHash(script, sigHashes, hashType, tx, idx, amt)
+	if err != nil {
+		return false, nil
+	}
+	return signature.Verify(hash, key), nil
+}
+
+// isDisabledOpcode reports whether op fails the script wherever it appears:
+// the opcodes disabled by Bitcoin and OP_VERIF and OP_VERNOTIF.
+func isDisabledOpcode(op byte) bool {
+	switch op {
+	case txscript.OP_CAT, txscript.OP_SUBSTR, txscript.OP_LEFT, txscript.OP_RIGHT,
+		txscript.OP_INVERT, txscript.OP_AND, txscript.OP_OR, txscript.OP_XOR,
+		txscript.OP_2MUL, txscript.OP_2DIV, txscript.OP_MUL, txscript.OP_DIV, txscript.OP_MOD,
+		txscript.OP_LSHIFT, txscript.OP_RSHIFT, txscript.OP_VERIF, txscript.OP_VERNOTIF:
+
+		return true
+	}
+	return false
+}
+
+// findAndDelete returns script without the pushes of data, matched as the
+// bytes of their non-minimal push at opcode boundaries like the FindAndDelete
+// of zcashd. script is returned unchanged when data is not pushed.
+func findAndDelete(script, data []byte) []byte {
+	var pattern []byte
+	switch n := len(data); {
+	case n < txscript.OP_PUSHDATA1:
+		pattern = []byte{byte(n)}
+	case n <= 0xff:
+		pattern = []byte{txscript.OP_PUSHDATA1, byte(n)}
+	case n <= 0xffff:
+		pattern = []byte{txscript.OP_PUSHDATA2, byte(n), byte(n >> 8)}
+	default:
+		pattern = []byte{txscript.OP_PUSHDATA4, byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)}
+	}
+	pattern = append(pattern, data...)
+
+	var res []byte
+	found := false
+	for pos := 0; pos < len(script); {
+		if bytes.HasPrefix(script[pos:], pattern) {
+			pos += len(pattern)
+			found = true
+			continue
+		}
+
+		// Copy the opcode at pos, or the rest of a malformed script.
+		next := len(script)
+		tokenizer := txscript.MakeScriptTokenizer(0, script[pos:])
+		if tokenizer.Next() {
+			next = pos + int(tokenizer.ByteIndex())
+		}
+		res = append(res, script[pos:next]...)
+		pos = next
+	}
+	if !found {
+		return script
+	}
+	return res
+}
+
+// asBool interprets a stack element as a boolean, negative zero is false.
+func asBool(b []byte) bool {
+	for i := range b {
+		if b[i] != 0 {
+			return i != len(b)-1 || b[i] != 0x80
+		}
+	}
+	return false
+}
+
+func boolNum(v bool) int64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func boolBytes(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+	return nil
+}
+
+// scriptNum decodes a little-endian sign-magnitude script number of at most
+// maxLen bytes.
+func scriptNum(b []byte, maxLen int) (int64, error) {
+	if len(b) > maxLen {
+		return 0, fmt.Errorf("numeric value of %d bytes exceeds %d", len(b), maxLen)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	var v int64
+	for i, c := range b {
+		v |= int64(c) << (8 * i)
+	}
+	if b[len(b)-1]&0x80 != 0 {
+		v &^= int64(0x80) << (8 * (len(b) - 1))
+		return -v, nil
+	}
+	return v, nil
+}
+
+// scriptNumBytes encodes a script number.
+func scriptNumBytes(v int64) []byte {
+	if v == 0 {
+		return nil
+	}
+
+	neg := v < 0
+	if neg {
+		v = -v
+	}
+	var b []byte
+	for v > 0 {
+		b = append(b, byte(v))
+		v >>= 8
+	}
+	if b[len(b)-1]&0x80 != 0 {
+		extra := byte(0)
+		if neg {
+			extra = 0x80
+		}
+		b = append(b, extra)
+	} else if neg {
+		b[len(b)-1] |= 0x80
+	}
+	return b
+}
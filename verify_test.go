@@ -0,0 +1,397 @@
+package zecutil
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// newTestKeyStore returns a KeyStore holding n deterministic keys and their
+// public keys.
+func newTestKeyStore(t *testing.T, n int) (*KeyStore, []*btcutil.AddressPubKey) {
+	store := NewKeyStore(netParams)
+	pubKeys := make([]*btcutil.AddressPubKey, n)
+	for i := range pubKeys {
+		seed := sha256.Sum256([]byte{byte(i)})
+		privKey, pubKey := btcec.PrivKeyFromBytes(seed[:])
+		wif, err := EncodeWIF(privKey, true, netParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = store.ImportWIF(wif); err != nil {
+			t.Fatal(err)
+		}
+		if pubKeys[i], err = btcutil.NewAddressPubKey(pubKey.SerializeCompressed(), &netParams.Params); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store, pubKeys
+}
+
+func TestVerifyTx(t *testing.T) {
+	const signed = "030000807082c403011c15616e8b9a75ad4079a17bb296bcba8bda2712453baf1bde447bfe46be46e4010000006b48304502210093f8edae9784fee695d5ac5f84b4217084345a53c31c9e1e8e2a183ebe15cace02206872d90d0af77a4a4c18b761cf511e4583597ee5503e0e82e491da0f1a4377ed012103362327ee808f5961d26ef1a431386d6190638d67c14aa0e78e2eba1b58870cc0ffffffff02400d0300000000001976a9143b535da0ba90dad71ea005cccfe3cca47d746b3a88ac70d2dd11000000001976a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac00000000ff47030000"
+	pkScript := mustDecodeHex(t, "76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac")
+
+	tx, err := ZecTxFromHex(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevOuts := []*wire.TxOut{wire.NewTxOut(0, pkScript)}
+	if err = VerifyTx(tx, prevOuts, OverwinterBranchID); err != nil {
+		t.Fatal(err)
+	}
+
+	err = VerifyTx(tx, prevOuts, SaplingBranchID)
+	var verifyErr TxVerifyError
+	if !errors.As(err, &verifyErr) || len(verifyErr) != 1 || verifyErr[0].Index != 0 {
+		t.Fatalf("got %v, want a failure of input 0", err)
+	}
+	if err = VerifyTx(tx, []*wire.TxOut{wire.NewTxOut(1, pkScript)}, OverwinterBranchID); err == nil {
+		t.Fatal("expected error with another amount")
+	}
+	if err = VerifyTx(tx, nil, OverwinterBranchID); err == nil {
+		t.Fatal("expected error without previous outputs")
+	}
+}
+
+func TestVerifyTxBuilder(t *testing.T) {
+	store := NewKeyStore(netParams)
+	if _, err := store.ImportWIF(testWif); err != nil {
+		t.Fatal(err)
+	}
+	pkScript := mustDecodeHex(t, "76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac")
+	recipient, _ := DecodeAddress(senderAddr, netParams)
+
+	for _, height := range []uint32{250000, 300000, 3000000} {
+		b := NewTxBuilder(netParams)
+		prevOuts := make([]*wire.TxOut, 3)
+		for i := range prevOuts {
+			prevOuts[i] = wire.NewTxOut(int64(100000*(i+1)), pkScript)
+			b.AddInput(&UTXO{OutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(i)}}, PkScript: pkScript, Amount: prevOuts[i].Value})
+		}
+		if err := b.AddOutput(recipient, 500000); err != nil {
+			t.Fatal(err)
+		}
+		b.SetChangeAddress(recipient)
+		tx, err := b.Build(height, store, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		branchID := netParams.ConsensusBranchID(height)
+		if err = VerifyTx(tx, prevOuts, branchID); err != nil {
+			t.Fatalf("height %d: %v", height, err)
+		}
+
+		// Swapping the signatures of two inputs fails both of them.
+		tx.TxIn[0].SignatureScript, tx.TxIn[2].SignatureScript = tx.TxIn[2].SignatureScript, tx.TxIn[0].SignatureScript
+		err = VerifyTx(tx, prevOuts, branchID)
+		var verifyErr TxVerifyError
+		if !errors.As(err, &verifyErr) || len(verifyErr) != 2 || verifyErr[0].Index != 0 || verifyErr[1].Index != 2 {
+			t.Fatalf("height %d: got %v", height, err)
+		}
+	}
+}
+
+func TestVerifyTxMultiSig(t *testing.T) {
+	store, pubKeys := newTestKeyStore(t, 3)
+	redeemScript, err := txscript.MultiSigScript(pubKeys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptAddr, err := btcutil.NewAddressScriptHash(redeemScript, &netParams.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(scriptAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb := txscript.ScriptClosure(func(btcutil.Address) ([]byte, error) {
+		return redeemScript, nil
+	})
+
+	tx := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling), ExpiryHeight: 300040}
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(90000, pkScript))
+	prevOuts := []*wire.TxOut{wire.NewTxOut(100000, pkScript)}
+
+	tx.TxIn[0].SignatureScript, err = SignTxOutputWithBranchID(netParams, SaplingBranchID, tx, 0, pkScript,
+		txscript.SigHashAll, store, sdb, nil, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyTx(tx, prevOuts, SaplingBranchID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Signatures in the wrong order don't verify.
+	pushes, err := txscript.PushedData(tx.TxIn[0].SignatureScript)
+	if err != nil || len(pushes) != 4 {
+		t.Fatalf("unexpected signature script %x", tx.TxIn[0].SignatureScript)
+	}
+	swapped, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(pushes[2]).AddData(pushes[1]).
+		AddData(pushes[3]).Script()
+	tx.TxIn[0].SignatureScript = swapped
+	if err = VerifyTx(tx, prevOuts, SaplingBranchID); err == nil {
+		t.Fatal("expected error for signatures out of order")
+	}
+
+	// A single signature doesn't satisfy 2-of-3.
+	single, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(pushes[1]).AddData(pushes[1]).
+		AddData(pushes[3]).Script()
+	tx.TxIn[0].SignatureScript = single
+	if err = VerifyTx(tx, prevOuts, SaplingBranchID); err == nil {
+		t.Fatal("expected error for a repeated signature")
+	}
+
+	// The keys of a multisig count towards the operation limit.
+	zeroOfTwenty := func(nops int) []byte {
+		b := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddOp(txscript.OP_0)
+		for i := 0; i < maxPubKeysPerMultiSig; i++ {
+			b.AddData(pubKeys[0].ScriptAddress())
+		}
+		b.AddInt64(maxPubKeysPerMultiSig)
+		for i := 0; i < nops; i++ {
+			b.AddOp(txscript.OP_NOP)
+		}
+		script, _ := b.AddOp(txscript.OP_CHECKMULTISIG).Script()
+		return script
+	}
+	tx.TxIn[0].SignatureScript = nil
+	if err = VerifyTx(tx, []*wire.TxOut{wire.NewTxOut(0, zeroOfTwenty(180))}, SaplingBranchID); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyTx(tx, []*wire.TxOut{wire.NewTxOut(0, zeroOfTwenty(181))}, SaplingBranchID); err == nil {
+		t.Fatal("expected error for too many operations")
+	}
+}
+
+func TestScriptVM(t *testing.T) {
+	preimage := []byte("zcash")
+	hash := sha256.Sum256(preimage)
+
+	// Hash locked output, refundable after height 1000.
+	script, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_IF).
+		AddOp(txscript.OP_SHA256).AddData(hash[:]).AddOp(txscript.OP_EQUAL).
+		AddOp(txscript.OP_ELSE).
+		AddInt64(1000).AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).AddOp(txscript.OP_DROP).AddOp(txscript.OP_TRUE).
+		AddOp(txscript.OP_ENDIF).
+		Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		sig      *txscript.ScriptBuilder
+		lockTime uint32
+		sequence uint32
+		valid    bool
+	}{
+		{"preimage", txscript.NewScriptBuilder().AddData(preimage).AddOp(txscript.OP_TRUE), 0, 0, true},
+		{"wrong preimage", txscript.NewScriptBuilder().AddData([]byte("zec")).AddOp(txscript.OP_TRUE), 0, 0, false},
+		{"refund", txscript.NewScriptBuilder().AddOp(txscript.OP_FALSE), 1000, 0, true},
+		{"early refund", txscript.NewScriptBuilder().AddOp(txscript.OP_FALSE), 999, 0, false},
+		{"refund with final sequence", txscript.NewScriptBuilder().AddOp(txscript.OP_FALSE), 1000, wire.MaxTxInSequenceNum, false},
+		{"refund with timestamp", txscript.NewScriptBuilder().AddOp(txscript.OP_FALSE), lockTimeThreshold, 0, false},
+	}
+	for _, test := range tests {
+		sigScript, _ := test.sig.Script()
+		tx := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling)}
+		tx.LockTime = test.lockTime
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, sigScript, nil))
+		tx.TxIn[0].Sequence = test.sequence
+
+		err := VerifyTx(tx, []*wire.TxOut{wire.NewTxOut(0, script)}, SaplingBranchID)
+		if (err == nil) != test.valid {
+			t.Fatalf("%s: got %v", test.name, err)
+		}
+	}
+
+	for _, n := range []int64{0, 1, -1, 127, 128, -128, 255, 256, 1 << 31, -(1 << 31)} {
+		got, err := scriptNum(scriptNumBytes(n), 5)
+		if err != nil || got != n {
+			t.Fatalf("%d: got %d, %v", n, got, err)
+		}
+	}
+	if asBool([]byte{0, 0x80}) || !asBool([]byte{0x80, 0}) || asBool(nil) {
+		t.Fatal("unexpected boolean value")
+	}
+
+	unsupported := []byte{txscript.OP_TRUE, txscript.OP_CAT}
+	tx := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling)}
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	if err = VerifyTx(tx, []*wire.TxOut{wire.NewTxOut(0, unsupported)}, SaplingBranchID); err == nil {
+		t.Fatal("expected error for unsupported opcode")
+	}
+	if !bytes.Equal(scriptNumBytes(-1), []byte{0x81}) {
+		t.Fatal("unexpected encoding of -1")
+	}
+}
+
+func TestScriptVMCodeSeparator(t *testing.T) {
+	seed := sha256.Sum256([]byte("codeseparator"))
+	privKey, pubKey := btcec.PrivKeyFromBytes(seed[:])
+
+	newTx := func() *MsgTx {
+		tx := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling), ExpiryHeight: 300040}
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(90000, nil))
+		return tx
+	}
+	verify := func(pkScript, scriptCode []byte, pushSig bool) error {
+		tx := newTx()
+		sig, err := RawTxInSignatureWithBranchID(tx, SaplingBranchID, 0, scriptCode, txscript.SigHashAll, privKey, 100000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pushSig {
+			// The output pushes the signature itself, which is removed from
+			// the script code it signs.
+			pkScript = append(append([]byte{byte(len(sig))}, sig...), pkScript...)
+		}
+		tx.TxIn[0].SignatureScript, _ = txscript.NewScriptBuilder().AddData(sig).Script()
+		return VerifyTx(tx, []*wire.TxOut{wire.NewTxOut(100000, pkScript)}, SaplingBranchID)
+	}
+
+	checkSig, _ := txscript.NewScriptBuilder().AddData(pubKey.SerializeCompressed()).AddOp(txscript.OP_CHECKSIG).Script()
+
+	// Signatures commit to the script following the last executed
+	// OP_CODESEPARATOR.
+	separated := append([]byte{txscript.OP_CODESEPARATOR}, checkSig...)
+	if err := verify(separated, checkSig, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(separated, separated, false); err == nil {
+		t.Fatal("expected error for a signature over the whole script")
+	}
+	skipped := append([]byte{txscript.OP_0, txscript.OP_IF, txscript.OP_CODESEPARATOR, txscript.OP_ENDIF}, checkSig...)
+	if err := verify(skipped, skipped, false); err != nil {
+		t.Fatal(err)
+	}
+
+	dropCheckSig := append([]byte{txscript.OP_DROP}, checkSig...)
+	if err := verify(dropCheckSig, dropCheckSig, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only pushes encoded as the signature is pushed are removed.
+	data := []byte{1, 2, 3}
+	script := []byte{txscript.OP_1, 3, 1, 2, 3, txscript.OP_PUSHDATA1, 3, 1, 2, 3, 3, 1, 2, 3}
+	want := []byte{txscript.OP_1, txscript.OP_PUSHDATA1, 3, 1, 2, 3}
+	if got := findAndDelete(script, data); !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+	// A push of the pattern bytes is not an opcode boundary.
+	wrapped := []byte{5, 3, 1, 2, 3, txscript.OP_1}
+	if got := findAndDelete(wrapped, data); !bytes.Equal(got, wrapped) {
+		t.Fatalf("got %x, want %x", got, wrapped)
+	}
+}
+
+func TestScriptVMInvalidHashType(t *testing.T) {
+	seed := sha256.Sum256([]byte("hashtype"))
+	privKey, pubKey := btcec.PrivKeyFromBytes(seed[:])
+
+	// A well formed signature with a hash type undefined in v5 transactions
+	// is invalid, which OP_NOT turns into success.
+	hash := sha256.Sum256(nil)
+	sig := append(ecdsa.Sign(privKey, hash[:]).Serialize(), 0x04)
+	script, err := txscript.NewScriptBuilder().AddData(sig).AddData(pubKey.SerializeCompressed()).
+		AddOp(txscript.OP_CHECKSIG).AddOp(txscript.OP_NOT).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := &MsgTx{MsgTx: wire.NewMsgTx(versionNU5), ExpiryHeight: 300040, ConsensusBranchID: NU5BranchID}
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(90000, nil))
+	if err = VerifyTx(tx, []*wire.TxOut{wire.NewTxOut(100000, script)}, NU5BranchID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScriptVMDisabledOpcodes(t *testing.T) {
+	unexecuted := func(op byte) []byte {
+		return []byte{txscript.OP_0, txscript.OP_IF, op, txscript.OP_ENDIF, txscript.OP_TRUE}
+	}
+	tx := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling)}
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+
+	for _, op := range []byte{txscript.OP_CAT, txscript.OP_MUL, txscript.OP_LSHIFT, txscript.OP_VERIF} {
+		if err := VerifyTx(tx, []*wire.TxOut{wire.NewTxOut(0, unexecuted(op))}, SaplingBranchID); err == nil {
+			t.Fatalf("expected error for disabled opcode 0x%02x in an unexecuted branch", op)
+		}
+	}
+	// Other opcodes only fail when executed.
+	if err := VerifyTx(tx, []*wire.TxOut{wire.NewTxOut(0, unexecuted(txscript.OP_RESERVED))}, SaplingBranchID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScriptVMOpcodes(t *testing.T) {
+	sha1Hash := sha1.Sum([]byte("zcash"))
+
+	tests := []struct {
+		name   string
+		script *txscript.ScriptBuilder
+		valid  bool
+	}{
+		{"add", txscript.NewScriptBuilder().AddInt64(2).AddInt64(3).AddOp(txscript.OP_ADD).AddInt64(5).AddOp(txscript.OP_NUMEQUAL), true},
+		{"sub", txscript.NewScriptBuilder().AddInt64(2).AddInt64(3).AddOp(txscript.OP_SUB).AddInt64(-1).AddOp(txscript.OP_NUMEQUAL), true},
+		{"1add", txscript.NewScriptBuilder().AddInt64(-1).AddOp(txscript.OP_1ADD).AddOp(txscript.OP_NOT), true},
+		{"0notequal", txscript.NewScriptBuilder().AddInt64(7).AddOp(txscript.OP_0NOTEQUAL), true},
+		{"abs negate", txscript.NewScriptBuilder().AddInt64(4).AddOp(txscript.OP_NEGATE).AddOp(txscript.OP_ABS).AddInt64(4).AddOp(txscript.OP_NUMEQUAL), true},
+		{"booland", txscript.NewScriptBuilder().AddInt64(1).AddInt64(0).AddOp(txscript.OP_BOOLAND), false},
+		{"boolor", txscript.NewScriptBuilder().AddInt64(1).AddInt64(0).AddOp(txscript.OP_BOOLOR), true},
+		{"within", txscript.NewScriptBuilder().AddInt64(5).AddInt64(5).AddInt64(10).AddOp(txscript.OP_WITHIN), true},
+		{"within upper bound", txscript.NewScriptBuilder().AddInt64(10).AddInt64(5).AddInt64(10).AddOp(txscript.OP_WITHIN), false},
+		{"min max", txscript.NewScriptBuilder().AddInt64(3).AddInt64(8).AddOp(txscript.OP_2DUP).AddOp(txscript.OP_MIN).AddOp(txscript.OP_ROT).AddOp(txscript.OP_ROT).AddOp(txscript.OP_MAX).AddOp(txscript.OP_SUB).AddInt64(-5).AddOp(txscript.OP_NUMEQUAL), true},
+		{"lessthan", txscript.NewScriptBuilder().AddInt64(3).AddInt64(8).AddOp(txscript.OP_LESSTHAN), true},
+		{"numequalverify", txscript.NewScriptBuilder().AddInt64(3).AddInt64(4).AddOp(txscript.OP_NUMEQUALVERIFY).AddInt64(1), false},
+		{"overflowing operand", txscript.NewScriptBuilder().AddData([]byte{1, 2, 3, 4, 5}).AddOp(txscript.OP_1ADD), false},
+		{"altstack", txscript.NewScriptBuilder().AddInt64(1).AddOp(txscript.OP_TOALTSTACK).AddInt64(0).AddOp(txscript.OP_DROP).AddOp(txscript.OP_FROMALTSTACK), true},
+		{"empty altstack", txscript.NewScriptBuilder().AddInt64(1).AddOp(txscript.OP_FROMALTSTACK), false},
+		{"pick", txscript.NewScriptBuilder().AddInt64(1).AddInt64(0).AddInt64(0).AddInt64(2).AddOp(txscript.OP_PICK), true},
+		{"roll", txscript.NewScriptBuilder().AddInt64(1).AddInt64(0).AddInt64(0).AddInt64(2).AddOp(txscript.OP_ROLL).AddOp(txscript.OP_DEPTH).AddInt64(3).AddOp(txscript.OP_NUMEQUALVERIFY), true},
+		{"pick out of range", txscript.NewScriptBuilder().AddInt64(1).AddInt64(1).AddOp(txscript.OP_PICK), false},
+		{"tuck", txscript.NewScriptBuilder().AddInt64(1).AddInt64(2).AddOp(txscript.OP_TUCK).AddOp(txscript.OP_DROP).AddOp(txscript.OP_DROP).AddInt64(2).AddOp(txscript.OP_NUMEQUAL), true},
+		{"swap", txscript.NewScriptBuilder().AddInt64(1).AddInt64(2).AddOp(txscript.OP_SWAP).AddInt64(1).AddOp(txscript.OP_NUMEQUAL), true},
+		{"2swap", txscript.NewScriptBuilder().AddInt64(1).AddInt64(2).AddInt64(3).AddInt64(4).AddOp(txscript.OP_2SWAP).AddOp(txscript.OP_DROP).AddInt64(1).AddOp(txscript.OP_NUMEQUAL), true},
+		{"2rot", txscript.NewScriptBuilder().AddInt64(1).AddInt64(2).AddInt64(3).AddInt64(4).AddInt64(5).AddInt64(6).AddOp(txscript.OP_2ROT).AddOp(txscript.OP_DROP).AddInt64(1).AddOp(txscript.OP_NUMEQUAL), true},
+		{"3dup", txscript.NewScriptBuilder().AddInt64(1).AddInt64(2).AddInt64(3).AddOp(txscript.OP_3DUP).AddOp(txscript.OP_DEPTH).AddInt64(6).AddOp(txscript.OP_NUMEQUAL), true},
+		{"2over", txscript.NewScriptBuilder().AddInt64(1).AddInt64(0).AddInt64(0).AddInt64(0).AddOp(txscript.OP_2OVER).AddOp(txscript.OP_DROP), true},
+		{"nip", txscript.NewScriptBuilder().AddInt64(0).AddInt64(1).AddOp(txscript.OP_NIP).AddOp(txscript.OP_DEPTH).AddOp(txscript.OP_NUMEQUAL), true},
+		{"ifdup", txscript.NewScriptBuilder().AddInt64(0).AddOp(txscript.OP_IFDUP).AddOp(txscript.OP_DEPTH).AddOp(txscript.OP_NUMEQUAL), false},
+		{"sha1", txscript.NewScriptBuilder().AddData([]byte("zcash")).AddOp(txscript.OP_SHA1).AddData(sha1Hash[:]).AddOp(txscript.OP_EQUAL), true},
+	}
+	tx := &MsgTx{MsgTx: wire.NewMsgTx(versionSapling)}
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	for _, test := range tests {
+		script, err := test.script.Script()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = VerifyTx(tx, []*wire.TxOut{wire.NewTxOut(0, script)}, SaplingBranchID)
+		if (err == nil) != test.valid {
+			t.Fatalf("%s: got %v", test.name, err)
+		}
+	}
+
+	// The alt stack counts towards the stack size limit.
+	script := bytes.Repeat([]byte{txscript.OP_1}, maxStackSize)
+	script = append(script, txscript.OP_TOALTSTACK, txscript.OP_1)
+	if err := VerifyTx(tx, []*wire.TxOut{wire.NewTxOut(0, script)}, SaplingBranchID); err == nil {
+		t.Fatal("expected error for exceeding the stack size")
+	}
+}
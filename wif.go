@@ -0,0 +1,100 @@
+package zecutil
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// ErrKeyNotFound is returned by KeyStore.GetKey for addresses it holds no key
+// for.
+var ErrKeyNotFound = errors.New("private key not found")
+
+// DecodeWIF decodes a Wallet Import Format private key, as exported by
+// zcashd dumpprivkey, and checks that it belongs to the given network.
+func DecodeWIF(wif string, net *Params) (*btcutil.WIF, error) {
+	w, err := btcutil.DecodeWIF(wif)
+	if err != nil {
+		return nil, err
+	}
+	if !w.IsForNet(&net.Params) {
+		return nil, fmt.Errorf("private key is not for %s", net.Name)
+	}
+	return w, nil
+}
+
+// EncodeWIF returns the Wallet Import Format encoding of a private key for the
+// given network. compress selects whether the key pays to the compressed
+// public key.
+func EncodeWIF(privKey *btcec.PrivateKey, compress bool, net *Params) (string, error) {
+	w, err := btcutil.NewWIF(privKey, &net.Params, compress)
+	if err != nil {
+		return "", err
+	}
+	return w.String(), nil
+}
+
+// WIFAddress returns the P2PKH address of a WIF private key, using the public
+// key format selected by its compression flag.
+func WIFAddress(w *btcutil.WIF, net *Params) *ZecAddressPubKeyHash {
+	var hash [ripemd160.Size]byte
+	copy(hash[:], btcutil.Hash160(w.SerializePubKey()))
+	return NewAddressPubKeyHash(hash, net)
+}
+
+// KeyStore is a txscript.KeyDB holding the private keys of a network, keyed
+// by the hash of their public key.
+type KeyStore struct {
+	net *Params
+
+	mtx  sync.RWMutex
+	keys map[[ripemd160.Size]byte]*btcutil.WIF
+}
+
+// NewKeyStore returns an empty KeyStore for the given network.
+func NewKeyStore(net *Params) *KeyStore {
+	return &KeyStore{net: net, keys: make(map[[ripemd160.Size]byte]*btcutil.WIF)}
+}
+
+// ImportWIF adds a WIF private key to the store and returns its address. Keys
+// of another network are rejected.
+func (s *KeyStore) ImportWIF(wif string) (*ZecAddressPubKeyHash, error) {
+	w, err := DecodeWIF(wif, s.net)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := WIFAddress(w, s.net)
+	s.mtx.Lock()
+	s.keys[addr.hash] = w
+	s.mtx.Unlock()
+
+	return addr, nil
+}
+
+// GetKey returns the private key paid by addr and whether its public key is
+// compressed. Part of the txscript.KeyDB interface.
+func (s *KeyStore) GetKey(addr btcutil.Address) (*btcec.PrivateKey, bool, error) {
+	var hash [ripemd160.Size]byte
+	switch a := addr.(type) {
+	case *btcutil.AddressPubKey:
+		copy(hash[:], btcutil.Hash160(a.ScriptAddress()))
+	case *btcutil.AddressPubKeyHash, *ZecAddressPubKeyHash, *ZecAddressTex:
+		copy(hash[:], a.ScriptAddress())
+	default:
+		return nil, false, fmt.Errorf("unsupported address type %T", addr)
+	}
+
+	s.mtx.RLock()
+	w, ok := s.keys[hash]
+	s.mtx.RUnlock()
+	if !ok {
+		return nil, false, ErrKeyNotFound
+	}
+
+	return w.PrivKey, w.CompressPubKey, nil
+}
@@ -0,0 +1,95 @@
+package zecutil
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestWIF(t *testing.T) {
+	privKey, _ := btcec.PrivKeyFromBytes(mustDecodeHex(t, "0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d"))
+
+	tests := []struct {
+		compress bool
+		net      *Params
+		wif      string
+	}{
+		{false, &MainNetParams, "5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ"},
+		{true, &MainNetParams, "KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617"},
+		{false, &TestNet3Params, "91gGn1HgSap6CbU12F6z3pJri26xzp7Ay1VW6NHCoEayNXwRpu2"},
+		{true, &TestNet3Params, "cMzLdeGd5vEqxB8B6VFQoRopQ3sLAAvEzDAoQgvX54xwofSWj1fx"},
+	}
+	for _, test := range tests {
+		wif, err := EncodeWIF(privKey, test.compress, test.net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wif != test.wif {
+			t.Fatalf("got %s, want %s", wif, test.wif)
+		}
+
+		w, err := DecodeWIF(wif, test.net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.CompressPubKey != test.compress || !w.PrivKey.Key.Equals(&privKey.Key) {
+			t.Fatalf("%s does not round-trip", wif)
+		}
+
+		other := &MainNetParams
+		if test.net == other {
+			other = &TestNet3Params
+		}
+		if _, err = DecodeWIF(wif, other); err == nil {
+			t.Fatalf("%s: expected error on %s", wif, other.Name)
+		}
+	}
+}
+
+func TestKeyStore(t *testing.T) {
+	store := NewKeyStore(netParams)
+	if _, err := store.ImportWIF("KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617"); err == nil {
+		t.Fatal("expected error importing mainnet key")
+	}
+
+	addr, err := store.ImportWIF(testWif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.EncodeAddress() != senderAddr {
+		t.Fatalf("got address %s, want %s", addr, senderAddr)
+	}
+
+	key, compressed, err := store.GetKey(addr)
+	if err != nil || !compressed {
+		t.Fatalf("got %v, %v", compressed, err)
+	}
+	pubKey, err := btcutil.NewAddressPubKey(key.PubKey().SerializeCompressed(), &netParams.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = store.GetKey(pubKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = store.GetKey(NewAddressPubKeyHash([20]byte{1}, netParams)); err != ErrKeyNotFound {
+		t.Fatalf("got %v, want ErrKeyNotFound", err)
+	}
+
+	// The store signs the known Overwinter transaction.
+	const signed = "030000807082c403011c15616e8b9a75ad4079a17bb296bcba8bda2712453baf1bde447bfe46be46e4010000006b48304502210093f8edae9784fee695d5ac5f84b4217084345a53c31c9e1e8e2a183ebe15cace02206872d90d0af77a4a4c18b761cf511e4583597ee5503e0e82e491da0f1a4377ed012103362327ee808f5961d26ef1a431386d6190638d67c14aa0e78e2eba1b58870cc0ffffffff02400d0300000000001976a9143b535da0ba90dad71ea005cccfe3cca47d746b3a88ac70d2dd11000000001976a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac00000000ff47030000"
+	tx, err := ZecTxFromHex(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.TxIn[0].SignatureScript = nil
+	tx.TxIn[0].SignatureScript, err = SignTxOutputWithBranchID(netParams, OverwinterBranchID, tx, 0,
+		mustDecodeHex(t, "76a914aefaebf9c83deba2ec76e080e2cec850dec161b188ac"), txscript.SigHashAll, store, nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := tx.ZecToHex(); raw != signed {
+		t.Fatal("incorrect sig")
+	}
+}
@@ -10,59 +10,36 @@ import (
 	"golang.org/x/crypto/ripemd160"
 )
 
-type ChainParams struct {
-	PubHashPrefixes    []byte
-	ScriptHashPrefixes []byte
-}
-
-var (
-	MainNet = ChainParams{
-		PubHashPrefixes:    []byte{0x1C, 0xB8},
-		ScriptHashPrefixes: []byte{0x1C, 0xBD},
-	}
-
-	TestNet3 = ChainParams{
-		PubHashPrefixes:    []byte{0x1D, 0x25},
-		ScriptHashPrefixes: []byte{0x1C, 0xBA},
-	}
-
-	NetList = map[string]ChainParams{
-		"mainnet":  MainNet,
-		"testnet3": TestNet3,
-		"regtest":  TestNet3,
-	}
-)
-
 type ZecAddressScriptHash struct {
-	hash   [ripemd160.Size]byte
-	prefix string
+	hash [ripemd160.Size]byte
+	net  *Params
 }
 
 type ZecAddressPubKeyHash struct {
-	hash   [ripemd160.Size]byte
-	prefix string
+	hash [ripemd160.Size]byte
+	net  *Params
 }
 
-func NewAddressPubKeyHash(hash [ripemd160.Size]byte, prefix string) *ZecAddressPubKeyHash {
-	return &ZecAddressPubKeyHash{hash, prefix}
+func NewAddressPubKeyHash(hash [ripemd160.Size]byte, net *Params) *ZecAddressPubKeyHash {
+	return &ZecAddressPubKeyHash{hash, net}
 }
 
-func NewAddressScriptHash(hash [ripemd160.Size]byte, prefix string) *ZecAddressScriptHash {
-	return &ZecAddressScriptHash{hash, prefix}
+func NewAddressScriptHash(hash [ripemd160.Size]byte, net *Params) *ZecAddressScriptHash {
+	return &ZecAddressScriptHash{hash, net}
 }
 
 // Encode pubHash to zec address
-func Encode(pkHash []byte, net *chaincfg.Params) (_ string, err error) {
-	if _, ok := NetList[net.Name]; !ok {
+func Encode(pkHash []byte, net *Params) (_ string, err error) {
+	if !net.validTransparent() {
 		return "", errors.New("unknown network parameters")
 	}
 
 	var addrPubKey *btcutil.AddressPubKey
-	if addrPubKey, err = btcutil.NewAddressPubKey(pkHash, net); err != nil {
+	if addrPubKey, err = btcutil.NewAddressPubKey(pkHash, &net.Params); err != nil {
 		return "", err
 	}
 
-	return EncodeHash(btcutil.Hash160(addrPubKey.ScriptAddress())[:ripemd160.Size], NetList[net.Name].PubHashPrefixes)
+	return EncodeHash(btcutil.Hash160(addrPubKey.ScriptAddress())[:ripemd160.Size], net.PubHashPrefixes)
 }
 
 func EncodeHash(addrHash []byte, prefix []byte) (_ string, err error) {
@@ -82,16 +59,15 @@ func EncodeHash(addrHash []byte, prefix []byte) (_ string, err error) {
 }
 
 // DecodeAddress zec address string
-func DecodeAddress(address string, netName string) (btcutil.Address, error) {
-	var (
-		net ChainParams
-		ok  bool
-	)
-
-	if net, ok = NetList[netName]; !ok {
+func DecodeAddress(address string, net *Params) (btcutil.Address, error) {
+	if !net.validTransparent() {
 		return nil, errors.New("unknown net")
 	}
 
+	if isTexAddress(address, net) {
+		return DecodeTexAddress(address, net)
+	}
+
 	var decoded = base58.Decode(address)
 	if len(decoded) != 26 {
 		return nil, base58.ErrInvalidFormat
@@ -110,11 +86,11 @@ func DecodeAddress(address string, netName string) (btcutil.Address, error) {
 
 	switch {
 	case net.PubHashPrefixes[0] == decoded[0] && net.PubHashPrefixes[1] == decoded[1]:
-		addr := &ZecAddressPubKeyHash{prefix: netName}
+		addr := &ZecAddressPubKeyHash{net: net}
 		copy(addr.hash[:], decoded[2:len(decoded)-4])
 		return addr, nil
 	case net.ScriptHashPrefixes[0] == decoded[0] && net.ScriptHashPrefixes[1] == decoded[1]:
-		addr := &ZecAddressScriptHash{prefix: netName}
+		addr := &ZecAddressScriptHash{net: net}
 		copy(addr.hash[:], decoded[2:len(decoded)-4])
 		return addr, nil
 	}
@@ -125,7 +101,7 @@ func DecodeAddress(address string, netName string) (btcutil.Address, error) {
 // EncodeAddress returns the string encoding of a pay-to-pubkey-hash
 // address.  Part of the Address interface.
 func (a *ZecAddressPubKeyHash) EncodeAddress() (addr string) {
-	addr, _ = EncodeHash(a.hash[:], NetList[a.prefix].PubHashPrefixes)
+	addr, _ = EncodeHash(a.hash[:], a.net.PubHashPrefixes)
 	return addr
 }
 
@@ -138,11 +114,7 @@ func (a *ZecAddressPubKeyHash) ScriptAddress() []byte {
 // IsForNet returns whether or not the pay-to-pubkey-hash address is associated
 // with the passed bitcoin cash network.
 func (a *ZecAddressPubKeyHash) IsForNet(net *chaincfg.Params) bool {
-	_, ok := NetList[net.Name]
-	if !ok {
-		return false
-	}
-	return a.prefix == net.Name
+	return a.net.Name == net.Name
 }
 
 // String returns a human-readable string for the pay-to-pubkey-hash address.
@@ -155,7 +127,7 @@ func (a *ZecAddressPubKeyHash) String() string {
 // EncodeAddress returns the string encoding of a pay-to-pubkey-hash
 // address.  Part of the Address interface.
 func (a *ZecAddressScriptHash) EncodeAddress() (addr string) {
-	addr, _ = EncodeHash(a.hash[:], NetList[a.prefix].ScriptHashPrefixes)
+	addr, _ = EncodeHash(a.hash[:], a.net.ScriptHashPrefixes)
 	return addr
 }
 
@@ -168,11 +140,7 @@ func (a *ZecAddressScriptHash) ScriptAddress() []byte {
 // IsForNet returns whether or not the pay-to-pubkey-hash address is associated
 // with the passed bitcoin cash network.
 func (a *ZecAddressScriptHash) IsForNet(net *chaincfg.Params) bool {
-	_, ok := NetList[net.Name]
-	if !ok {
-		return false
-	}
-	return a.prefix == net.Name
+	return a.net.Name == net.Name
 }
 
 // String returns a human-readable string for the pay-to-pubkey-hash address.
@@ -18,9 +18,7 @@ func TestEncode(t *testing.T) {
 	}
 
 	var encodedAddr string
-	encodedAddr, err = Encode(wif.PrivKey.PubKey().SerializeCompressed(), &chaincfg.Params{
-		Name: "testnet3",
-	})
+	encodedAddr, err = Encode(wif.PrivKey.PubKey().SerializeCompressed(), &TestNet3Params)
 
 	if err != nil {
 		t.Fatal(err)
@@ -31,8 +29,8 @@ func TestEncode(t *testing.T) {
 		t.Fatal("incorrect encode", "expected", expectedAddr, "got", encodedAddr)
 	}
 
-	_, err = Encode(wif.PrivKey.PubKey().SerializeCompressed(), &chaincfg.Params{
-		Name: "dummy",
+	_, err = Encode(wif.PrivKey.PubKey().SerializeCompressed(), &Params{
+		Params: chaincfg.Params{Name: "dummy"},
 	})
 
 	if err == nil {
@@ -47,12 +45,12 @@ func TestDecode(t *testing.T) {
 	}
 
 	for _, addr := range addrs {
-		a, err := DecodeAddress(addr, "testnet3")
+		a, err := DecodeAddress(addr, &TestNet3Params)
 		if err != nil {
 			t.Fatal("got err", "expected nil", "got", err)
 		}
 
-		if !a.IsForNet(&chaincfg.Params{Name: "testnet3"}) {
+		if !a.IsForNet(&TestNet3Params.Params) {
 			t.Fatal("incorrect net")
 		}
 
@@ -61,3 +59,63 @@ func TestDecode(t *testing.T) {
 		}
 	}
 }
+
+func TestRegisterNet(t *testing.T) {
+	custom := NewRegTestParams("regtest-nu5", []NetworkUpgrade{
+		{"Sprout", 0, SproutBranchID},
+		{"Overwinter", 1, OverwinterBranchID},
+		{"Sapling", 1, SaplingBranchID},
+		{"NU5", 200, NU5BranchID},
+	})
+	if err := Register(custom); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(custom); err != ErrDuplicateNet {
+		t.Fatal("expected duplicate network error, got", err)
+	}
+
+	invalid := []*Params{
+		nil,
+		NewRegTestParams("", RegTestUpgrades),
+		NewRegTestParams("regtest-empty", nil),
+		NewRegTestParams("regtest-no-sprout", RegTestUpgrades[1:]),
+		NewRegTestParams("regtest-unknown", []NetworkUpgrade{{"Sprout", 0, SproutBranchID}, {"Dummy", 1, 0x12345678}}),
+		NewRegTestParams("regtest-unsorted", []NetworkUpgrade{
+			{"Sprout", 0, SproutBranchID}, {"Sapling", 1, SaplingBranchID}, {"Overwinter", 1, OverwinterBranchID},
+		}),
+		NewRegTestParams("regtest-heights", []NetworkUpgrade{
+			{"Sprout", 0, SproutBranchID}, {"Overwinter", 10, OverwinterBranchID}, {"Sapling", 5, SaplingBranchID},
+		}),
+	}
+	for i, params := range invalid {
+		if err := Register(params); err == nil {
+			t.Fatalf("%d: expected error registering invalid parameters", i)
+		}
+	}
+
+	params, err := ParamsForNet("regtest-nu5")
+	if err != nil || params != custom {
+		t.Fatal("registered network not found", err)
+	}
+	if _, err = ParamsForNet("dummy"); err != ErrUnknownNet {
+		t.Fatal("expected unknown network error, got", err)
+	}
+
+	if got := params.ConsensusBranchID(199); got != SaplingBranchID {
+		t.Fatalf("got branch 0x%08x, want sapling", got)
+	}
+	if RegTestParams.ConsensusBranchID(199) != NU6BranchID {
+		t.Fatal("custom schedule leaked into the default regtest params")
+	}
+
+	a, err := DecodeAddress(senderAddr, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsForNet(&params.Params) || a.IsForNet(&TestNet3Params.Params) {
+		t.Fatal("incorrect net")
+	}
+	if a.EncodeAddress() != senderAddr {
+		t.Fatal("incorrect decode")
+	}
+}
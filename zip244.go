@@ -0,0 +1,443 @@
+package zecutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// ZIP-244 personalization strings.
+// https://zips.z.cash/zip-0244
+const (
+	txHashPersonalization   = "ZcashTxHash_"
+	authHashPersonalization = "ZTxAuthHash_"
+
+	headersHashPersonalization     = "ZTxIdHeadersHash"
+	transparentHashPersonalization = "ZTxIdTranspaHash"
+	v5PrevoutsHashPersonalization  = "ZTxIdPrevoutHash"
+	v5SequenceHashPersonalization  = "ZTxIdSequencHash"
+	v5OutputsHashPersonalization   = "ZTxIdOutputsHash"
+	amountsHashPersonalization     = "ZTxTrAmountsHash"
+	scriptsHashPersonalization     = "ZTxTrScriptsHash"
+	txInHashPersonalization        = "Zcash___TxInHash"
+
+	saplingHashPersonalization              = "ZTxIdSaplingHash"
+	saplingSpendsHashPersonalization        = "ZTxIdSSpendsHash"
+	saplingSpendsCompactPersonalization     = "ZTxIdSSpendCHash"
+	saplingSpendsNoncompactPersonalization  = "ZTxIdSSpendNHash"
+	saplingOutputsHashPersonalization       = "ZTxIdSOutputHash"
+	saplingOutputsCompactPersonalization    = "ZTxIdSOutC__Hash"
+	saplingOutputsMemosPersonalization      = "ZTxIdSOutM__Hash"
+	saplingOutputsNoncompactPersonalization = "ZTxIdSOutN__Hash"
+	orchardHashPersonalization              = "ZTxIdOrchardHash"
+	orchardActionsCompactPersonalization    = "ZTxIdOrcActCHash"
+	orchardActionsMemosPersonalization      = "ZTxIdOrcActMHash"
+	orchardActionsNoncompactPersonalization = "ZTxIdOrcActNHash"
+	transparentAuthHashPersonalization      = "ZTxAuthTransHash"
+	saplingAuthHashPersonalization          = "ZTxAuthSapliHash"
+	orchardAuthHashPersonalization          = "ZTxAuthOrchaHash"
+)
+
+const (
+	// compactNoteSize is the prefix of a note ciphertext that is needed for
+	// trial decryption by light clients.
+	compactNoteSize = 52
+
+	// memoEndOffset is the offset within a note ciphertext at which the
+	// encrypted memo ends.
+	memoEndOffset = compactNoteSize + 512
+)
+
+// branchPersonalization returns prefix followed by the little endian
+// consensus branch ID, as used by the root ZIP-244 digests.
+func branchPersonalization(prefix string, branchID uint32) []byte {
+	key := make([]byte, len(prefix)+4)
+	copy(key, prefix)
+	binary.LittleEndian.PutUint32(key[len(prefix):], branchID)
+	return key
+}
+
+// hashConcat hashes the concatenation of the passed digests.
+func hashConcat(personalization string, digests ...chainhash.Hash) (chainhash.Hash, error) {
+	var b bytes.Buffer
+	for i := range digests {
+		b.Write(digests[i][:])
+	}
+	return blake2bHash(b.Bytes(), []byte(personalization))
+}
+
+// calcHeaderDigest implements T.1 of ZIP-244.
+func calcHeaderDigest(tx *MsgTx) (chainhash.Hash, error) {
+	var b [20]byte
+	binary.LittleEndian.PutUint32(b[0:], uint32(tx.Version)|(1<<31))
+	binary.LittleEndian.PutUint32(b[4:], versionNU5GroupID)
+	binary.LittleEndian.PutUint32(b[8:], tx.ConsensusBranchID)
+	binary.LittleEndian.PutUint32(b[12:], tx.LockTime)
+	binary.LittleEndian.PutUint32(b[16:], tx.ExpiryHeight)
+	return blake2bHash(b[:], []byte(headersHashPersonalization))
+}
+
+// calcV5HashPrevOuts implements T.2a of ZIP-244.
+func calcV5HashPrevOuts(tx *MsgTx) (chainhash.Hash, error) {
+	var b bytes.Buffer
+	for _, in := range tx.TxIn {
+		b.Write(in.PreviousOutPoint.Hash[:])
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], in.PreviousOutPoint.Index)
+		b.Write(buf[:])
+	}
+	return blake2bHash(b.Bytes(), []byte(v5PrevoutsHashPersonalization))
+}
+
+// calcV5HashSequence implements T.2b of ZIP-244.
+func calcV5HashSequence(tx *MsgTx) (chainhash.Hash, error) {
+	var b bytes.Buffer
+	for _, in := range tx.TxIn {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], in.Sequence)
+		b.Write(buf[:])
+	}
+	return blake2bHash(b.Bytes(), []byte(v5SequenceHashPersonalization))
+}
+
+// calcV5HashOutputs implements T.2c of ZIP-244.
+func calcV5HashOutputs(tx *MsgTx) (chainhash.Hash, error) {
+	var b bytes.Buffer
+	for _, out := range tx.TxOut {
+		if err := WriteTxOut(&b, 0, tx.Version, out); err != nil {
+			return chainhash.Hash{}, err
+		}
+	}
+	return blake2bHash(b.Bytes(), []byte(v5OutputsHashPersonalization))
+}
+
+// calcSaplingDigest implements T.3 of ZIP-244.
+func calcSaplingDigest(tx *MsgTx) (h chainhash.Hash, err error) {
+	if !tx.hasSapling() {
+		return blake2bHash(nil, []byte(saplingHashPersonalization))
+	}
+
+	var spends, outputs chainhash.Hash
+	if len(tx.ShieldedSpends) == 0 {
+		spends, err = blake2bHash(nil, []byte(saplingSpendsHashPersonalization))
+	} else {
+		var compact, noncompact bytes.Buffer
+		for _, sd := range tx.ShieldedSpends {
+			compact.Write(sd.Nullifier[:])
+			_ = writeBytes(&noncompact, sd.Cv[:], sd.Anchor[:], sd.Rk[:])
+		}
+		spends, err = hashParts(saplingSpendsHashPersonalization,
+			hashPart{saplingSpendsCompactPersonalization, compact.Bytes()},
+			hashPart{saplingSpendsNoncompactPersonalization, noncompact.Bytes()})
+	}
+	if err != nil {
+		return h, err
+	}
+
+	if len(tx.ShieldedOutputs) == 0 {
+		outputs, err = blake2bHash(nil, []byte(saplingOutputsHashPersonalization))
+	} else {
+		var compact, memos, noncompact bytes.Buffer
+		for _, od := range tx.ShieldedOutputs {
+			_ = writeBytes(&compact, od.Cmu[:], od.EphemeralKey[:], od.EncCiphertext[:compactNoteSize])
+			memos.Write(od.EncCiphertext[compactNoteSize:memoEndOffset])
+			_ = writeBytes(&noncompact, od.Cv[:], od.EncCiphertext[memoEndOffset:], od.OutCiphertext[:])
+		}
+		outputs, err = hashParts(saplingOutputsHashPersonalization,
+			hashPart{saplingOutputsCompactPersonalization, compact.Bytes()},
+			hashPart{saplingOutputsMemosPersonalization, memos.Bytes()},
+			hashPart{saplingOutputsNoncompactPersonalization, noncompact.Bytes()})
+	}
+	if err != nil {
+		return h, err
+	}
+
+	var b bytes.Buffer
+	b.Write(spends[:])
+	b.Write(outputs[:])
+	var vb [8]byte
+	binary.LittleEndian.PutUint64(vb[:], uint64(tx.ValueBalance))
+	b.Write(vb[:])
+
+	return blake2bHash(b.Bytes(), []byte(saplingHashPersonalization))
+}
+
+// calcOrchardDigest implements T.4 of ZIP-244.
+func calcOrchardDigest(tx *MsgTx) (h chainhash.Hash, err error) {
+	if !tx.hasOrchard() {
+		return blake2bHash(nil, []byte(orchardHashPersonalization))
+	}
+
+	var compact, memos, noncompact bytes.Buffer
+	for _, a := range tx.Orchard.Actions {
+		_ = writeBytes(&compact, a.Nullifier[:], a.Cmx[:], a.EphemeralKey[:], a.EncCiphertext[:compactNoteSize])
+		memos.Write(a.EncCiphertext[compactNoteSize:memoEndOffset])
+		_ = writeBytes(&noncompact, a.Cv[:], a.Rk[:], a.EncCiphertext[memoEndOffset:], a.OutCiphertext[:])
+	}
+
+	parts := []hashPart{
+		{orchardActionsCompactPersonalization, compact.Bytes()},
+		{orchardActionsMemosPersonalization, memos.Bytes()},
+		{orchardActionsNoncompactPersonalization, noncompact.Bytes()},
+	}
+
+	var b bytes.Buffer
+	for _, p := range parts {
+		var d chainhash.Hash
+		if d, err = blake2bHash(p.data, []byte(p.personalization)); err != nil {
+			return h, err
+		}
+		b.Write(d[:])
+	}
+	b.WriteByte(tx.Orchard.Flags)
+	var vb [8]byte
+	binary.LittleEndian.PutUint64(vb[:], uint64(tx.Orchard.ValueBalance))
+	b.Write(vb[:])
+	b.Write(tx.Orchard.Anchor[:])
+
+	return blake2bHash(b.Bytes(), []byte(orchardHashPersonalization))
+}
+
+// hashPart is a piece of data hashed under its own personalization before
+// being folded into a parent digest.
+type hashPart struct {
+	personalization string
+	data            []byte
+}
+
+// hashParts hashes each part and then hashes the concatenation of the
+// results under the outer personalization.
+func hashParts(outer string, parts ...hashPart) (h chainhash.Hash, err error) {
+	digests := make([]chainhash.Hash, len(parts))
+	for i, p := range parts {
+		if digests[i], err = blake2bHash(p.data, []byte(p.personalization)); err != nil {
+			return h, err
+		}
+	}
+	return hashConcat(outer, digests...)
+}
+
+// transparentDigest implements T.2 of ZIP-244 from the cached digests.
+func transparentDigest(tx *MsgTx, sigHashes *TxSigHashes) (chainhash.Hash, error) {
+	if len(tx.TxIn) == 0 && len(tx.TxOut) == 0 {
+		return blake2bHash(nil, []byte(transparentHashPersonalization))
+	}
+	return hashConcat(transparentHashPersonalization,
+		sigHashes.HashPrevOuts, sigHashes.HashSequence, sigHashes.HashOutputs)
+}
+
+// v5TxDigests computes the ZIP-244 digests that do not depend on the spent
+// outputs.
+func v5TxDigests(tx *MsgTx) (h *TxSigHashes, err error) {
+	h = &TxSigHashes{}
+
+	if h.HashHeader, err = calcHeaderDigest(tx); err != nil {
+		return nil, err
+	}
+	if h.HashPrevOuts, err = calcV5HashPrevOuts(tx); err != nil {
+		return nil, err
+	}
+	if h.HashSequence, err = calcV5HashSequence(tx); err != nil {
+		return nil, err
+	}
+	if h.HashOutputs, err = calcV5HashOutputs(tx); err != nil {
+		return nil, err
+	}
+	if h.HashSapling, err = calcSaplingDigest(tx); err != nil {
+		return nil, err
+	}
+	if h.HashOrchard, err = calcOrchardDigest(tx); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// v5TxID computes the ZIP-244 transaction identifier.
+func v5TxID(tx *MsgTx) (h chainhash.Hash, err error) {
+	var digests *TxSigHashes
+	if digests, err = v5TxDigests(tx); err != nil {
+		return h, err
+	}
+
+	var transparent chainhash.Hash
+	if transparent, err = transparentDigest(tx, digests); err != nil {
+		return h, err
+	}
+
+	var b bytes.Buffer
+	b.Write(digests.HashHeader[:])
+	b.Write(transparent[:])
+	b.Write(digests.HashSapling[:])
+	b.Write(digests.HashOrchard[:])
+
+	return blake2bHash(b.Bytes(), branchPersonalization(txHashPersonalization, tx.ConsensusBranchID))
+}
+
+// AuthDigest returns the ZIP-244 authorizing data commitment of the
+// transaction. Transactions prior to v5 have no such commitment and use 32
+// 0xff bytes, as in the block authDataRoot.
+func (msg *MsgTx) AuthDigest() (h chainhash.Hash) {
+	if msg.Version < versionNU5 {
+		for i := range h {
+			h[i] = 0xff
+		}
+		return h
+	}
+
+	var b bytes.Buffer
+	for _, in := range msg.TxIn {
+		_ = WriteVarBytes(&b, 0, in.SignatureScript)
+	}
+	transparent, _ := blake2bHash(b.Bytes(), []byte(transparentAuthHashPersonalization))
+
+	b.Reset()
+	if msg.hasSapling() {
+		for _, sd := range msg.ShieldedSpends {
+			b.Write(sd.ZkProof[:])
+		}
+		for _, sd := range msg.ShieldedSpends {
+			b.Write(sd.SpendAuthSig[:])
+		}
+		for _, od := range msg.ShieldedOutputs {
+			b.Write(od.ZkProof[:])
+		}
+		b.Write(msg.BindingSig[:])
+	}
+	sapling, _ := blake2bHash(b.Bytes(), []byte(saplingAuthHashPersonalization))
+
+	b.Reset()
+	if msg.hasOrchard() {
+		b.Write(msg.Orchard.Proof)
+		for _, a := range msg.Orchard.Actions {
+			b.Write(a.SpendAuthSig[:])
+		}
+		b.Write(msg.Orchard.BindingSig[:])
+	}
+	orchard, _ := blake2bHash(b.Bytes(), []byte(orchardAuthHashPersonalization))
+
+	b.Reset()
+	b.Write(transparent[:])
+	b.Write(sapling[:])
+	b.Write(orchard[:])
+	h, _ = blake2bHash(b.Bytes(), branchPersonalization(authHashPersonalization, msg.ConsensusBranchID))
+
+	return h
+}
+
+// isValidV5SigHashType reports whether hashType is one of the sighash types
+// accepted for transparent inputs of v5 transactions.
+func isValidV5SigHashType(hashType txscript.SigHashType) bool {
+	switch hashType &^ txscript.SigHashAnyOneCanPay {
+	case txscript.SigHashAll, txscript.SigHashNone, txscript.SigHashSingle:
+		return hashType&^(txscript.SigHashAnyOneCanPay|sigHashMask) == 0
+	}
+	return false
+}
+
+// zip244SignatureHash computes the ZIP-244 signature digest for the
+// transparent input idx of a v5 transaction.
+func zip244SignatureHash(
+	subScript []byte,
+	sigHashes *TxSigHashes,
+	hashType txscript.SigHashType,
+	tx *MsgTx,
+	idx int,
+	amt int64,
+) (_ []byte, err error) {
+	if !isValidV5SigHashType(hashType) {
+		return nil, fmt.Errorf("invalid sighash type 0x%x for v5 transaction", uint32(hashType))
+	}
+	if !sigHashes.hasPrevOuts {
+		return nil, fmt.Errorf("v5 signature hash requires the previous outputs of all inputs")
+	}
+
+	var (
+		prevOuts = sigHashes.HashPrevOuts
+		amounts  = sigHashes.HashAmounts
+		scripts  = sigHashes.HashScriptPubKeys
+		sequence = sigHashes.HashSequence
+		outputs  chainhash.Hash
+		baseType = hashType & sigHashMask
+	)
+
+	// << S.2b-S.2e
+	// With anyone can pay only the input being signed is committed to, so
+	// the digests over all inputs are replaced by digests of empty data.
+	if hashType&txscript.SigHashAnyOneCanPay != 0 {
+		for _, d := range []struct {
+			dst             *chainhash.Hash
+			personalization string
+		}{
+			{&prevOuts, v5PrevoutsHashPersonalization},
+			{&amounts, amountsHashPersonalization},
+			{&scripts, scriptsHashPersonalization},
+			{&sequence, v5SequenceHashPersonalization},
+		} {
+			if *d.dst, err = blake2bHash(nil, []byte(d.personalization)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// << S.2f
+	switch {
+	case baseType != txscript.SigHashSingle && baseType != txscript.SigHashNone:
+		outputs = sigHashes.HashOutputs
+	case baseType == txscript.SigHashSingle && idx < len(tx.TxOut):
+		var b bytes.Buffer
+		if err = WriteTxOut(&b, 0, tx.Version, tx.TxOut[idx]); err != nil {
+			return nil, err
+		}
+		if outputs, err = blake2bHash(b.Bytes(), []byte(v5OutputsHashPersonalization)); err != nil {
+			return nil, err
+		}
+	default:
+		if outputs, err = blake2bHash(nil, []byte(v5OutputsHashPersonalization)); err != nil {
+			return nil, err
+		}
+	}
+
+	// << S.2g
+	var txIn bytes.Buffer
+	txIn.Write(tx.TxIn[idx].PreviousOutPoint.Hash[:])
+	var buf [8]byte
+	binary.LittleEndian.PutUint32(buf[:4], tx.TxIn[idx].PreviousOutPoint.Index)
+	txIn.Write(buf[:4])
+	binary.LittleEndian.PutUint64(buf[:], uint64(amt))
+	txIn.Write(buf[:])
+	if err = WriteVarBytes(&txIn, 0, subScript); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint32(buf[:4], tx.TxIn[idx].Sequence)
+	txIn.Write(buf[:4])
+
+	var txInDigest chainhash.Hash
+	if txInDigest, err = blake2bHash(txIn.Bytes(), []byte(txInHashPersonalization)); err != nil {
+		return nil, err
+	}
+
+	var transparent bytes.Buffer
+	transparent.WriteByte(byte(hashType))
+	for _, d := range []chainhash.Hash{prevOuts, amounts, scripts, sequence, outputs, txInDigest} {
+		transparent.Write(d[:])
+	}
+
+	var transparentDigest chainhash.Hash
+	if transparentDigest, err = blake2bHash(transparent.Bytes(), []byte(transparentHashPersonalization)); err != nil {
+		return nil, err
+	}
+
+	var h chainhash.Hash
+	if h, err = hashConcat(
+		string(branchPersonalization(txHashPersonalization, tx.ConsensusBranchID)),
+		sigHashes.HashHeader, transparentDigest, sigHashes.HashSapling, sigHashes.HashOrchard,
+	); err != nil {
+		return nil, err
+	}
+
+	return h.CloneBytes(), nil
+}
@@ -0,0 +1,410 @@
+package zecutil
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ZIP-321 payment request URIs.
+// https://zips.z.cash/zip-0321
+const (
+	paymentURIScheme = "zcash:"
+
+	// maxMemoSize is the size of a Zcash memo field.
+	maxMemoSize = 512
+
+	// maxParamIndex is the largest payment index, made of at most four
+	// digits.
+	maxParamIndex = 9999
+)
+
+// Payment is a single payment of a ZIP-321 payment request.
+type Payment struct {
+	// Address is a transparent, TEX, Sapling or Unified Address.
+	Address string
+
+	// Amount is the requested amount in zatoshi, zero when the request does
+	// not specify it.
+	Amount int64
+
+	// Memo is the raw memo, only allowed for shielded addresses.
+	Memo []byte
+
+	Label   string
+	Message string
+
+	// OtherParams holds the parameters the payment request specification does
+	// not define, keyed without their payment index. Names follow the ZIP-321
+	// paramname grammar, and those starting with "req-" are never accepted.
+	OtherParams map[string]string
+}
+
+// PaymentRequest is a ZIP-321 payment request.
+type PaymentRequest struct {
+	Payments []*Payment
+}
+
+// ParsePaymentRequest parses a zcash: payment request URI and validates the
+// addresses it pays for the given network.
+func ParsePaymentRequest(uri string, net *Params) (*PaymentRequest, error) {
+	if len(uri) < len(paymentURIScheme) || !strings.EqualFold(uri[:len(paymentURIScheme)], paymentURIScheme) {
+		return nil, errors.New("zip321: missing zcash: scheme")
+	}
+	rest := uri[len(paymentURIScheme):]
+
+	path, query := rest, ""
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		path, query = rest[:i], rest[i+1:]
+	}
+
+	payments := make(map[int]*Payment)
+	payment := func(idx int) *Payment {
+		p, ok := payments[idx]
+		if !ok {
+			p = &Payment{}
+			payments[idx] = p
+		}
+		return p
+	}
+	seen := make(map[string]bool)
+
+	if path != "" {
+		payment(0).Address = path
+		seen["address"] = true
+	}
+
+	if query != "" {
+		for _, param := range strings.Split(query, "&") {
+			key, value, ok := strings.Cut(param, "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("zip321: invalid parameter %q", param)
+			}
+			if seen[key] {
+				return nil, fmt.Errorf("zip321: duplicate parameter %q", key)
+			}
+			seen[key] = true
+
+			name, idx, err := splitParamIndex(key)
+			if err != nil {
+				return nil, err
+			}
+			if err = payment(idx).setParam(name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(payments) == 0 {
+		return nil, errors.New("zip321: no payments")
+	}
+
+	indices := make([]int, 0, len(payments))
+	for idx := range payments {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+
+	req := &PaymentRequest{Payments: make([]*Payment, 0, len(payments))}
+	for _, idx := range indices {
+		p := payments[idx]
+		if p.Address == "" {
+			return nil, fmt.Errorf("zip321: payment %d has no address", idx)
+		}
+		if err := p.validate(net); err != nil {
+			return nil, fmt.Errorf("zip321: payment %d: %w", idx, err)
+		}
+		req.Payments = append(req.Payments, p)
+	}
+
+	return req, nil
+}
+
+// URI returns the zcash: URI of the payment request. The first payment is
+// given by the URI path, the following ones by indexed parameters.
+func (r *PaymentRequest) URI() (string, error) {
+	if len(r.Payments) == 0 {
+		return "", errors.New("zip321: no payments")
+	}
+	if len(r.Payments) > maxParamIndex+1 {
+		return "", errors.New("zip321: too many payments")
+	}
+
+	var params []string
+	for i, p := range r.Payments {
+		if p.Address == "" {
+			return "", fmt.Errorf("zip321: payment %d has no address", i)
+		}
+		if p.Amount < 0 || p.Amount > MaxMoney {
+			return "", fmt.Errorf("zip321: payment %d: amount out of range", i)
+		}
+		if len(p.Memo) > maxMemoSize {
+			return "", fmt.Errorf("zip321: payment %d: memo too long", i)
+		}
+
+		suffix := ""
+		if i > 0 {
+			suffix = "." + strconv.Itoa(i)
+			params = append(params, "address"+suffix+"="+p.Address)
+		}
+		if p.Amount > 0 {
+			params = append(params, "amount"+suffix+"="+formatZecAmount(p.Amount))
+		}
+		if len(p.Memo) > 0 {
+			params = append(params, "memo"+suffix+"="+base64.RawURLEncoding.EncodeToString(p.Memo))
+		}
+		if p.Label != "" {
+			params = append(params, "label"+suffix+"="+escapeQChars(p.Label))
+		}
+		if p.Message != "" {
+			params = append(params, "message"+suffix+"="+escapeQChars(p.Message))
+		}
+
+		keys := make([]string, 0, len(p.OtherParams))
+		for k := range p.OtherParams {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := checkOtherParamName(k); err != nil {
+				return "", fmt.Errorf("zip321: payment %d: %w", i, err)
+			}
+			params = append(params, k+suffix+"="+escapeQChars(p.OtherParams[k]))
+		}
+	}
+
+	uri := paymentURIScheme + r.Payments[0].Address
+	if len(params) > 0 {
+		uri += "?" + strings.Join(params, "&")
+	}
+	return uri, nil
+}
+
+// TxOuts returns the transparent outputs paying the request. Payments to
+// TEX addresses and Unified Addresses with a transparent receiver are paid
+// with a transparent output, payments to shielded addresses are rejected.
+func (r *PaymentRequest) TxOuts(net *Params) ([]*wire.TxOut, error) {
+	outs := make([]*wire.TxOut, 0, len(r.Payments))
+	for i, p := range r.Payments {
+		if p.Amount <= 0 {
+			return nil, fmt.Errorf("zip321: payment %d has no amount", i)
+		}
+		if len(p.Memo) > 0 {
+			return nil, fmt.Errorf("zip321: payment %d has a memo", i)
+		}
+
+		addr, err := p.transparentAddress(net)
+		if err != nil {
+			return nil, fmt.Errorf("zip321: payment %d: %w", i, err)
+		}
+		pkScript, err := PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, wire.NewTxOut(p.Amount, pkScript))
+	}
+
+	return outs, nil
+}
+
+// setParam sets a parameter of the payment from its percent-encoded value.
+func (p *Payment) setParam(name, value string) error {
+	switch name {
+	case "address":
+		p.Address = value
+
+	case "amount":
+		amount, err := parseZecAmount(value)
+		if err != nil {
+			return err
+		}
+		p.Amount = amount
+
+	case "memo":
+		memo, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("zip321: invalid memo: %w", err)
+		}
+		if len(memo) > maxMemoSize {
+			return errors.New("zip321: memo too long")
+		}
+		p.Memo = memo
+
+	case "label", "message":
+		s, err := url.PathUnescape(value)
+		if err != nil {
+			return err
+		}
+		if name == "label" {
+			p.Label = s
+		} else {
+			p.Message = s
+		}
+
+	default:
+		if err := checkOtherParamName(name); err != nil {
+			return fmt.Errorf("zip321: %w", err)
+		}
+		s, err := url.PathUnescape(value)
+		if err != nil {
+			return err
+		}
+		if p.OtherParams == nil {
+			p.OtherParams = make(map[string]string)
+		}
+		p.OtherParams[name] = s
+	}
+
+	return nil
+}
+
+// validate checks that the address of the payment is valid for the network
+// and that memos are only sent to shielded addresses.
+func (p *Payment) validate(net *Params) error {
+	shielded, err := validatePaymentAddress(p.Address, net)
+	if err != nil {
+		return err
+	}
+	if len(p.Memo) > 0 && !shielded {
+		return errors.New("memo sent to a transparent address")
+	}
+	return nil
+}
+
+// transparentAddress returns the address paying the payment with a
+// transparent output.
+func (p *Payment) transparentAddress(net *Params) (btcutil.Address, error) {
+	if strings.HasPrefix(strings.ToLower(p.Address), net.UnifiedAddressHRP+"1") {
+		ua, err := DecodeUnifiedAddress(p.Address, net)
+		if err != nil {
+			return nil, err
+		}
+		return ua.TransparentAddress(net)
+	}
+	if strings.HasPrefix(strings.ToLower(p.Address), net.SaplingPaymentAddressHRP+"1") {
+		return nil, errors.New("sapling addresses can't be paid with a transparent output")
+	}
+	return DecodeAddress(p.Address, net)
+}
+
+// validatePaymentAddress decodes a transparent, TEX, Sapling or Unified
+// Address and reports whether it can receive a memo.
+func validatePaymentAddress(address string, net *Params) (bool, error) {
+	lower := strings.ToLower(address)
+	switch {
+	case strings.HasPrefix(lower, net.UnifiedAddressHRP+"1"):
+		_, err := DecodeUnifiedAddress(address, net)
+		return true, err
+	case strings.HasPrefix(lower, net.SaplingPaymentAddressHRP+"1"):
+		_, err := DecodeSaplingAddress(address, net)
+		return true, err
+	}
+	_, err := DecodeAddress(address, net)
+	return false, err
+}
+
+// checkOtherParamName checks that name is a paramname of the ZIP-321
+// grammar, ALPHA *( ALPHA / DIGIT / "+" / "-" ), that is neither defined by
+// the specification nor a required parameter.
+func checkOtherParamName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("empty parameter name")
+	case name == "address" || name == "amount" || name == "memo" || name == "label" || name == "message":
+		return fmt.Errorf("parameter %q is defined by the specification", name)
+	case strings.HasPrefix(name, "req-"):
+		return fmt.Errorf("unsupported required parameter %q", name)
+	}
+	for i, c := range name {
+		alpha := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !alpha && (i == 0 || !(c >= '0' && c <= '9') && c != '+' && c != '-') {
+			return fmt.Errorf("invalid parameter name %q", name)
+		}
+	}
+	return nil
+}
+
+// splitParamIndex splits a parameter key into its name and payment index.
+// Indices have no leading zero and are at most four digits long.
+func splitParamIndex(key string) (string, int, error) {
+	name, index, ok := strings.Cut(key, ".")
+	if !ok {
+		return name, 0, nil
+	}
+	if len(index) == 0 || len(index) > 4 || index[0] == '0' {
+		return "", 0, fmt.Errorf("zip321: invalid parameter index %q", key)
+	}
+	for _, c := range index {
+		if c < '0' || c > '9' {
+			return "", 0, fmt.Errorf("zip321: invalid parameter index %q", key)
+		}
+	}
+	idx, _ := strconv.Atoi(index)
+	return name, idx, nil
+}
+
+// parseZecAmount parses a decimal ZEC amount with at most 8 decimals into
+// zatoshi.
+func parseZecAmount(s string) (int64, error) {
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" || (hasFrac && (frac == "" || len(frac) > 8)) {
+		return 0, fmt.Errorf("zip321: invalid amount %q", s)
+	}
+	for _, c := range whole + frac {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("zip321: invalid amount %q", s)
+		}
+	}
+
+	// MaxMoney is 21 million ZEC, eight integer digits.
+	whole = strings.TrimLeft(whole, "0")
+	if len(whole) > 8 {
+		return 0, fmt.Errorf("zip321: amount %q out of range", s)
+	}
+	zec, _ := strconv.ParseInt("0"+whole, 10, 64)
+	zat, _ := strconv.ParseInt("0"+frac+strings.Repeat("0", 8-len(frac)), 10, 64)
+
+	amount := zec*ZatoshiPerZec + zat
+	if amount > MaxMoney {
+		return 0, fmt.Errorf("zip321: amount %q out of range", s)
+	}
+	return amount, nil
+}
+
+// formatZecAmount formats an amount of zatoshi in ZEC without trailing
+// zeros.
+func formatZecAmount(amount int64) string {
+	s := strconv.FormatInt(amount/ZatoshiPerZec, 10)
+	if frac := amount % ZatoshiPerZec; frac != 0 {
+		s += "." + strings.TrimRight(fmt.Sprintf("%08d", frac), "0")
+	}
+	return s
+}
+
+// escapeQChars percent-encodes the characters of s which are not qchars.
+func escapeQChars(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			strings.IndexByte("-._~!$'()*+,;:@", c) >= 0:
+
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package zecutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Test vectors from ZIP-321.
+const (
+	zip321SaplingAddr = "ztestsapling10yy2ex5dcqkclhc7z7yrnjq2z6feyjad56ptwlfgmy77dmaqqrl9gyhprdx59qgmsnyfska2kez"
+	zip321SingleURI   = "zcash:" + zip321SaplingAddr + "?amount=1&memo=VGhpcyBpcyBhIHNpbXBsZSBtZW1vLg&message=Thank%20you%20for%20your%20purchase"
+	zip321MultiURI    = "zcash:?address=tmEZhbWHTpdKMw5it8YDspUXSMGQyFwovpU&amount=123.456&address.1=" + zip321SaplingAddr +
+		"&amount.1=0.789&memo.1=VGhpcyBpcyBhIHVuaWNvZGUgbWVtbyDinKjwn6aE8J-PhvCfjok"
+)
+
+func TestParsePaymentRequest(t *testing.T) {
+	req, err := ParsePaymentRequest(zip321SingleURI, netParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Payments) != 1 {
+		t.Fatalf("got %d payments", len(req.Payments))
+	}
+	p := req.Payments[0]
+	if p.Address != zip321SaplingAddr || p.Amount != ZatoshiPerZec ||
+		string(p.Memo) != "This is a simple memo." || p.Message != "Thank you for your purchase" {
+
+		t.Fatalf("unexpected payment %+v", p)
+	}
+	if uri, err := req.URI(); err != nil || uri != zip321SingleURI {
+		t.Fatalf("got uri %s, %v", uri, err)
+	}
+
+	req, err = ParsePaymentRequest(zip321MultiURI, netParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Payments) != 2 || req.Payments[0].Amount != 12345600000 || req.Payments[1].Amount != 78900000 {
+		t.Fatalf("unexpected payments %+v", req.Payments)
+	}
+	if string(req.Payments[1].Memo) != "This is a unicode memo ✨🦄🏆🎉" {
+		t.Fatalf("got memo %q", req.Payments[1].Memo)
+	}
+
+	uri, err := req.URI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParsePaymentRequest(uri, netParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range again.Payments {
+		if p.Address != req.Payments[i].Address || p.Amount != req.Payments[i].Amount ||
+			!bytes.Equal(p.Memo, req.Payments[i].Memo) {
+
+			t.Fatalf("payment %d does not round-trip", i)
+		}
+	}
+
+	// Labels and other parameters are percent-encoded.
+	req = &PaymentRequest{Payments: []*Payment{{
+		Address:     senderAddr,
+		Amount:      1,
+		Label:       "a&b=c d?%",
+		OtherParams: map[string]string{"foo": "bar baz"},
+	}}}
+	if uri, err = req.URI(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "zcash:" + senderAddr + "?amount=0.00000001&label=a%26b%3Dc%20d%3F%25&foo=bar%20baz"; uri != want {
+		t.Fatalf("got %s, want %s", uri, want)
+	}
+	if again, err = ParsePaymentRequest(uri, netParams); err != nil {
+		t.Fatal(err)
+	}
+	if again.Payments[0].Label != "a&b=c d?%" || again.Payments[0].OtherParams["foo"] != "bar baz" {
+		t.Fatalf("unexpected payment %+v", again.Payments[0])
+	}
+
+	// Other parameter names must follow the paramname grammar.
+	for _, name := range []string{"", "req-foo", "foo.1", "a=b", "a&b", "fo o", "1foo", "-foo", "amount"} {
+		req.Payments[0].OtherParams = map[string]string{name: "x"}
+		if uri, err = req.URI(); err == nil {
+			t.Fatalf("%q: expected error, got %s", name, uri)
+		}
+	}
+	req.Payments[0].OtherParams = map[string]string{"x-Foo+2": "x"}
+	if _, err = req.URI(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParsePaymentRequestInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+	}{
+		{"scheme", "bitcoin:" + senderAddr},
+		{"no payments", "zcash:"},
+		{"missing address", "zcash:?amount=1"},
+		{"indexed payment without address", "zcash:" + senderAddr + "?amount.1=1"},
+		{"duplicate address", "zcash:" + senderAddr + "?address=" + senderAddr},
+		{"duplicate amount", "zcash:" + senderAddr + "?amount=1&amount=2"},
+		{"index zero", "zcash:?address.0=" + senderAddr},
+		{"leading zero index", "zcash:?address.01=" + senderAddr},
+		{"five digit index", "zcash:?address.10000=" + senderAddr},
+		{"nine decimals", "zcash:" + senderAddr + "?amount=0.000000001"},
+		{"empty decimals", "zcash:" + senderAddr + "?amount=1."},
+		{"negative amount", "zcash:" + senderAddr + "?amount=-1"},
+		{"above max money", "zcash:" + senderAddr + "?amount=21000000.00000001"},
+		{"required parameter", "zcash:" + senderAddr + "?amount=1&req-futurefeature=1"},
+		{"memo to transparent", "zcash:" + senderAddr + "?memo=VGhpcyBpcyBhIHNpbXBsZSBtZW1vLg"},
+		{"padded memo", "zcash:" + zip321SaplingAddr + "?memo=VGhpcyBpcyBhIHNpbXBsZSBtZW1vLg=="},
+		{"wrong network", "zcash:t1VmmGiyjVNeCjxDZzg7vZmd99WyzVby9yC"},
+		{"parameter without value", "zcash:" + senderAddr + "?amount"},
+		{"invalid parameter name", "zcash:" + senderAddr + "?amount=1&1foo=bar"},
+	}
+	for _, test := range tests {
+		if _, err := ParsePaymentRequest(test.uri, netParams); err == nil {
+			t.Fatalf("%s: expected error", test.name)
+		}
+	}
+
+	if _, err := ParsePaymentRequest("ZCASH:"+senderAddr+"?amount=21000000", netParams); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPaymentRequestTxOuts(t *testing.T) {
+	tex := NewAddressTex([20]byte{1}, netParams)
+	req, err := ParsePaymentRequest("zcash:"+senderAddr+"?amount=1.5&address.1="+tex.String()+"&amount.1=0.001", netParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outs, err := req.TxOuts(netParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, _ := DecodeAddress(senderAddr, netParams)
+	senderScript, _ := PayToAddrScript(sender)
+	texScript, _ := PayToAddrScript(tex)
+	if len(outs) != 2 || outs[0].Value != 150000000 || !bytes.Equal(outs[0].PkScript, senderScript) ||
+		outs[1].Value != 100000 || !bytes.Equal(outs[1].PkScript, texScript) {
+
+		t.Fatalf("unexpected outputs %v", outs)
+	}
+
+	if req, err = ParsePaymentRequest(zip321SingleURI, netParams); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = req.TxOuts(netParams); err == nil {
+		t.Fatal("expected error paying a sapling address")
+	}
+	if req, err = ParsePaymentRequest("zcash:"+senderAddr, netParams); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = req.TxOuts(netParams); err == nil {
+		t.Fatal("expected error without amount")
+	}
+}